@@ -0,0 +1,110 @@
+// Package main provides a discovery agent for hosts that allow neither SSH
+// nor WinRM. It collects the local inventory with gopsutil and prints it as
+// JSON, saves it under -output in the layout the controller reads, or, for
+// hosts the controller cannot reach, pushes it to the controller's
+// /api/ingest endpoint signed with the server's agent token.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/discovery"
+	"github.com/vobbilis/codegen/server-discovery/pkg/ingest"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// tokenEnv names the environment variable the agent token is read from
+// when -token-file is not set
+const tokenEnv = "DISCOVERY_AGENT_TOKEN"
+
+func main() {
+	outputDir := flag.String("output", "", "Directory to save server_details.json in; prints to stdout when empty")
+	url := flag.String("url", "", "Controller ingest URL to push the inventory to, e.g. https://controller:8080/api/ingest")
+	serverID := flag.Int("server-id", 0, "ID of this host in the controller's inventory, required with -url")
+	tokenFile := flag.String("token-file", "", "File holding the agent token; defaults to $"+tokenEnv)
+	timeout := flag.Duration("timeout", 2*time.Minute, "Maximum time to spend collecting the inventory")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if *outputDir != "" {
+		result, err := (&discovery.LocalDiscoverer{}).ExecuteDiscovery(ctx, models.ServerConfig{}, *outputDir)
+		if err != nil {
+			log.Fatalf("Discovery failed: %v", err)
+		}
+		log.Printf("Inventory saved to %s", result.OutputPath)
+		return
+	}
+
+	details, err := discovery.CollectLocal(ctx)
+	if err != nil {
+		log.Fatalf("Discovery failed: %v", err)
+	}
+
+	if *url != "" {
+		if *serverID <= 0 {
+			log.Fatalf("-server-id is required with -url")
+		}
+		token, err := readToken(*tokenFile)
+		if err != nil {
+			log.Fatalf("Error reading agent token: %v", err)
+		}
+		if err := push(ctx, *url, *serverID, token, details); err != nil {
+			log.Fatalf("Error pushing inventory: %v", err)
+		}
+		log.Printf("Inventory pushed to %s", *url)
+		return
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(details); err != nil {
+		log.Fatalf("Error writing inventory: %v", err)
+	}
+}
+
+// readToken reads the agent token from path, or from tokenEnv when path is empty
+func readToken(path string) (string, error) {
+	token := os.Getenv(tokenEnv)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		token = string(data)
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("no token given; set -token-file or $%s", tokenEnv)
+	}
+	return token, nil
+}
+
+// push sends the signed inventory to the controller's ingest endpoint
+func push(ctx context.Context, url string, serverID int, token string, details models.ServerDetails) error {
+	req, err := ingest.NewRequest(ctx, url, serverID, token, details)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("controller returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
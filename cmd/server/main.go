@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
@@ -8,9 +9,12 @@ import (
 	"syscall"
 
 	"github.com/vobbilis/codegen/server-discovery/pkg/controller"
+	"github.com/vobbilis/codegen/server-discovery/pkg/credentials"
 	"github.com/vobbilis/codegen/server-discovery/pkg/database"
 	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+	"github.com/vobbilis/codegen/server-discovery/pkg/scheduler"
 	"github.com/vobbilis/codegen/server-discovery/pkg/server"
+	"github.com/vobbilis/codegen/server-discovery/pkg/sweep"
 )
 
 func main() {
@@ -23,6 +27,12 @@ func main() {
 		log.Fatalf("Error reading config file: %v", err)
 	}
 
+	// Set up the credential providers and resolve the database credentials
+	creds, err := credentials.ForConfig(context.Background(), config)
+	if err != nil {
+		log.Fatalf("Error setting up credentials: %v", err)
+	}
+
 	// Initialize database connection
 	db, err := database.NewDatabase(&config.Database)
 	if err != nil {
@@ -31,10 +41,19 @@ func main() {
 	defer db.Close()
 
 	// Initialize discovery controller
-	discoveryCtrl := controller.NewDiscoveryController(config, db)
+	discoveryCtrl := controller.NewDiscoveryController(config, db, creds)
+	discoveryCtrl.Start()
+
+	// Start the discovery scheduler
+	discoveryScheduler := scheduler.NewScheduler(config, db, discoveryCtrl)
+	discoveryScheduler.Start()
+
+	// Set up network sweeps for finding servers outside the inventory
+	sweeper := sweep.NewSweeper(config, db)
+	sweeper.Start()
 
 	// Initialize API server
-	apiServer := server.NewAPIServer(config, db, discoveryCtrl)
+	apiServer := server.NewAPIServer(config, db, discoveryCtrl, sweeper)
 
 	// Start API server in a goroutine
 	go func() {
@@ -51,4 +70,7 @@ func main() {
 	<-sigChan
 
 	log.Println("Shutting down server...")
+	discoveryScheduler.Stop()
+	sweeper.Stop()
+	discoveryCtrl.Stop()
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/controller"
+	"github.com/vobbilis/codegen/server-discovery/pkg/credentials"
+	"github.com/vobbilis/codegen/server-discovery/pkg/database"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func main() {
+	configFile := flag.String("config", "config.json", "Path to configuration file")
+	id := flag.String("id", "", "Worker ID (defaults to the hostname)")
+	region := flag.String("region", "", "Region of the servers this worker is closest to")
+	ip := flag.String("ip", "", "IP address reported to the coordinator")
+	capacity := flag.Int("capacity", 0, "Number of jobs run at once (defaults to the configured concurrency)")
+	flag.Parse()
+
+	// Read configuration file
+	config, err := models.ReadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+	if *capacity > 0 {
+		config.Concurrency = *capacity
+	}
+
+	// Set up the credential providers and resolve the database credentials
+	creds, err := credentials.ForConfig(context.Background(), config)
+	if err != nil {
+		log.Fatalf("Error setting up credentials: %v", err)
+	}
+
+	// Initialize database connection
+	db, err := database.NewDatabase(&config.Database)
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+	defer db.Close()
+
+	// Register with the coordinator and run the jobs it leases to us
+	discoveryCtrl := controller.NewDiscoveryController(config, db, creds)
+	err = discoveryCtrl.StartWorker(models.WorkerNode{
+		ID:        *id,
+		Region:    *region,
+		IPAddress: *ip,
+		Capacity:  *capacity,
+	})
+	if err != nil {
+		log.Fatalf("Error starting worker: %v", err)
+	}
+
+	// Wait for interrupt signal to gracefully shut down the worker
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+
+	log.Println("Shutting down worker...")
+	discoveryCtrl.Stop()
+}
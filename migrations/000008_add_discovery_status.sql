@@ -0,0 +1,9 @@
+-- Add status column to discovery_results so API-triggered runs can record their outcome
+ALTER TABLE server_discovery.discovery_results ADD COLUMN IF NOT EXISTS status VARCHAR(50);
+
+-- Backfill status for existing rows
+UPDATE server_discovery.discovery_results
+SET status = CASE WHEN success THEN 'completed' ELSE 'failed' END
+WHERE status IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_discovery_results_status ON server_discovery.discovery_results(status);
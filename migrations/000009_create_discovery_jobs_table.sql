@@ -0,0 +1,22 @@
+-- Create discovery_jobs table
+-- Tracks discovery runs queued on the controller through their lifecycle:
+-- queued -> running -> succeeded / failed / cancelled
+CREATE TABLE IF NOT EXISTS server_discovery.discovery_jobs (
+    id VARCHAR(64) PRIMARY KEY,
+    server_id INTEGER REFERENCES server_discovery.servers(id) ON DELETE CASCADE,
+    host VARCHAR(255) NOT NULL,
+    region VARCHAR(50),
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    discovery_id INTEGER REFERENCES server_discovery.discovery_results(id) ON DELETE SET NULL,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT discovery_jobs_status_check
+        CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'cancelled'))
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_discovery_jobs_server_id ON server_discovery.discovery_jobs(server_id);
+CREATE INDEX IF NOT EXISTS idx_discovery_jobs_status ON server_discovery.discovery_jobs(status);
+CREATE INDEX IF NOT EXISTS idx_discovery_jobs_created_at ON server_discovery.discovery_jobs(created_at);
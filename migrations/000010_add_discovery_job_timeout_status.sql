@@ -0,0 +1,4 @@
+-- Allow discovery jobs to record runs that exceeded their deadline
+ALTER TABLE server_discovery.discovery_jobs DROP CONSTRAINT IF EXISTS discovery_jobs_status_check;
+ALTER TABLE server_discovery.discovery_jobs ADD CONSTRAINT discovery_jobs_status_check
+    CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'cancelled', 'timeout'));
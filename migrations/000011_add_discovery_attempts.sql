@@ -0,0 +1,3 @@
+-- Record retry attempts so flaky hosts can be told apart from dead ones
+ALTER TABLE server_discovery.discovery_results ADD COLUMN IF NOT EXISTS attempt INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE server_discovery.discovery_jobs ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
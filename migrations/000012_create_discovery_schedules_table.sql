@@ -0,0 +1,30 @@
+-- Create discovery_schedules table
+-- Cron schedules for re-discovering the inventory. A server follows its tag
+-- schedules if any match, otherwise its region schedule, otherwise the global one.
+CREATE TABLE IF NOT EXISTS server_discovery.discovery_schedules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    cron_expression VARCHAR(100) NOT NULL,
+    scope VARCHAR(20) NOT NULL DEFAULT 'global',
+    region VARCHAR(50),
+    tag_name VARCHAR(100),
+    tag_value VARCHAR(255),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    next_run_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CONSTRAINT discovery_schedules_scope_check CHECK (scope IN ('global', 'region', 'tag')),
+    CONSTRAINT discovery_schedules_region_check CHECK (scope <> 'region' OR region IS NOT NULL),
+    CONSTRAINT discovery_schedules_tag_check CHECK (scope <> 'tag' OR tag_name IS NOT NULL)
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_discovery_schedules_scope ON server_discovery.discovery_schedules(scope);
+CREATE INDEX IF NOT EXISTS idx_discovery_schedules_enabled ON server_discovery.discovery_schedules(enabled);
+
+-- Add trigger to update updated_at timestamp
+CREATE TRIGGER update_discovery_schedules_updated_at
+    BEFORE UPDATE ON server_discovery.discovery_schedules
+    FOR EACH ROW
+    EXECUTE FUNCTION server_discovery.update_updated_at_column();
@@ -0,0 +1,5 @@
+-- Record whether an open port is a TCP connection or a UDP endpoint
+ALTER TABLE server_discovery.open_ports
+    ADD COLUMN IF NOT EXISTS protocol VARCHAR(10) NOT NULL DEFAULT 'tcp';
+
+CREATE INDEX IF NOT EXISTS idx_open_ports_protocol ON server_discovery.open_ports(protocol);
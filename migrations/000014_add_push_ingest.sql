@@ -0,0 +1,14 @@
+-- Record whether a discovery was pulled by the controller or pushed by an agent
+ALTER TABLE server_discovery.discovery_results
+    ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'pull';
+
+CREATE INDEX IF NOT EXISTS idx_discovery_results_source ON server_discovery.discovery_results(source);
+
+-- Per-host tokens that agents sign pushed inventory with. The token is the
+-- HMAC key, so it is kept as issued rather than hashed.
+CREATE TABLE IF NOT EXISTS server_discovery.agent_tokens (
+    server_id INTEGER PRIMARY KEY REFERENCES server_discovery.servers(id) ON DELETE CASCADE,
+    token VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1,36 @@
+-- Create network_sweeps table
+-- Probes of CIDR ranges for servers that are not in the inventory yet
+CREATE TABLE IF NOT EXISTS server_discovery.network_sweeps (
+    id SERIAL PRIMARY KEY,
+    cidrs TEXT[] NOT NULL,
+    ports INTEGER[] NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    total_hosts INTEGER NOT NULL DEFAULT 0,
+    probed_hosts INTEGER NOT NULL DEFAULT 0,
+    found_hosts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT network_sweeps_status_check CHECK (status IN ('running', 'completed', 'failed', 'cancelled'))
+);
+
+-- Create server_candidates table
+-- Hosts answering a sweep, waiting for an operator to approve them into the inventory
+CREATE TABLE IF NOT EXISTS server_discovery.server_candidates (
+    id SERIAL PRIMARY KEY,
+    sweep_id INTEGER REFERENCES server_discovery.network_sweeps(id) ON DELETE SET NULL,
+    ip VARCHAR(50) NOT NULL UNIQUE,
+    hostname VARCHAR(255),
+    os_type VARCHAR(50),
+    ports JSONB NOT NULL DEFAULT '[]',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    server_id INTEGER REFERENCES server_discovery.servers(id) ON DELETE SET NULL,
+    first_seen TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_seen TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CONSTRAINT server_candidates_status_check CHECK (status IN ('pending', 'approved', 'rejected'))
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_network_sweeps_status ON server_discovery.network_sweeps(status);
+CREATE INDEX IF NOT EXISTS idx_server_candidates_status ON server_discovery.server_candidates(status);
+CREATE INDEX IF NOT EXISTS idx_server_candidates_sweep_id ON server_discovery.server_candidates(sweep_id);
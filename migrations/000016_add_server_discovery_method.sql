@@ -0,0 +1,3 @@
+-- Discovery method chosen for a server, overriding the one its OS type maps to
+ALTER TABLE server_discovery.servers
+    ADD COLUMN IF NOT EXISTS discovery_method VARCHAR(50);
@@ -0,0 +1,30 @@
+-- Discovery workers registered with the coordinator. Workers heartbeat by
+-- updating last_seen; ones that stop doing so lose their job leases.
+CREATE TABLE IF NOT EXISTS server_discovery.worker_nodes (
+    id VARCHAR(128) PRIMARY KEY,
+    hostname VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(45),
+    region VARCHAR(50),
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    capacity INTEGER NOT NULL DEFAULT 1,
+    jobs_handled INTEGER NOT NULL DEFAULT 0,
+    registered_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_seen TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CONSTRAINT worker_nodes_status_check
+        CHECK (status IN ('active', 'throttled', 'stopped', 'dead'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_worker_nodes_last_seen ON server_discovery.worker_nodes(last_seen);
+
+-- Jobs are leased to a worker until lease_expires_at, which its heartbeats
+-- extend: queued -> leased -> running -> succeeded / failed / cancelled
+ALTER TABLE server_discovery.discovery_jobs
+    ADD COLUMN IF NOT EXISTS worker_id VARCHAR(128) REFERENCES server_discovery.worker_nodes(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS force BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE server_discovery.discovery_jobs DROP CONSTRAINT IF EXISTS discovery_jobs_status_check;
+ALTER TABLE server_discovery.discovery_jobs ADD CONSTRAINT discovery_jobs_status_check
+    CHECK (status IN ('queued', 'leased', 'running', 'cancelling', 'succeeded', 'failed', 'cancelled', 'timeout'));
+
+CREATE INDEX IF NOT EXISTS idx_discovery_jobs_worker_id ON server_discovery.discovery_jobs(worker_id);
@@ -0,0 +1,3 @@
+-- Credential a server is discovered with, overriding server.credential_ref
+ALTER TABLE server_discovery.servers
+    ADD COLUMN IF NOT EXISTS credential_ref VARCHAR(255);
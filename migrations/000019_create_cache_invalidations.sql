@@ -0,0 +1,7 @@
+-- When cached discovery results were last invalidated, so that distributed
+-- workers stop reusing results stored before then. server_id 0 covers every
+-- server.
+CREATE TABLE IF NOT EXISTS server_discovery.cache_invalidations (
+    server_id INTEGER PRIMARY KEY,
+    invalidated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
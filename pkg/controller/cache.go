@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+const (
+	// defaultCacheTTL is how long results are reused when Config.CacheTTL is unset
+	defaultCacheTTL = 30 * time.Minute
+
+	// cacheCleanupInterval is how often expired results are dropped
+	cacheCleanupInterval = 10 * time.Minute
+)
+
+// cachedResult is a successful discovery along with the fingerprint of the
+// settings it was collected with. discoveryID is set once the result is
+// stored; until then the result is not reused.
+type cachedResult struct {
+	result      models.DiscoveryResult
+	fingerprint string
+	discoveryID atomic.Int64
+}
+
+// cacheInvalidationStore records cache invalidations in the database so that
+// they reach every worker of a distributed deployment
+type cacheInvalidationStore interface {
+	InvalidateCachedResults(serverID int) error
+	CachedResultInvalidated(discoveryID, serverID int) (bool, error)
+}
+
+// cacheTTL returns how long successful results are reused. Config.CacheTTL is
+// in seconds; zero means the default and a negative value disables the cache.
+func (c *DiscoveryController) cacheTTL() time.Duration {
+	switch {
+	case c.config.CacheTTL > 0:
+		return time.Duration(c.config.CacheTTL) * time.Second
+	case c.config.CacheTTL < 0:
+		return 0
+	default:
+		return defaultCacheTTL
+	}
+}
+
+// newDiscoveryCache creates the result cache with the configured TTL
+func (c *DiscoveryController) newDiscoveryCache() *cache.Cache {
+	return cache.New(c.cacheTTL(), cacheCleanupInterval)
+}
+
+// cacheKey identifies a server's cached result by server ID and transport,
+// so the same server discovered over different transports is cached apart.
+// Servers that are not in the inventory are keyed by host.
+func (c *DiscoveryController) cacheKey(server models.ServerConfig) string {
+	transport := server.Method
+	if method, ok := c.discoverers.Lookup(server.Method); ok {
+		transport = method.Transport
+	}
+	if server.ID == 0 {
+		return fmt.Sprintf("host:%s/%s", server.Host, transport)
+	}
+	return fmt.Sprintf("%d/%s", server.ID, transport)
+}
+
+// cacheFingerprint hashes the resolved settings of a server, including its
+// credentials and tags, so that a cached result is not reused once they change
+func cacheFingerprint(server models.ServerConfig) string {
+	server.Force = false
+	data, err := json.Marshal(server)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedDiscovery returns the cached result for a server, marked as cached
+// and carrying the ID it was stored as, unless the server asks for a fresh
+// discovery or its settings changed since it was cached
+func (c *DiscoveryController) cachedDiscovery(server models.ServerConfig) (models.DiscoveryResult, bool) {
+	if server.Force || c.cacheTTL() == 0 {
+		return models.DiscoveryResult{}, false
+	}
+	key := c.cacheKey(server)
+	item, found := c.discoveryCache.Get(key)
+	if !found {
+		return models.DiscoveryResult{}, false
+	}
+	cached := item.(*cachedResult)
+	if cached.fingerprint != cacheFingerprint(server) {
+		log.Printf("Settings of %s changed, discarding its cached result", key)
+		c.discoveryCache.Delete(key)
+		return models.DiscoveryResult{}, false
+	}
+	id := cached.discoveryID.Load()
+	if id == 0 {
+		return models.DiscoveryResult{}, false
+	}
+	if c.invalidations != nil {
+		invalidated, err := c.invalidations.CachedResultInvalidated(int(id), server.ID)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			return models.DiscoveryResult{}, false
+		}
+		if invalidated {
+			log.Printf("Cached result of %s was invalidated, discarding it", key)
+			c.discoveryCache.Delete(key)
+			return models.DiscoveryResult{}, false
+		}
+	}
+	result := cached.result
+	result.ID = int(id)
+	result.Cached = true
+	return result, true
+}
+
+// cacheDiscovery keeps a successful result for reuse once storeCachedID
+// records the ID it is stored as
+func (c *DiscoveryController) cacheDiscovery(server models.ServerConfig, result models.DiscoveryResult) {
+	if c.cacheTTL() == 0 {
+		return
+	}
+	c.discoveryCache.Set(c.cacheKey(server), &cachedResult{result: result, fingerprint: cacheFingerprint(server)}, cache.DefaultExpiration)
+}
+
+// storeCachedID records the discovery ID a freshly collected result was
+// stored as, so that jobs reusing it from the cache can link to it. The
+// result must still be the one cached for its server; its details identify it.
+func (c *DiscoveryController) storeCachedID(result models.DiscoveryResult, id int) {
+	if result.Details == nil {
+		return
+	}
+	key := c.cacheKey(models.ServerConfig{ID: result.ServerID, Host: result.Server, Method: result.Method})
+	item, found := c.discoveryCache.Get(key)
+	if !found {
+		return
+	}
+	if cached := item.(*cachedResult); cached.result.Details == result.Details {
+		cached.discoveryID.Store(int64(id))
+	}
+}
+
+// InvalidateCache drops the cached results of a server over every transport
+// and returns how many were dropped here. In distributed mode the
+// invalidation is also recorded for the workers, which drop their own
+// results on their next use.
+func (c *DiscoveryController) InvalidateCache(serverID int) (int, error) {
+	if c.invalidations != nil {
+		if err := c.invalidations.InvalidateCachedResults(serverID); err != nil {
+			return 0, err
+		}
+	}
+	prefix := fmt.Sprintf("%d/", serverID)
+	dropped := 0
+	for key := range c.discoveryCache.Items() {
+		if strings.HasPrefix(key, prefix) {
+			c.discoveryCache.Delete(key)
+			dropped++
+		}
+	}
+	return dropped, nil
+}
+
+// ClearCache drops every cached result and returns how many were dropped
+// here; like InvalidateCache, it reaches the workers in distributed mode
+func (c *DiscoveryController) ClearCache() (int, error) {
+	if c.invalidations != nil {
+		if err := c.invalidations.InvalidateCachedResults(0); err != nil {
+			return 0, err
+		}
+	}
+	dropped := c.discoveryCache.ItemCount()
+	c.discoveryCache.Flush()
+	return dropped, nil
+}
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/discovery"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestCacheTTL(t *testing.T) {
+	for ttl, want := range map[int]time.Duration{0: defaultCacheTTL, 60: time.Minute, -1: 0} {
+		c := NewDiscoveryController(&models.Config{CacheTTL: ttl}, nil, nil)
+		if got := c.cacheTTL(); got != want {
+			t.Errorf("CacheTTL %d: got %s, want %s", ttl, got, want)
+		}
+	}
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	c := NewDiscoveryController(&models.Config{}, nil, nil)
+	web01 := models.ServerConfig{ID: 1, Host: "10.0.0.15", Method: discovery.MethodLinux, Password: "secret"}
+	web02 := models.ServerConfig{ID: 2, Host: "10.0.0.16", Method: discovery.MethodLinux, Password: "secret"}
+	cacheStored(c, web01, 41)
+
+	// Linux servers all have WinRM port 0 and must not share an entry
+	if _, found := c.cachedDiscovery(web02); found {
+		t.Error("web02 got the cached result of web01")
+	}
+	if result, found := c.cachedDiscovery(web01); !found || result.Server != web01.Host || !result.Cached || result.ID != 41 {
+		t.Errorf("got %+v, %v, want the cached result of web01 stored as 41", result, found)
+	}
+
+	snmp := web01
+	snmp.Method = discovery.MethodSNMP
+	if _, found := c.cachedDiscovery(snmp); found {
+		t.Error("the SSH result was reused for SNMP discovery")
+	}
+
+	forced := web01
+	forced.Force = true
+	if _, found := c.cachedDiscovery(forced); found {
+		t.Error("a forced discovery used the cache")
+	}
+
+	rotated := web01
+	rotated.Password = "rotated"
+	if _, found := c.cachedDiscovery(rotated); found {
+		t.Error("the cached result survived a credential change")
+	}
+	if _, found := c.cachedDiscovery(web01); found {
+		t.Error("the stale entry was not dropped")
+	}
+
+	tagged := web01
+	cacheStored(c, web01, 42)
+	tagged.Tags = map[string]string{"env": "prod"}
+	if _, found := c.cachedDiscovery(tagged); found {
+		t.Error("the cached result survived a tag change")
+	}
+
+	cacheStored(c, web01, 43)
+	cacheStored(c, snmp, 44)
+	cacheStored(c, web02, 45)
+	if n, _ := c.InvalidateCache(1); n != 2 {
+		t.Errorf("InvalidateCache(1) dropped %d entries, want 2", n)
+	}
+	if n, _ := c.ClearCache(); n != 1 {
+		t.Errorf("ClearCache dropped %d entries, want 1", n)
+	}
+
+	disabled := NewDiscoveryController(&models.Config{CacheTTL: -1}, nil, nil)
+	cacheStored(disabled, web01, 46)
+	if _, found := disabled.cachedDiscovery(web01); found {
+		t.Error("a negative CacheTTL did not disable the cache")
+	}
+}
+
+// cacheStored caches a successful result for server as the collector does,
+// and records that it was stored as id
+func cacheStored(c *DiscoveryController, server models.ServerConfig, id int) {
+	result := models.DiscoveryResult{Server: server.Host, Status: "completed", Details: &models.ServerDetails{}}
+	c.cacheDiscovery(server, result)
+	result.ServerID, result.Method = server.ID, server.Method
+	c.storeCachedID(result, id)
+}
+
+func TestCachedResultNeedsStoredID(t *testing.T) {
+	c := NewDiscoveryController(&models.Config{}, nil, nil)
+	server := models.ServerConfig{ID: 1, Host: "10.0.0.15", Method: discovery.MethodLinux}
+	result := models.DiscoveryResult{Server: server.Host, Status: "completed", Details: &models.ServerDetails{}}
+	c.cacheDiscovery(server, result)
+
+	if _, found := c.cachedDiscovery(server); found {
+		t.Fatal("result reused before it was stored")
+	}
+
+	// A result collected later for the same server keeps the ID from being
+	// recorded against the newer entry
+	result.ServerID, result.Method = server.ID, server.Method
+	c.cacheDiscovery(server, models.DiscoveryResult{Server: server.Host, Status: "completed", Details: &models.ServerDetails{}})
+	c.storeCachedID(result, 7)
+	if _, found := c.cachedDiscovery(server); found {
+		t.Fatal("newer result linked to an older discovery")
+	}
+}
+
+func TestCollectCachedResult(t *testing.T) {
+	// Without a database, storing the result would panic
+	c := NewDiscoveryController(&models.Config{}, nil, nil)
+	c.collectorWG.Add(1)
+	go c.collectResults()
+	c.resultChannel <- models.DiscoveryResult{ID: 7, JobID: "job-1", Success: true, Status: "completed", Cached: true}
+	close(c.resultChannel)
+	c.collectorWG.Wait()
+}
+
+// fakeInvalidations keeps cache invalidations in memory in place of the
+// database, tracking when each result was stored and invalidated
+type fakeInvalidations struct {
+	clock       int
+	stored      map[int]int // Discovery ID to the time it was stored
+	invalidated map[int]int // Server ID to the time it was last invalidated
+}
+
+func (f *fakeInvalidations) store(discoveryID int) {
+	f.clock++
+	f.stored[discoveryID] = f.clock
+}
+
+func (f *fakeInvalidations) InvalidateCachedResults(serverID int) error {
+	f.clock++
+	f.invalidated[serverID] = f.clock
+	return nil
+}
+
+func (f *fakeInvalidations) CachedResultInvalidated(discoveryID, serverID int) (bool, error) {
+	stored := f.stored[discoveryID]
+	for _, id := range []int{0, serverID} {
+		if at, ok := f.invalidated[id]; ok && at >= stored {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestDistributedCacheInvalidation(t *testing.T) {
+	shared := &fakeInvalidations{stored: map[int]int{}, invalidated: map[int]int{}}
+	coordinator := NewDiscoveryController(&models.Config{}, nil, nil)
+	coordinator.invalidations = shared
+	worker := NewDiscoveryController(&models.Config{}, nil, nil)
+	worker.invalidations = shared
+
+	web01 := models.ServerConfig{ID: 1, Host: "10.0.0.15", Method: discovery.MethodLinux}
+	web02 := models.ServerConfig{ID: 2, Host: "10.0.0.16", Method: discovery.MethodLinux}
+	cacheStored(worker, web01, 51)
+	shared.store(51)
+	cacheStored(worker, web02, 52)
+	shared.store(52)
+
+	// Invalidating on the coordinator reaches the worker's cache
+	if _, err := coordinator.InvalidateCache(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := worker.cachedDiscovery(web01); found {
+		t.Error("a result invalidated on the coordinator was reused")
+	}
+	if _, found := worker.cachedDiscovery(web02); !found {
+		t.Error("invalidating one server dropped another server's result")
+	}
+
+	// Results stored after the invalidation are reused
+	cacheStored(worker, web01, 53)
+	shared.store(53)
+	if _, found := worker.cachedDiscovery(web01); !found {
+		t.Error("a result stored after the invalidation was not reused")
+	}
+
+	if _, err := coordinator.ClearCache(); err != nil {
+		t.Fatal(err)
+	}
+	for _, server := range []models.ServerConfig{web01, web02} {
+		if _, found := worker.cachedDiscovery(server); found {
+			t.Errorf("%s: result reused after the cache was cleared", server.Host)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/credentials"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// credential resolves a credential reference with the controller's provider
+func (c *DiscoveryController) credential(ctx context.Context, ref string) (credentials.Credential, error) {
+	if c.credentials == nil {
+		return credentials.Credential{}, fmt.Errorf("credential_ref %q is set but no credential provider is configured", ref)
+	}
+	return c.credentials.Get(ctx, ref)
+}
+
+// resolveServerCredentials fills in the server's username and password from
+// its credential_ref, and the SNMPv3 privacy password from its passphrase.
+// References are resolved on every discovery so that rotated secrets are
+// picked up without a restart.
+func (c *DiscoveryController) resolveServerCredentials(ctx context.Context, server models.ServerConfig) (models.ServerConfig, error) {
+	if server.CredentialRef == "" {
+		return server, nil
+	}
+	cred, err := c.credential(ctx, server.CredentialRef)
+	if err != nil {
+		return server, err
+	}
+	if cred.Username != "" {
+		server.Username = cred.Username
+	}
+	server.Password = cred.Password
+	if cred.Passphrase != "" {
+		server.SNMPPrivPassword = cred.Passphrase
+	}
+	return server, nil
+}
+
+// resolveSSHCredentials fills in the SSH settings from the credential_ref of
+// Config.SSH, which sshConfigFor only keeps when the server has no
+// credentials of its own. A username set on the server still wins.
+func (c *DiscoveryController) resolveSSHCredentials(ctx context.Context, config models.SSHConfig, server models.ServerConfig) (models.SSHConfig, error) {
+	if config.CredentialRef == "" {
+		return config, nil
+	}
+	cred, err := c.credential(ctx, config.CredentialRef)
+	if err != nil {
+		return config, err
+	}
+	if cred.Username != "" && server.Username == "" {
+		config.Username = cred.Username
+	}
+	config.Password = cred.Password
+	config.Passphrase = cred.Passphrase
+	return config, nil
+}
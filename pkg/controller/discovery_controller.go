@@ -1,31 +1,34 @@
 package controller
 
 import (
-	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
-	"github.com/masterzen/winrm"
 	"github.com/patrickmn/go-cache"
-	"github.com/shirou/gopsutil/cpu"
-	"github.com/shirou/gopsutil/mem"
+	"github.com/vobbilis/codegen/server-discovery/pkg/credentials"
 	"github.com/vobbilis/codegen/server-discovery/pkg/database"
 	"github.com/vobbilis/codegen/server-discovery/pkg/discovery"
 	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+	sshtransport "github.com/vobbilis/codegen/server-discovery/pkg/transport/ssh"
 )
 
+// defaultLinuxScript is the Linux discovery script used when Config.LinuxScript is unset
+const defaultLinuxScript = "Enhanced-ServerDiscovery.sh"
+
 // DiscoveryController handles server discovery operations
 type DiscoveryController struct {
 	config         models.Config
-	connectionPool ConnectionPool
+	connectionPool *ConnectionPool
+	sshPool        *sshtransport.Pool
 	discoveryCache *cache.Cache
+	invalidations  cacheInvalidationStore // Shares cache invalidations with workers in distributed mode
 	resultChannel  chan models.DiscoveryResult
 	completedJobs  int32
 	totalJobs      int32
@@ -33,204 +36,161 @@ type DiscoveryController struct {
 	progressTicker *time.Ticker
 	progressDone   chan bool
 	db             *database.Database
-	resourceCtrl   ResourceController
-	workers        []*WorkerNode
+	credentials    credentials.CredentialProvider
+	discoverers    *discovery.Registry
+	resourceCtrl   *ResourceController
+	limiter        *DispatchLimiter
+	node           *models.WorkerNode // Set when running as a distributed worker
+	startedAt      time.Time
+	jobQueue       chan queuedJob
+	jobs           map[string]*models.DiscoveryJob
+	cancels        map[string]context.CancelFunc
+	stopped        bool
+	ctx            context.Context
+	cancel         context.CancelFunc
+	workerWG       sync.WaitGroup
+	collectorWG    sync.WaitGroup
 }
 
-// NewDiscoveryController creates a new discovery controller
-func NewDiscoveryController(config *models.Config, db *database.Database) *DiscoveryController {
-	return &DiscoveryController{
+// NewDiscoveryController creates a new discovery controller. creds resolves
+// the credential_ref settings and may be nil if none are used.
+func NewDiscoveryController(config *models.Config, db *database.Database, creds credentials.CredentialProvider) *DiscoveryController {
+	// A nil *database.Database must not become a non-nil HostKeyStore
+	var hostKeys sshtransport.HostKeyStore
+	if db != nil {
+		hostKeys = db
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &DiscoveryController{
 		config:         *config,
 		db:             db,
-		discoveryCache: cache.New(30*time.Minute, 10*time.Minute),
+		credentials:    creds,
+		resourceCtrl:   NewResourceController(config.Resources),
+		limiter:        NewDispatchLimiter(config.Limits),
 		resultChannel:  make(chan models.DiscoveryResult, 100),
-		connectionPool: ConnectionPool{
-			clients:     make(map[string]*winrm.Client),
-			lastUsed:    make(map[string]time.Time),
-			maxSize:     10,
-			idleTimeout: 10 * time.Minute,
-		},
-		progressDone: make(chan bool),
-	}
-}
-
-// ConnectionPool manages WinRM client connections
-type ConnectionPool struct {
-	clients     map[string]*winrm.Client
-	mutex       sync.Mutex
-	maxSize     int
-	idleTimeout time.Duration
-	lastUsed    map[string]time.Time
-}
-
-// ResourceController manages system resources
-type ResourceController struct {
-	CPUThreshold    float64
-	MemoryThreshold float64
-	lastCheck       time.Time
-	checkInterval   time.Duration
-}
-
-// WorkerNode represents a worker node in the system
-type WorkerNode struct {
-	ID          string    `json:"id"`
-	Hostname    string    `json:"hostname"`
-	IPAddress   string    `json:"ip_address"`
-	Status      string    `json:"status"`
-	LastSeen    time.Time `json:"last_seen"`
-	JobsHandled int       `json:"jobs_handled"`
-	currentJobs int32     // Used internally for load balancing
-}
-
-// waitForResources waits until system resources are below thresholds
-func (rc *ResourceController) waitForResources() {
-	// Don't check too frequently
-	if time.Since(rc.lastCheck) < rc.checkInterval {
-		return
-	}
-
-	for {
-		cpuUsage, err := getCPUUsage()
-		if err != nil {
-			log.Printf("Warning: Failed to get CPU usage: %v", err)
-			return
-		}
-
-		memUsage, err := getMemoryUsage()
-		if err != nil {
-			log.Printf("Warning: Failed to get memory usage: %v", err)
-			return
-		}
-
-		if cpuUsage < rc.CPUThreshold && memUsage < rc.MemoryThreshold {
-			break
-		}
-
-		log.Printf("Resource usage high (CPU: %.1f%%, Memory: %.1f%%), waiting before starting next batch...",
-			cpuUsage, memUsage)
-		time.Sleep(5 * time.Second)
-	}
-
-	rc.lastCheck = time.Now()
-}
-
-// Helper functions to get resource usage
-func getCPUUsage() (float64, error) {
-	percentages, err := cpu.Percent(time.Second, false)
-	if err != nil {
-		return 0, err
+		connectionPool: NewConnectionPool(10, 10*time.Minute),
+		sshPool:        sshtransport.NewPool(10, 10*time.Minute, hostKeys),
+		progressDone:   make(chan bool),
+		jobQueue:       make(chan queuedJob, jobQueueSize),
+		jobs:           make(map[string]*models.DiscoveryJob),
+		cancels:        make(map[string]context.CancelFunc),
+		ctx:            ctx,
+		cancel:         cancel,
 	}
-	return percentages[0], nil
-}
-
-func getMemoryUsage() (float64, error) {
-	vmStat, err := mem.VirtualMemory()
-	if err != nil {
-		return 0, err
+	c.discoverers = c.discoveryMethods()
+	c.discoveryCache = c.newDiscoveryCache()
+	if config.Distributed.Enabled && db != nil {
+		c.invalidations = db
 	}
-	return vmStat.UsedPercent, nil
+	return c
 }
 
-// getClient creates a new WinRM client
-func getClient(server models.ServerConfig) (*winrm.Client, error) {
-	endpoint := winrm.NewEndpoint(
-		server.Host,
-		server.WinRMPort,
-		server.WinRMHTTPS,
-		server.WinRMInsecure,
-		nil,
-		nil,
-		nil,
-		30*time.Second,
-	)
-
-	client, err := winrm.NewClient(endpoint, server.Username, server.Password)
-	if err != nil {
-		return nil, err
-	}
-
-	return client, nil
-}
-
-// Load PowerShell script from file
-func loadPowerShellScript(scriptPath string) (string, error) {
+// Load a discovery script from file
+func loadScript(scriptPath string) (string, error) {
 	scriptBytes, err := os.ReadFile(scriptPath)
 	if err != nil {
-		return "", fmt.Errorf("error reading PowerShell script: %w", err)
+		return "", fmt.Errorf("error reading discovery script: %w", err)
 	}
 	return string(scriptBytes), nil
 }
 
 // WindowsDiscoverer implements ServerDiscoverer for Windows servers
 type WindowsDiscoverer struct {
-	client        *winrm.Client
+	pool          *ConnectionPool
 	scriptContent string
+	transfer      string
 }
 
 // LinuxDiscoverer implements ServerDiscoverer for Linux servers
 type LinuxDiscoverer struct {
+	pool          *sshtransport.Pool
 	sshConfig     models.SSHConfig
 	scriptContent string
+	collector     string
 }
 
 // ExecuteDiscovery for Windows servers
-func (d *WindowsDiscoverer) ExecuteDiscovery(server models.ServerConfig, outputDir string) (models.DiscoveryResult, error) {
+func (d *WindowsDiscoverer) ExecuteDiscovery(ctx context.Context, server models.ServerConfig, outputDir string) (models.DiscoveryResult, error) {
 	result := models.DiscoveryResult{
 		Status:      "running",
 		LastChecked: time.Now(),
 	}
 
-	// Create output directory
-	serverOutputDir := filepath.Join(outputDir, fmt.Sprintf("%s-%s", server.Host, time.Now().Format("20060102-150405")))
-	if err := os.MkdirAll(serverOutputDir, 0755); err != nil {
-		return result, fmt.Errorf("failed to create output directory: %w", err)
+	client, err := d.pool.Get(server)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = fmt.Sprintf("failed to create WinRM client: %v", err)
+		return result, err
 	}
-
-	// Create a temporary file for the script
-	scriptFile := filepath.Join(serverOutputDir, "discovery_script.ps1")
-	if err := os.WriteFile(scriptFile, []byte(d.scriptContent), 0644); err != nil {
-		return result, fmt.Errorf("failed to write script file: %w", err)
+	defer d.pool.Release(server)
+
+	// Execute script on server and collect its output bundle
+	outputPath, err := discovery.RunWindowsDiscovery(ctx, client, server.Host, d.scriptContent, d.transfer, outputDir)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		result.Status = contextStatus(ctxErr)
+		result.Error = fmt.Sprintf("discovery interrupted: %v", ctxErr)
+		return result, ctxErr
 	}
-
-	// Execute script on server
-	var outputBuffer, errorBuffer bytes.Buffer
-	command := fmt.Sprintf("powershell.exe -EncodedCommand %s", base64.StdEncoding.EncodeToString([]byte(d.scriptContent)))
-
-	exitCode, err := runCommand(d.client, command, &outputBuffer, &errorBuffer)
-	if err != nil || exitCode != 0 {
+	if err != nil {
+		// Start the next attempt with a fresh client in case this one is broken
+		d.pool.Evict(server)
 		result.Status = "failed"
-		result.Error = fmt.Sprintf("execution error (exit code %d): %v\n%s", exitCode, err, errorBuffer.String())
+		result.Error = fmt.Sprintf("Windows discovery failed: %v", err)
 		return result, err
 	}
 
+	result.OutputPath = outputPath
 	result.Status = "completed"
 	return result, nil
 }
 
 // ExecuteDiscovery for Linux servers
-func (d *LinuxDiscoverer) ExecuteDiscovery(server models.ServerConfig, outputDir string) (models.DiscoveryResult, error) {
+func (d *LinuxDiscoverer) ExecuteDiscovery(ctx context.Context, server models.ServerConfig, outputDir string) (models.DiscoveryResult, error) {
 	result := models.DiscoveryResult{
 		Status:      "running",
 		LastChecked: time.Now(),
 	}
 
 	// Execute Linux discovery
-	_, err := discovery.RunLinuxDiscovery(d.sshConfig, outputDir)
+	var outputPath string
+	var err error
+	if d.collector == discovery.LinuxCollectorCommands {
+		outputPath, err = discovery.RunLinuxCommands(ctx, d.pool, d.sshConfig, outputDir)
+	} else {
+		outputPath, err = discovery.RunLinuxDiscovery(ctx, d.pool, d.sshConfig, []byte(d.scriptContent), outputDir)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		result.Status = contextStatus(ctxErr)
+		result.Error = fmt.Sprintf("Linux discovery interrupted: %v", ctxErr)
+		return result, ctxErr
+	}
+	if sshtransport.IsHostKeyMismatch(err) {
+		log.Printf("Warning: refusing to run discovery on %s: %v", server.Host, err)
+		result.Status = "host_key_mismatch"
+		result.Error = fmt.Sprintf("Linux discovery failed: %v", err)
+		return result, err
+	}
 	if err != nil {
 		result.Status = "failed"
 		result.Error = fmt.Sprintf("Linux discovery failed: %v", err)
 		return result, err
 	}
 
+	result.OutputPath = outputPath
 	result.Status = "completed"
 	return result, nil
 }
 
-// ParseDiscoveryOutput for Windows servers
+// ParseDiscoveryOutput for Windows servers. Output from
+// Enhanced-ServerDiscovery.ps1 is a bundle of JSON files; a single
+// server_details.json is still accepted when present.
 func (d *WindowsDiscoverer) ParseDiscoveryOutput(outputPath string) (models.ServerDetails, error) {
-	// Parse the JSON output file
 	jsonFile := filepath.Join(outputPath, "server_details.json")
 	data, err := os.ReadFile(jsonFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return discovery.ParseWindowsBundle(outputPath)
+	}
 	if err != nil {
 		return models.ServerDetails{}, fmt.Errorf("failed to read JSON output: %w", err)
 	}
@@ -243,97 +203,269 @@ func (d *WindowsDiscoverer) ParseDiscoveryOutput(outputPath string) (models.Serv
 	return details, nil
 }
 
-// ParseDiscoveryOutput for Linux servers
+// ParseDiscoveryOutput for Linux servers. Output from the command-based
+// collector has no server_details.json and is parsed from the saved command
+// output instead.
 func (d *LinuxDiscoverer) ParseDiscoveryOutput(outputPath string) (models.ServerDetails, error) {
 	// Parse the JSON output file
 	jsonFile := filepath.Join(outputPath, "server_details.json")
 	data, err := os.ReadFile(jsonFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return discovery.ParseLinuxCommands(outputPath)
+	}
 	if err != nil {
 		return models.ServerDetails{}, fmt.Errorf("failed to read JSON output: %w", err)
 	}
 
-	var details models.ServerDetails
-	if err := json.Unmarshal(data, &details); err != nil {
+	details, err := discovery.ParseServerDetailsJSON(data)
+	if err != nil {
 		return models.ServerDetails{}, fmt.Errorf("failed to parse JSON output: %w", err)
 	}
-
 	return details, nil
 }
 
-// NewServerDiscoverer creates appropriate discoverer based on server type
-func NewServerDiscoverer(server models.ServerConfig, scriptPath string) (discovery.ServerDiscoverer, error) {
-	if server.UseWinRM {
-		client, err := getClient(server)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create WinRM client: %w", err)
+// discoveryMethods creates the controller's registry: the methods added with
+// discovery.Register plus the script-based Linux and Windows discoverers,
+// which need the controller's connection pools
+func (c *DiscoveryController) discoveryMethods() *discovery.Registry {
+	registry := discovery.DefaultRegistry()
+	for _, method := range []discovery.Method{
+		{
+			Name:         discovery.MethodLinux,
+			Capabilities: discovery.Capabilities{Transport: discovery.TransportSSH, OSTypes: []string{"linux"}},
+			New:          c.newLinuxDiscoverer,
+		},
+		{
+			Name:         discovery.MethodWindows,
+			Capabilities: discovery.Capabilities{Transport: discovery.TransportWinRM, OSTypes: []string{"windows"}},
+			New:          c.newWindowsDiscoverer,
+		},
+	} {
+		if err := registry.Register(method); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	return registry
+}
+
+// DiscoveryMethods returns the registry servers' discovery methods are
+// looked up in. Methods registered on it are available to later discoveries.
+func (c *DiscoveryController) DiscoveryMethods() *discovery.Registry {
+	return c.discoverers
+}
+
+// newServerDiscoverer creates the discoverer for the server's method.
+// Servers without one are discovered over SSH as Linux servers.
+func (c *DiscoveryController) newServerDiscoverer(ctx context.Context, server models.ServerConfig) (discovery.ServerDiscoverer, error) {
+	if server.Method == "" {
+		server.Method = discovery.MethodLinux
+	}
+	env := discovery.Environment{
+		Config:  c.config,
+		SSHPool: c.sshPool,
+		SSHConfig: func(ctx context.Context, server models.ServerConfig) (models.SSHConfig, error) {
+			return c.resolveSSHCredentials(ctx, c.sshConfigFor(server), server)
+		},
+	}
+	return c.discoverers.New(ctx, env, server)
+}
+
+// newWindowsDiscoverer runs the PowerShell discovery script over WinRM
+func (c *DiscoveryController) newWindowsDiscoverer(ctx context.Context, env discovery.Environment, server models.ServerConfig) (discovery.ServerDiscoverer, error) {
+	scriptContent, err := loadScript(env.Config.PowerShellScript)
+	if err != nil {
+		return nil, err
+	}
+	return &WindowsDiscoverer{
+		pool:          c.connectionPool,
+		scriptContent: scriptContent,
+		transfer:      env.Config.WinRMTransfer,
+	}, nil
+}
+
+// newLinuxDiscoverer runs the configured Linux collector over SSH
+func (c *DiscoveryController) newLinuxDiscoverer(ctx context.Context, env discovery.Environment, server models.ServerConfig) (discovery.ServerDiscoverer, error) {
+	var scriptContent string
+	switch env.Config.LinuxCollector {
+	case "", discovery.LinuxCollectorScript:
+		scriptPath := env.Config.LinuxScript
+		if scriptPath == "" {
+			scriptPath = defaultLinuxScript
 		}
-		scriptContent, err := loadPowerShellScript(scriptPath)
-		if err != nil {
+		var err error
+		if scriptContent, err = loadScript(scriptPath); err != nil {
 			return nil, err
 		}
-		return &WindowsDiscoverer{
-			client:        client,
-			scriptContent: scriptContent,
-		}, nil
+	case discovery.LinuxCollectorCommands:
+	default:
+		return nil, fmt.Errorf("unknown Linux collector %q", env.Config.LinuxCollector)
 	}
 
-	scriptContent, err := loadPowerShellScript(scriptPath)
+	sshConfig, err := env.SSHConfig(ctx, server)
 	if err != nil {
 		return nil, err
 	}
 	return &LinuxDiscoverer{
-		sshConfig:     models.SSHConfig{},
+		pool:          env.SSHPool,
+		sshConfig:     sshConfig,
 		scriptContent: scriptContent,
+		collector:     env.Config.LinuxCollector,
 	}, nil
 }
 
-// ExecuteDiscovery executes discovery on a server
-func (c *DiscoveryController) ExecuteDiscovery(server models.ServerConfig, scriptContent string) models.DiscoveryResult {
-	serverKey := fmt.Sprintf("%s:%d", server.Host, server.WinRMPort)
+// sshConfigFor builds the SSH settings for a server. Credentials set on the
+// server take precedence over the global Config.SSH defaults, and its jump
+// hosts over those of its region and the global ones.
+func (c *DiscoveryController) sshConfigFor(server models.ServerConfig) models.SSHConfig {
+	config := c.config.SSH
+	config.Host = server.Host
+	config.ServerID = server.ID
+	if server.SSHPort != 0 {
+		config.Port = server.SSHPort
+	}
+	if server.Username != "" {
+		config.Username = server.Username
+	}
+	if server.Password != "" || server.PrivateKeyPath != "" {
+		config.Password = server.Password
+		config.PrivateKeyPath = server.PrivateKeyPath
+		config.CertificatePath = ""
+		config.CredentialRef = ""
+	}
+	if len(server.SSHProxyJump) > 0 {
+		config.ProxyJump = server.SSHProxyJump
+	} else if jumps, ok := config.RegionProxyJump[server.Region]; ok {
+		config.ProxyJump = jumps
+	}
+	if server.TimeoutSeconds != 0 {
+		config.TimeoutSeconds = server.TimeoutSeconds
+	}
+	return config
+}
+
+// ExecuteDiscovery executes discovery on a server. Unless ctx already carries
+// a deadline, the run is bounded by the server's TimeoutSeconds or the global
+// discovery timeout.
+func (c *DiscoveryController) ExecuteDiscovery(ctx context.Context, server models.ServerConfig, scriptContent string) models.DiscoveryResult {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = c.withServerTimeout(ctx, server)
+		defer cancel()
+	}
+
+	result, _ := c.executeDiscovery(ctx, server)
+	return result
+}
+
+// executeDiscovery performs a single discovery attempt and returns the
+// underlying error so callers can decide whether to retry
+func (c *DiscoveryController) executeDiscovery(ctx context.Context, server models.ServerConfig) (models.DiscoveryResult, error) {
+	// Credentials are resolved before the cache lookup so that a rotated
+	// secret invalidates the cached result
+	server, err := c.resolveServerCredentials(ctx, server)
+	if err != nil {
+		return c.discovererFailed(server, err)
+	}
 
 	// Check cache first
-	if cachedResult, found := c.discoveryCache.Get(serverKey); found {
-		log.Printf("Using cached result for %s", serverKey)
-		result := cachedResult.(models.DiscoveryResult)
+	if result, found := c.cachedDiscovery(server); found {
+		log.Printf("Using cached result for %s", c.cacheKey(server))
 		result.Message = "Retrieved from cache"
-		return result
+		return result, nil
 	}
 
 	// Create appropriate discoverer
-	discoverer, err := NewServerDiscoverer(server, c.config.PowerShellScript)
+	discoverer, err := c.newServerDiscoverer(ctx, server)
 	if err != nil {
-		return models.DiscoveryResult{
-			Server:    serverKey,
-			Success:   false,
-			Error:     fmt.Sprintf("Failed to create discoverer: %v", err),
-			StartTime: time.Now(),
-			EndTime:   time.Now(),
+		return c.discovererFailed(server, err)
+	}
+
+	// Pace new connections. Workers of a distributed deployment leave this
+	// to the coordinator, which paces the leases of all of them.
+	if c.limiter != nil && c.node == nil {
+		if err := c.limiter.waitForConnection(ctx); err != nil {
+			result := models.DiscoveryResult{
+				Server:    server.Host,
+				Status:    contextStatus(err),
+				Error:     fmt.Sprintf("discovery interrupted while waiting to connect: %v", err),
+				StartTime: time.Now(),
+				EndTime:   time.Now(),
+			}
+			return result, err
 		}
 	}
 
 	// Execute discovery
-	result, err := discoverer.ExecuteDiscovery(server, c.config.OutputDir)
+	result, err := discoverer.ExecuteDiscovery(ctx, server, c.config.OutputDir)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		result.Status = contextStatus(ctxErr)
+		if result.Error == "" {
+			result.Error = fmt.Sprintf("discovery interrupted: %v", ctxErr)
+		}
+	}
+	if err == nil && result.OutputPath != "" {
+		details, parseErr := discoverer.ParseDiscoveryOutput(result.OutputPath)
+		if parseErr != nil {
+			err = fmt.Errorf("failed to parse discovery output: %w", parseErr)
+			result.Status = "failed"
+			result.Error = err.Error()
+		} else {
+			result.Details = &details
+		}
+	}
 	if err != nil {
-		log.Printf("Discovery failed for %s: %v", serverKey, err)
+		log.Printf("Discovery failed for %s: %v", server.Host, err)
 	} else {
 		// Cache successful results
-		c.discoveryCache.Set(serverKey, result, cache.DefaultExpiration)
+		c.cacheDiscovery(server, result)
 	}
 
-	return result
+	return result, err
+}
+
+// discovererFailed builds the result of a discovery that failed before its
+// discoverer could run
+func (c *DiscoveryController) discovererFailed(server models.ServerConfig, err error) (models.DiscoveryResult, error) {
+	return models.DiscoveryResult{
+		Server:    server.Host,
+		Success:   false,
+		Status:    "failed",
+		Error:     fmt.Sprintf("Failed to create discoverer: %v", err),
+		StartTime: time.Now(),
+		EndTime:   time.Now(),
+	}, err
 }
 
-// Run command on a server
-func runCommand(client *winrm.Client, command string, stdout, stderr io.Writer) (int, error) {
-	return client.Run(command, stdout, stderr)
+// withServerTimeout bounds ctx by the server's TimeoutSeconds, falling back to
+// the global timeout settings
+func (c *DiscoveryController) withServerTimeout(ctx context.Context, server models.ServerConfig) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(server.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = time.Duration(c.config.Timeout) * time.Second
+	}
+	if timeout <= 0 {
+		timeout = c.config.Discovery.Timeout
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// contextStatus maps a context error onto a discovery result status
+func contextStatus(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return "cancelled"
 }
 
-// StoreResultInDatabase stores a discovery result in the database
-func (c *DiscoveryController) StoreResultInDatabase(result models.DiscoveryResult) error {
-	// Create discovery result in database
-	_, err := c.db.CreateDiscoveryResult(result)
+// StoreResultInDatabase stores a discovery result, along with any inventory
+// parsed from its output, in the database and returns its ID
+func (c *DiscoveryController) StoreResultInDatabase(result models.DiscoveryResult) (int, error) {
+	id, err := c.db.StoreDiscovery(result)
 	if err != nil {
-		return fmt.Errorf("failed to store discovery result: %w", err)
+		return 0, fmt.Errorf("failed to store discovery result: %w", err)
 	}
-	return nil
+	return id, nil
 }
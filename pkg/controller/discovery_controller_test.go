@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/credentials"
+	"github.com/vobbilis/codegen/server-discovery/pkg/discovery"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// sampleLinuxOutput is trimmed output of Enhanced-ServerDiscovery.sh
+const sampleLinuxOutput = `{
+  "hostname": "web01",
+  "os_name": "Ubuntu 22.04.4 LTS",
+  "os_version": "22.04",
+  "os_type": "linux",
+  "kernel_version": "5.15.0-105-generic",
+  "package_manager": "dpkg",
+  "init_system": "systemd",
+  "selinux_status": "disabled",
+  "firewall_status": "active",
+  "active_users": [],
+  "system_load": {"load1": 0.12, "load5": 0.10, "load15": 0.05},
+  "network_interfaces": [
+    {"name": "lo", "mac_address": "00:00:00:00:00:00", "mtu": 65536, "state": "UNKNOWN", "speed": null, "ip_addresses": ["127.0.0.1", "::1"]},
+    {"name": "eth0", "mac_address": "52:54:00:12:34:56", "mtu": 1500, "state": "UP", "speed": 1000, "duplex": "full", "ip_addresses": ["10.0.0.15", "fe80::1"]}
+  ],
+  "mounted_filesystems": [
+    {"device": "/dev/sda1", "mount_point": "/", "fs_type": "ext4", "options": "rw", "total_gb": 40.00, "used_gb": 10.00, "free_gb": 30.00, "used_inodes": 100, "free_inodes": 900},
+    {"device": "tmpfs", "mount_point": "/run", "fs_type": "tmpfs", "options": "rw", "total_gb": 1.00, "used_gb": 0, "free_gb": 1.00, "used_inodes": 1, "free_inodes": 9}
+  ]
+}`
+
+func TestLinuxParseDiscoveryOutput(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "server_details.json"), []byte(sampleLinuxOutput), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := (&LinuxDiscoverer{}).ParseDiscoveryOutput(dir)
+	if err != nil {
+		t.Fatalf("ParseDiscoveryOutput returned error: %v", err)
+	}
+
+	if details.Hostname != "web01" || details.OSType != "linux" || details.KernelVersion != "5.15.0-105-generic" {
+		t.Errorf("unexpected system fields: %+v", details)
+	}
+	if details.IP != "10.0.0.15" {
+		t.Errorf("IP = %q, want 10.0.0.15", details.IP)
+	}
+	if len(details.IPAddresses) != 4 || details.IPAddresses[2].InterfaceName != "eth0" {
+		t.Errorf("unexpected IP addresses: %+v", details.IPAddresses)
+	}
+	if len(details.Filesystems) != 2 {
+		t.Fatalf("got %d filesystems, want 2", len(details.Filesystems))
+	}
+	root := details.Filesystems[0]
+	if root.TotalBytes != 40<<30 || root.UsedPercent != 25 || root.TotalInodes != 1000 {
+		t.Errorf("unexpected root filesystem: %+v", root)
+	}
+	if details.DiskTotalGB != 40 || details.DiskFreeGB != 30 {
+		t.Errorf("disk totals = %.2f/%.2f, want 40/30", details.DiskTotalGB, details.DiskFreeGB)
+	}
+}
+
+func TestSSHConfigForProxyJump(t *testing.T) {
+	c := &DiscoveryController{config: models.Config{SSH: models.SSHConfig{
+		Username:        "discovery",
+		PrivateKeyPath:  "/etc/discovery/id_ed25519",
+		CertificatePath: "/etc/discovery/id_ed25519-cert.pub",
+		ProxyJump:       []string{"bastion"},
+		RegionProxyJump: map[string][]string{"eu-west": {"eu-bastion", "eu-inner"}, "lab": {}},
+	}}}
+
+	tests := []struct {
+		name   string
+		server models.ServerConfig
+		want   []string
+	}{
+		{"global", models.ServerConfig{ID: 1, Host: "db01", Region: "us-east"}, []string{"bastion"}},
+		{"region", models.ServerConfig{ID: 2, Host: "db02", Region: "eu-west"}, []string{"eu-bastion", "eu-inner"}},
+		{"direct region", models.ServerConfig{ID: 3, Host: "db03", Region: "lab"}, []string{}},
+		{"server", models.ServerConfig{ID: 4, Host: "db04", Region: "eu-west", SSHProxyJump: []string{"ops@jump:2222"}}, []string{"ops@jump:2222"}},
+	}
+	for _, tt := range tests {
+		config := c.sshConfigFor(tt.server)
+		if fmt.Sprint(config.ProxyJump) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: ProxyJump = %v, want %v", tt.name, config.ProxyJump, tt.want)
+		}
+		if config.ServerID != tt.server.ID || config.CertificatePath == "" {
+			t.Errorf("%s: unexpected config %+v", tt.name, config)
+		}
+	}
+
+	config := c.sshConfigFor(models.ServerConfig{Host: "db05", PrivateKeyPath: "/home/ops/.ssh/id_rsa"})
+	if config.CertificatePath != "" {
+		t.Errorf("global certificate kept for a server-specific key: %s", config.CertificatePath)
+	}
+}
+
+func TestResolveCredentials(t *testing.T) {
+	t.Setenv("DISCOVERY_CREDENTIAL_LINUX_USERNAME", "discovery")
+	t.Setenv("DISCOVERY_CREDENTIAL_LINUX_PASSWORD", "ssh-secret")
+	t.Setenv("DISCOVERY_CREDENTIAL_LINUX_PASSPHRASE", "key-secret")
+	t.Setenv("DISCOVERY_CREDENTIAL_DB07_PASSWORD", "db07-secret")
+	c := &DiscoveryController{
+		config: models.Config{SSH: models.SSHConfig{
+			CredentialRef:  "linux",
+			PrivateKeyPath: "/etc/discovery/id_ed25519",
+		}},
+		credentials: credentials.NewEnvProvider(""),
+	}
+	ctx := context.Background()
+
+	// Without server credentials the SSH defaults are resolved
+	server := models.ServerConfig{Host: "db06"}
+	config, err := c.resolveSSHCredentials(ctx, c.sshConfigFor(server), server)
+	if err != nil {
+		t.Fatalf("resolveSSHCredentials returned error: %v", err)
+	}
+	if config.Username != "discovery" || config.Password != "ssh-secret" || config.Passphrase != "key-secret" {
+		t.Errorf("unexpected SSH credentials: %+v", config)
+	}
+
+	// A server credential takes precedence over the SSH defaults
+	server, err = c.resolveServerCredentials(ctx, models.ServerConfig{Host: "db07", Username: "root", CredentialRef: "db07"})
+	if err != nil {
+		t.Fatalf("resolveServerCredentials returned error: %v", err)
+	}
+	config, err = c.resolveSSHCredentials(ctx, c.sshConfigFor(server), server)
+	if err != nil {
+		t.Fatalf("resolveSSHCredentials returned error: %v", err)
+	}
+	if config.Username != "root" || config.Password != "db07-secret" || config.Passphrase != "" {
+		t.Errorf("unexpected server credentials: %+v", config)
+	}
+
+	if _, err := c.resolveServerCredentials(ctx, models.ServerConfig{CredentialRef: "missing"}); err == nil {
+		t.Error("expected an error for an unknown credential")
+	}
+}
+
+func TestIsLocalHost(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "::1", hostname} {
+		if !isLocalHost(host) {
+			t.Errorf("isLocalHost(%q) = false, want true", host)
+		}
+	}
+	for _, host := range []string{"", "10.0.0.15", "db01.example.com"} {
+		if isLocalHost(host) {
+			t.Errorf("isLocalHost(%q) = true, want false", host)
+		}
+	}
+}
+
+func TestServerConfigForMethod(t *testing.T) {
+	c := NewDiscoveryController(&models.Config{Server: models.ServerConfig{Method: "aix"}}, nil, nil)
+
+	for _, tt := range []struct {
+		server models.ServerDetails
+		want   string
+	}{
+		{models.ServerDetails{IP: "10.0.0.15", OSType: "linux"}, discovery.MethodLinux},
+		{models.ServerDetails{IP: "10.0.0.16", OSType: "Windows Server 2022"}, discovery.MethodWindows},
+		{models.ServerDetails{IP: "10.0.0.20", OSType: discovery.OSTypeNetwork}, discovery.MethodSNMP},
+		{models.ServerDetails{IP: "127.0.0.1", OSType: "linux"}, discovery.MethodLocal},
+		{models.ServerDetails{IP: "10.0.0.30", OSType: "aix"}, "aix"},
+		{models.ServerDetails{IP: "10.0.0.21", OSType: "linux", DiscoveryMethod: discovery.MethodSNMP}, discovery.MethodSNMP},
+	} {
+		server := c.ServerConfigFor(&tt.server)
+		if server.Method != tt.want {
+			t.Errorf("%s/%s: method = %q, want %q", tt.server.IP, tt.server.OSType, server.Method, tt.want)
+		}
+		if (server.WinRMPort == 5985) != (tt.want == discovery.MethodWindows) {
+			t.Errorf("%s: WinRM port = %d", tt.server.IP, server.WinRMPort)
+		}
+	}
+
+	if ref := c.ServerConfigFor(&models.ServerDetails{IP: "10.0.0.15"}).CredentialRef; ref != "" {
+		t.Errorf("credential_ref = %q without a default or per-server reference", ref)
+	}
+	c.config.Server.CredentialRef = "linux"
+	if ref := c.ServerConfigFor(&models.ServerDetails{IP: "10.0.0.15"}).CredentialRef; ref != "linux" {
+		t.Errorf("credential_ref = %q, want the default", ref)
+	}
+	if ref := c.ServerConfigFor(&models.ServerDetails{IP: "10.0.0.15", CredentialRef: "vault:db07"}).CredentialRef; ref != "vault:db07" {
+		t.Errorf("credential_ref = %q, want the server's own", ref)
+	}
+
+	if _, err := c.newServerDiscoverer(context.Background(), models.ServerConfig{Method: "aix"}); err == nil {
+		t.Error("expected an error for an unregistered method")
+	}
+	discoverer, err := c.newServerDiscoverer(context.Background(), models.ServerConfig{Method: discovery.MethodSNMP, Host: "10.0.0.20"})
+	if _, ok := discoverer.(*discovery.SNMPDiscoverer); err != nil || !ok {
+		t.Errorf("got %T (%v), want an SNMP discoverer", discoverer, err)
+	}
+}
+
+func TestTOFUWithoutDatabase(t *testing.T) {
+	c := NewDiscoveryController(&models.Config{}, nil, nil)
+	config := models.SSHConfig{Host: "127.0.0.1", Port: 1, Username: "discovery", Password: "x", ServerID: 1}
+	_, err := c.sshPool.Get(context.Background(), config)
+	if err == nil || !strings.Contains(err.Error(), "host key store") {
+		t.Errorf("got %v, want an error about the missing host key store", err)
+	}
+}
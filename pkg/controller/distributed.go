@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/database"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// Defaults for the settings in DistributedConfig
+const (
+	defaultLeaseDuration     = 60 * time.Second
+	defaultHeartbeatInterval = 10 * time.Second
+	defaultWorkerTimeout     = 30 * time.Second
+	defaultDispatchInterval  = time.Second
+
+	// leaseBatchSize is the most queued jobs leased in one dispatch round
+	leaseBatchSize = 100
+)
+
+// distributed reports whether this controller coordinates worker processes
+// instead of running jobs itself
+func (c *DiscoveryController) distributed() bool {
+	return c.config.Distributed.Enabled && c.node == nil
+}
+
+// durationOr converts n units to a duration, or returns def if n is unset
+func durationOr(n int, unit, def time.Duration) time.Duration {
+	if n > 0 {
+		return time.Duration(n) * unit
+	}
+	return def
+}
+
+func (c *DiscoveryController) leaseDuration() time.Duration {
+	return durationOr(c.config.Distributed.LeaseSeconds, time.Second, defaultLeaseDuration)
+}
+
+func (c *DiscoveryController) heartbeatInterval() time.Duration {
+	return durationOr(c.config.Distributed.HeartbeatSeconds, time.Second, defaultHeartbeatInterval)
+}
+
+func (c *DiscoveryController) workerTimeout() time.Duration {
+	return durationOr(c.config.Distributed.WorkerTimeoutSeconds, time.Second, defaultWorkerTimeout)
+}
+
+func (c *DiscoveryController) dispatchInterval() time.Duration {
+	return durationOr(c.config.Distributed.DispatchIntervalMillis, time.Millisecond, defaultDispatchInterval)
+}
+
+// pickWorker returns the index of the worker a job should be leased to, or
+// -1 if every worker is full or not active. Workers in the job's region are
+// preferred; among those the one with the lowest share of its capacity in
+// use wins.
+func pickWorker(job models.DiscoveryJob, workers []models.WorkerNode) int {
+	best := -1
+	for i, worker := range workers {
+		if worker.Status != models.WorkerStatusActive || worker.CurrentJobs >= worker.Capacity {
+			continue
+		}
+		if best < 0 || betterWorker(job.Region, worker, workers[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// leaseWorker picks the worker to lease a job to, or returns -1 to leave the
+// job queued while it would exceed a dispatch limit. The limits count the
+// jobs of every worker, so adding workers does not raise them. Once the
+// connection rate allows no more leases, it returns database.StopLeasing.
+func (c *DiscoveryController) leaseWorker(job models.DiscoveryJob, workers []models.WorkerNode, active []models.DiscoveryJob) int {
+	if c.limiter != nil && !c.limiter.allowsLease(job, active) {
+		return -1
+	}
+	i := pickWorker(job, workers)
+	if i >= 0 && c.limiter != nil && !c.limiter.takeLease() {
+		return database.StopLeasing
+	}
+	return i
+}
+
+// betterWorker reports whether a should be preferred over b for a job in region
+func betterWorker(region string, a, b models.WorkerNode) bool {
+	aLocal := region != "" && strings.EqualFold(a.Region, region)
+	bLocal := region != "" && strings.EqualFold(b.Region, region)
+	if aLocal != bLocal {
+		return aLocal
+	}
+	aLoad := float64(a.CurrentJobs) / float64(a.Capacity)
+	bLoad := float64(b.CurrentJobs) / float64(b.Capacity)
+	if aLoad != bLoad {
+		return aLoad < bLoad
+	}
+	return a.CurrentJobs < b.CurrentJobs
+}
+
+// coordinate leases queued jobs to workers every dispatch interval and, every
+// heartbeat interval, marks silent workers dead and returns the jobs of
+// expired leases to the queue
+func (c *DiscoveryController) coordinate() {
+	defer c.workerWG.Done()
+
+	dispatch := time.NewTicker(c.dispatchInterval())
+	defer dispatch.Stop()
+	reap := time.NewTicker(c.heartbeatInterval())
+	defer reap.Stop()
+
+	for {
+		select {
+		case <-dispatch.C:
+			n, err := c.db.LeaseDiscoveryJobs(leaseBatchSize, c.leaseDuration(), c.workerTimeout(), c.leaseWorker)
+			if err != nil {
+				log.Printf("Warning: %v", err)
+			} else if n > 0 {
+				log.Printf("Leased %d discovery jobs to workers", n)
+			}
+		case <-reap.C:
+			dead, err := c.db.MarkDeadWorkerNodes(c.workerTimeout())
+			if err != nil {
+				log.Printf("Warning: %v", err)
+			} else if len(dead) > 0 {
+				log.Printf("Workers stopped sending heartbeats: %v", dead)
+			}
+			n, err := c.db.ReclaimExpiredLeases()
+			if err != nil {
+				log.Printf("Warning: %v", err)
+			} else if n > 0 {
+				log.Printf("Reclaimed %d discovery jobs with expired leases", n)
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// StartWorker registers this process as a worker with the coordinator and
+// starts running the jobs leased to it. The hostname defaults to the local
+// one, the ID to the hostname and the capacity to the worker pool size.
+func (c *DiscoveryController) StartWorker(node models.WorkerNode) error {
+	if node.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("failed to get hostname: %w", err)
+		}
+		node.Hostname = hostname
+	}
+	if node.ID == "" {
+		node.ID = node.Hostname
+	}
+	if node.Capacity <= 0 {
+		node.Capacity = c.workerCount()
+	}
+	node.Status = models.WorkerStatusActive
+
+	if err := c.db.RegisterWorkerNode(node); err != nil {
+		return err
+	}
+	c.node = &node
+
+	c.startWorkers()
+
+	c.workerWG.Add(2)
+	go c.claimJobs()
+	go c.heartbeat()
+
+	log.Printf("Worker %s registered in region %q with capacity %d", node.ID, node.Region, node.Capacity)
+	return nil
+}
+
+// claimJobs starts the jobs leased to this worker as pool slots free up,
+// unless resource usage is above the limits
+func (c *DiscoveryController) claimJobs() {
+	defer c.workerWG.Done()
+
+	ticker := time.NewTicker(c.dispatchInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.ctx.Done():
+			return
+		}
+		if c.resourceCtrl != nil && c.resourceCtrl.Status().Throttled {
+			continue
+		}
+
+		c.jobsMutex.Lock()
+		free := c.node.Capacity - len(c.jobs)
+		c.jobsMutex.Unlock()
+		if free <= 0 {
+			continue
+		}
+
+		jobs, err := c.db.ClaimDiscoveryJobs(c.node.ID, free)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		for i := range jobs {
+			c.runClaimedJob(&jobs[i])
+		}
+	}
+}
+
+// runClaimedJob queues a job claimed from the coordinator on the local pool
+func (c *DiscoveryController) runClaimedJob(job *models.DiscoveryJob) {
+	details, err := c.db.GetServerDetails(strconv.Itoa(job.ServerID))
+	if err != nil {
+		c.failJob(job, models.JobStatusFailed, fmt.Sprintf("failed to load server: %v", err))
+		return
+	}
+	server := c.ServerConfigFor(details)
+	server.Force = job.Force
+
+	c.jobsMutex.Lock()
+	defer c.jobsMutex.Unlock()
+	if c.stopped {
+		// Stop returns the job to the coordinator's queue
+		return
+	}
+	select {
+	case c.jobQueue <- queuedJob{job: job, server: server}:
+		c.jobs[job.ID] = job
+		atomic.AddInt32(&c.totalJobs, 1)
+	default:
+		// Not renewed by heartbeats, so the lease runs out and the job is requeued
+		log.Printf("Warning: %v, leaving job %s to be reclaimed", ErrJobQueueFull, job.ID)
+	}
+}
+
+// heartbeat reports this worker as alive every heartbeat interval, renewing
+// the leases of its jobs, and cancels the jobs the coordinator took back
+func (c *DiscoveryController) heartbeat() {
+	defer c.workerWG.Done()
+
+	ticker := time.NewTicker(c.heartbeatInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.ctx.Done():
+			return
+		}
+
+		status := models.WorkerStatusActive
+		if c.resourceCtrl != nil && c.resourceCtrl.Status().Throttled {
+			status = models.WorkerStatusThrottled
+		}
+
+		c.jobsMutex.Lock()
+		held := make([]string, 0, len(c.jobs))
+		for id := range c.jobs {
+			held = append(held, id)
+		}
+		c.jobsMutex.Unlock()
+
+		stop, err := c.db.HeartbeatWorkerNode(c.node.ID, status, held, c.leaseDuration())
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Worker %s is no longer registered, registering again", c.node.ID)
+			err = c.db.RegisterWorkerNode(*c.node)
+		}
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		for _, id := range stop {
+			if err := c.CancelJob(id); err == nil {
+				log.Printf("Coordinator took back discovery job %s", id)
+			}
+		}
+	}
+}
+
+// distributedProgress counts the jobs created since the coordinator started
+// by their state in the database, and the live workers and their capacity.
+// Limits count the jobs leased to or running on any worker.
+func (c *DiscoveryController) distributedProgress() models.JobProgress {
+	var progress models.JobProgress
+
+	counts, err := c.db.CountDiscoveryJobs(c.startedAt)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	for status, n := range counts {
+		progress.TotalJobs += n
+		switch status {
+		case models.JobStatusQueued, models.JobStatusLeased:
+			progress.QueuedJobs += n
+		case models.JobStatusRunning, models.JobStatusCancelling:
+			progress.RunningJobs += n
+		default:
+			progress.CompletedJobs += n
+		}
+	}
+
+	nodes, err := c.db.GetWorkerNodes()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	for _, node := range nodes {
+		if node.Status == models.WorkerStatusActive || node.Status == models.WorkerStatusThrottled {
+			progress.WorkerNodes++
+			progress.Workers += node.Capacity
+		}
+	}
+
+	if c.limiter != nil {
+		active, err := c.db.GetActiveDiscoveryJobs()
+		if err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		status := c.limiter.leaseStatus(active)
+		progress.Limits = &status
+	}
+	return progress
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/database"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestPickWorker(t *testing.T) {
+	workers := []models.WorkerNode{
+		{ID: "east-busy", Region: "us-east", Status: models.WorkerStatusActive, Capacity: 4, CurrentJobs: 3},
+		{ID: "east-idle", Region: "US-East", Status: models.WorkerStatusActive, Capacity: 10, CurrentJobs: 5},
+		{ID: "west", Region: "us-west", Status: models.WorkerStatusActive, Capacity: 4, CurrentJobs: 0},
+		{ID: "east-throttled", Region: "us-east", Status: models.WorkerStatusThrottled, Capacity: 4},
+		{ID: "east-full", Region: "us-east", Status: models.WorkerStatusActive, Capacity: 2, CurrentJobs: 2},
+	}
+
+	tests := []struct {
+		region string
+		want   string
+	}{
+		{"us-east", "east-idle"}, // least loaded of the live workers in the region
+		{"eu-west", "west"},      // no worker in the region
+		{"", "west"},
+	}
+	for _, tt := range tests {
+		i := pickWorker(models.DiscoveryJob{Region: tt.region}, workers)
+		if i < 0 || workers[i].ID != tt.want {
+			t.Errorf("region %q: picked %d, want %s", tt.region, i, tt.want)
+		}
+	}
+
+	limited := NewDiscoveryController(&models.Config{Limits: models.LimitsConfig{MaxPerRegion: 1}}, nil, nil)
+	active := []models.DiscoveryJob{{ID: "running", Region: "us-east", WorkerID: "west"}}
+	if i := limited.leaseWorker(models.DiscoveryJob{Region: "us-east"}, workers, active); i != -1 {
+		t.Errorf("leased to %s past the region limit of all workers", workers[i].ID)
+	}
+
+	// Leases are paced across all workers by the coordinator
+	paced := NewDiscoveryController(&models.Config{Limits: models.LimitsConfig{ConnectionsPerSecond: 0.001, ConnectionBurst: 2}}, nil, nil)
+	for n := 0; n < 2; n++ {
+		if i := paced.leaseWorker(models.DiscoveryJob{Region: "us-west"}, workers, nil); i < 0 {
+			t.Fatalf("lease %d within the burst was refused", n)
+		}
+	}
+	if i := paced.leaseWorker(models.DiscoveryJob{Region: "us-west"}, workers, nil); i != database.StopLeasing {
+		t.Errorf("lease past the connection rate returned %d, want StopLeasing", i)
+	}
+
+	for i := range workers {
+		workers[i].CurrentJobs = workers[i].Capacity
+	}
+	if i := pickWorker(models.DiscoveryJob{Region: "us-east"}, workers); i != -1 {
+		t.Errorf("picked %s with every worker full", workers[i].ID)
+	}
+}
+
+func TestDistributedControllerRunsNoJobs(t *testing.T) {
+	c := NewDiscoveryController(&models.Config{Distributed: models.DistributedConfig{Enabled: true}}, nil, nil)
+	if !c.distributed() {
+		t.Fatal("coordinator not in distributed mode")
+	}
+	if c.dispatchInterval() != defaultDispatchInterval || c.leaseDuration() != defaultLeaseDuration {
+		t.Errorf("unexpected defaults: dispatch %s, lease %s", c.dispatchInterval(), c.leaseDuration())
+	}
+
+	c.node = &models.WorkerNode{ID: "worker-1"}
+	if c.distributed() {
+		t.Error("worker process leases jobs instead of running them")
+	}
+}
@@ -0,0 +1,573 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/discovery"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+const (
+	defaultConcurrency = 5
+	jobQueueSize       = 1000
+	progressInterval   = 30 * time.Second
+)
+
+// ErrJobQueueFull is returned when no more discovery jobs can be queued
+var ErrJobQueueFull = errors.New("discovery job queue is full")
+
+// ErrControllerStopped is returned when a job is queued after Stop was called
+var ErrControllerStopped = errors.New("discovery controller is stopped")
+
+// ErrJobNotActive is returned when cancelling a job that is not queued or running
+var ErrJobNotActive = errors.New("discovery job is not queued or running")
+
+// queuedJob pairs a job with the connection settings needed to run it
+type queuedJob struct {
+	job    *models.DiscoveryJob
+	server models.ServerConfig
+}
+
+// Start launches the discovery worker pool, the result collector and the
+// progress reporter. The pool size is taken from Config.Concurrency. With
+// distributed discovery enabled, jobs are leased to worker processes instead
+// and no local pool is started.
+func (c *DiscoveryController) Start() {
+	c.startedAt = time.Now()
+	if c.distributed() {
+		c.workerWG.Add(1)
+		go c.coordinate()
+
+		c.progressTicker = time.NewTicker(progressInterval)
+		go c.reportProgress()
+
+		log.Printf("Discovery controller started as coordinator of distributed workers")
+		return
+	}
+
+	if n, err := c.db.FailInterruptedDiscoveryJobs(); err != nil {
+		log.Printf("Warning: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted discovery jobs as failed", n)
+	}
+	c.startWorkers()
+}
+
+// startWorkers launches the local worker pool and its background goroutines
+func (c *DiscoveryController) startWorkers() {
+	workers := c.workerCount()
+	for i := 0; i < workers; i++ {
+		c.workerWG.Add(1)
+		go c.worker()
+	}
+
+	c.collectorWG.Add(1)
+	go c.collectResults()
+
+	if c.resourceCtrl != nil {
+		go c.resourceCtrl.Run(c.ctx)
+	}
+
+	c.connectionPool.StartReaper()
+
+	c.progressTicker = time.NewTicker(progressInterval)
+	go c.reportProgress()
+
+	log.Printf("Discovery controller started with %d workers", workers)
+}
+
+// Stop cancels queued and running jobs, waits for the workers to record their
+// results and stops the background goroutines
+func (c *DiscoveryController) Stop() {
+	c.jobsMutex.Lock()
+	if c.stopped {
+		c.jobsMutex.Unlock()
+		return
+	}
+	c.stopped = true
+	close(c.jobQueue)
+	c.jobsMutex.Unlock()
+
+	// Hand this worker's jobs back before cancelling them, so they are
+	// requeued rather than recorded as cancelled
+	if c.node != nil {
+		if err := c.db.StopWorkerNode(c.node.ID); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	c.cancel()
+
+	c.workerWG.Wait()
+	close(c.resultChannel)
+	c.collectorWG.Wait()
+	close(c.progressDone)
+	c.sshPool.CloseAll()
+	c.connectionPool.Close()
+
+	log.Println("Discovery controller stopped")
+}
+
+// EnqueueDiscovery queues a discovery job for a server and returns
+// immediately. With distributed discovery the job is only recorded, for the
+// coordinator to lease to a worker.
+func (c *DiscoveryController) EnqueueDiscovery(server models.ServerConfig) (*models.DiscoveryJob, error) {
+	job := &models.DiscoveryJob{
+		ID:        newJobID(),
+		ServerID:  server.ID,
+		Host:      server.Host,
+		Region:    server.Region,
+		Status:    models.JobStatusQueued,
+		CreatedAt: time.Now(),
+		Force:     server.Force,
+	}
+
+	if err := c.db.CreateDiscoveryJob(*job); err != nil {
+		return nil, err
+	}
+	if c.distributed() {
+		return job, nil
+	}
+
+	c.jobsMutex.Lock()
+	if c.stopped {
+		c.jobsMutex.Unlock()
+		c.failJob(job, models.JobStatusCancelled, ErrControllerStopped.Error())
+		return nil, ErrControllerStopped
+	}
+
+	select {
+	case c.jobQueue <- queuedJob{job: job, server: server}:
+		c.jobs[job.ID] = job
+		atomic.AddInt32(&c.totalJobs, 1)
+		snapshot := *job
+		c.jobsMutex.Unlock()
+		return &snapshot, nil
+	default:
+		c.jobsMutex.Unlock()
+		c.failJob(job, models.JobStatusFailed, ErrJobQueueFull.Error())
+		return nil, ErrJobQueueFull
+	}
+}
+
+// CancelJob cancels a queued or running job. Queued jobs are closed out
+// immediately; running jobs have their context cancelled and are recorded
+// as cancelled once the discoverer returns. With distributed discovery the
+// worker running the job cancels it on its next heartbeat.
+func (c *DiscoveryController) CancelJob(jobID string) error {
+	if c.distributed() {
+		status, err := c.db.RequestDiscoveryJobCancel(jobID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrJobNotActive
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Discovery job %s is %s", jobID, status)
+		return nil
+	}
+
+	c.jobsMutex.Lock()
+	job, exists := c.jobs[jobID]
+	if !exists {
+		c.jobsMutex.Unlock()
+		return ErrJobNotActive
+	}
+
+	if job.Status == models.JobStatusRunning {
+		if cancel, ok := c.cancels[jobID]; ok {
+			cancel()
+		}
+		c.jobsMutex.Unlock()
+		log.Printf("Cancelling running discovery job %s", jobID)
+		return nil
+	}
+
+	// Remove the job while still holding the lock so a worker cannot pick it up
+	now := time.Now()
+	job.Status = models.JobStatusCancelled
+	job.Error = "cancelled before start"
+	job.FinishedAt = &now
+	snapshot := *job
+	delete(c.jobs, jobID)
+	atomic.AddInt32(&c.completedJobs, 1)
+	c.jobsMutex.Unlock()
+
+	if err := c.db.UpdateDiscoveryJob(snapshot); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	log.Printf("Cancelled queued discovery job %s", jobID)
+	return nil
+}
+
+// HasActiveJob reports whether a server already has a job queued or running
+func (c *DiscoveryController) HasActiveJob(serverID int) bool {
+	if c.distributed() {
+		active, err := c.db.HasActiveDiscoveryJob(serverID)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		return active
+	}
+
+	c.jobsMutex.Lock()
+	defer c.jobsMutex.Unlock()
+
+	for _, job := range c.jobs {
+		if job.ServerID == serverID {
+			return true
+		}
+	}
+	return false
+}
+
+// ServerConfigFor creates the connection settings for an inventoried server,
+// starting from the defaults in Config.Server
+func (c *DiscoveryController) ServerConfigFor(server *models.ServerDetails) models.ServerConfig {
+	serverConfig := c.config.Server
+	serverConfig.ID = server.ID
+	serverConfig.Region = server.Region
+	serverConfig.Host = server.IP
+	if serverConfig.Host == "" {
+		serverConfig.Host = server.Hostname
+	}
+	if len(server.Tags) > 0 {
+		serverConfig.Tags = make(map[string]string, len(server.Tags))
+		for _, tag := range server.Tags {
+			serverConfig.Tags[tag.TagName] = tag.TagValue
+		}
+	}
+	if server.CredentialRef != "" {
+		serverConfig.CredentialRef = server.CredentialRef
+	}
+
+	// A method set on the server wins. Otherwise the controller's own host
+	// needs no remote session, and other servers get the method declaring
+	// their OS type, falling back to the one in Config.Server.
+	switch {
+	case server.DiscoveryMethod != "":
+		serverConfig.Method = server.DiscoveryMethod
+	case isLocalHost(server.Hostname) || isLocalHost(server.IP):
+		serverConfig.Method = discovery.MethodLocal
+	default:
+		if method := c.discoverers.MethodFor(server.OSType); method != "" {
+			serverConfig.Method = method
+		}
+	}
+
+	if serverConfig.Method == discovery.MethodWindows && serverConfig.WinRMPort == 0 {
+		serverConfig.WinRMPort = 5985
+		if serverConfig.WinRMHTTPS {
+			serverConfig.WinRMPort = 5986
+		}
+	}
+
+	return serverConfig
+}
+
+// isLocalHost reports whether host names the machine the controller runs on
+func isLocalHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+	hostname, err := os.Hostname()
+	return err == nil && strings.EqualFold(host, hostname)
+}
+
+// ActiveJobs returns a snapshot of the jobs that are queued or running
+func (c *DiscoveryController) ActiveJobs() []models.DiscoveryJob {
+	c.jobsMutex.Lock()
+	defer c.jobsMutex.Unlock()
+
+	jobs := make([]models.DiscoveryJob, 0, len(c.jobs))
+	for _, job := range c.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// JobProgress returns counters describing the state of the job queue
+func (c *DiscoveryController) JobProgress() models.JobProgress {
+	if c.distributed() {
+		return c.distributedProgress()
+	}
+
+	c.jobsMutex.Lock()
+	running := 0
+	for _, job := range c.jobs {
+		if job.Status == models.JobStatusRunning {
+			running++
+		}
+	}
+	c.jobsMutex.Unlock()
+
+	workers := c.workerCount()
+	progress := models.JobProgress{
+		TotalJobs:     int(atomic.LoadInt32(&c.totalJobs)),
+		CompletedJobs: int(atomic.LoadInt32(&c.completedJobs)),
+		QueuedJobs:    len(c.jobQueue),
+		RunningJobs:   running,
+		Workers:       workers,
+	}
+	if c.resourceCtrl != nil {
+		status := c.resourceCtrl.Status()
+		progress.Throttle = &status
+	}
+	if c.limiter != nil {
+		status := c.limiter.Status()
+		progress.Limits = &status
+		progress.QueuedJobs += status.Deferred
+	}
+	return progress
+}
+
+// ConnectionPoolStats returns the usage counters of the WinRM connection pool
+func (c *DiscoveryController) ConnectionPoolStats() models.ConnectionPoolStats {
+	return c.connectionPool.Stats()
+}
+
+// workerCount returns the size of the worker pool
+func (c *DiscoveryController) workerCount() int {
+	if c.config.Concurrency > 0 {
+		return c.config.Concurrency
+	}
+	if c.config.Discovery.Concurrency > 0 {
+		return c.config.Discovery.Concurrency
+	}
+	return defaultConcurrency
+}
+
+// worker executes queued jobs until the queue is closed. While resource
+// usage is above the limits it leaves new jobs on the queue; once the
+// controller stops it drains the queue without waiting.
+func (c *DiscoveryController) worker() {
+	defer c.workerWG.Done()
+
+	for {
+		if c.resourceCtrl != nil {
+			c.resourceCtrl.waitForResources(c.ctx)
+		}
+		item, ok := c.nextJob()
+		if !ok {
+			return
+		}
+		c.runJob(item)
+	}
+}
+
+// nextJob returns the next job the dispatch limits allow to start. Jobs held
+// back by a limit are started first once they fit; queued jobs that do not
+// fit are held back in turn. After the queue is closed the held back jobs
+// are returned regardless, so that they are closed out.
+func (c *DiscoveryController) nextJob() (queuedJob, bool) {
+	if c.limiter == nil {
+		item, ok := <-c.jobQueue
+		return item, ok
+	}
+
+	for {
+		item, ok, wait := c.limiter.nextDeferred()
+		if ok {
+			return item, true
+		}
+		if wait != nil {
+			// Too many jobs are held back; leave the rest on the queue
+			<-wait
+			continue
+		}
+		item, ok = <-c.jobQueue
+		if !ok {
+			return c.limiter.drain()
+		}
+		if c.limiter.admit(item) {
+			return item, true
+		}
+		c.limiter.hold(item)
+	}
+}
+
+// runJob executes a single discovery job and hands the result to the collector
+func (c *DiscoveryController) runJob(item queuedJob) {
+	if c.limiter != nil {
+		defer c.limiter.release(item.job.ID)
+	}
+
+	c.jobsMutex.Lock()
+	_, active := c.jobs[item.job.ID]
+	stopping := c.stopped
+	if !active {
+		// Cancelled while waiting in the queue
+		c.jobsMutex.Unlock()
+		return
+	}
+	if stopping {
+		c.jobsMutex.Unlock()
+		c.finishJob(item.job.ID, models.JobStatusCancelled, nil, "controller stopped before job started")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.cancels[item.job.ID] = cancel
+	c.jobsMutex.Unlock()
+
+	defer func() {
+		cancel()
+		c.jobsMutex.Lock()
+		delete(c.cancels, item.job.ID)
+		c.jobsMutex.Unlock()
+	}()
+
+	startTime := time.Now()
+	c.updateJob(item.job.ID, func(job *models.DiscoveryJob) {
+		job.Status = models.JobStatusRunning
+		job.StartedAt = &startTime
+	})
+
+	// The server timeout bounds the whole job, including retries
+	ctx, cancelTimeout := c.withServerTimeout(ctx, item.server)
+	defer cancelTimeout()
+
+	c.resultChannel <- c.executeWithRetry(ctx, item.job.ID, item.server)
+}
+
+// collectResults stores finished discovery results and closes out their jobs
+func (c *DiscoveryController) collectResults() {
+	defer c.collectorWG.Done()
+
+	for result := range c.resultChannel {
+		errMsg := result.Error
+		status := jobStatusForResult(result)
+
+		// A result from the cache was stored when it was collected; storing
+		// it again would mark the server as just checked
+		var discoveryID *int
+		if result.Cached {
+			id := result.ID
+			discoveryID = &id
+		} else if id, err := c.StoreResultInDatabase(result); err != nil {
+			log.Printf("Error storing discovery result for job %s: %v", result.JobID, err)
+			status = models.JobStatusFailed
+			errMsg = err.Error()
+		} else {
+			discoveryID = &id
+			if result.Success {
+				c.storeCachedID(result, id)
+			}
+		}
+
+		c.finishJob(result.JobID, status, discoveryID, errMsg)
+		log.Printf("Discovery job %s for %s finished with status %s", result.JobID, result.Server, status)
+	}
+}
+
+// jobStatusForResult maps a discovery result onto the final job state
+func jobStatusForResult(result models.DiscoveryResult) string {
+	switch {
+	case result.Success:
+		return models.JobStatusSucceeded
+	case result.Status == "timeout":
+		return models.JobStatusTimeout
+	case result.Status == "cancelled":
+		return models.JobStatusCancelled
+	default:
+		return models.JobStatusFailed
+	}
+}
+
+// reportProgress periodically logs queue progress while jobs are outstanding
+func (c *DiscoveryController) reportProgress() {
+	defer c.progressTicker.Stop()
+
+	for {
+		select {
+		case <-c.progressTicker.C:
+			progress := c.JobProgress()
+			if progress.CompletedJobs < progress.TotalJobs {
+				throttled := ""
+				if progress.Limits != nil && progress.Limits.Deferred > 0 {
+					throttled = fmt.Sprintf(", %d held back by limits", progress.Limits.Deferred)
+				}
+				if progress.Throttle != nil && progress.Throttle.Throttled {
+					throttled += fmt.Sprintf(", paused: %v", progress.Throttle.Reasons)
+				}
+				log.Printf("Discovery progress: %d/%d jobs completed (%d queued, %d running%s)",
+					progress.CompletedJobs, progress.TotalJobs, progress.QueuedJobs, progress.RunningJobs, throttled)
+			}
+		case <-c.progressDone:
+			return
+		}
+	}
+}
+
+// updateJob applies a change to an active job and persists it
+func (c *DiscoveryController) updateJob(jobID string, update func(job *models.DiscoveryJob)) {
+	c.jobsMutex.Lock()
+	job, exists := c.jobs[jobID]
+	if !exists {
+		c.jobsMutex.Unlock()
+		return
+	}
+	update(job)
+	snapshot := *job
+	c.jobsMutex.Unlock()
+
+	if err := c.db.UpdateDiscoveryJob(snapshot); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// finishJob records the final state of an active job and removes it from the
+// in-memory job table
+func (c *DiscoveryController) finishJob(jobID, status string, discoveryID *int, errMsg string) {
+	now := time.Now()
+	c.updateJob(jobID, func(job *models.DiscoveryJob) {
+		job.Status = status
+		job.DiscoveryID = discoveryID
+		job.Error = errMsg
+		job.FinishedAt = &now
+	})
+
+	c.jobsMutex.Lock()
+	if _, exists := c.jobs[jobID]; exists {
+		delete(c.jobs, jobID)
+		atomic.AddInt32(&c.completedJobs, 1)
+	}
+	c.jobsMutex.Unlock()
+}
+
+// failJob closes out a job that never made it onto the queue
+func (c *DiscoveryController) failJob(job *models.DiscoveryJob, status, errMsg string) {
+	now := time.Now()
+	job.Status = status
+	job.Error = errMsg
+	job.FinishedAt = &now
+	if err := c.db.UpdateDiscoveryJob(*job); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// newJobID generates a random identifier for a discovery job
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("job-%d", time.Now().UnixNano())
+	}
+	return "job-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/discovery"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// blockingDiscoverer runs until its context is done
+type blockingDiscoverer struct{}
+
+func (blockingDiscoverer) ExecuteDiscovery(ctx context.Context, server models.ServerConfig, outputDir string) (models.DiscoveryResult, error) {
+	<-ctx.Done()
+	return models.DiscoveryResult{Status: "failed"}, ctx.Err()
+}
+
+func (blockingDiscoverer) ParseDiscoveryOutput(outputPath string) (models.ServerDetails, error) {
+	return models.ServerDetails{}, nil
+}
+
+// newTestController creates a controller without a database whose "blocking"
+// method runs blockingDiscoverer, counting the discoverers created in started
+func newTestController(t *testing.T, started *int32) *DiscoveryController {
+	c := NewDiscoveryController(&models.Config{CacheTTL: -1}, nil, nil)
+	err := c.discoverers.Register(discovery.Method{
+		Name:         "blocking",
+		Capabilities: discovery.Capabilities{Transport: "test"},
+		New: func(ctx context.Context, env discovery.Environment, server models.ServerConfig) (discovery.ServerDiscoverer, error) {
+			atomic.AddInt32(started, 1)
+			return blockingDiscoverer{}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestJobStatusForResult(t *testing.T) {
+	tests := []struct {
+		result models.DiscoveryResult
+		want   string
+	}{
+		{models.DiscoveryResult{Success: true, Status: "completed"}, models.JobStatusSucceeded},
+		{models.DiscoveryResult{Status: "failed"}, models.JobStatusFailed},
+		{models.DiscoveryResult{Status: "timeout"}, models.JobStatusTimeout},
+		{models.DiscoveryResult{Status: "cancelled"}, models.JobStatusCancelled},
+		{models.DiscoveryResult{}, models.JobStatusFailed},
+	}
+	for _, tt := range tests {
+		if got := jobStatusForResult(tt.result); got != tt.want {
+			t.Errorf("status %q (success %v): got %s, want %s", tt.result.Status, tt.result.Success, got, tt.want)
+		}
+	}
+}
+
+func TestExecuteWithRetryContextStatus(t *testing.T) {
+	var started int32
+	c := newTestController(t, &started)
+	server := models.ServerConfig{Host: "10.0.0.15", Method: "blocking", RetryCount: 3}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	result := c.executeWithRetry(ctx, "job-1", server)
+	if result.Status != "timeout" || jobStatusForResult(result) != models.JobStatusTimeout {
+		t.Errorf("timed out run: status %q, job status %s", result.Status, jobStatusForResult(result))
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	result = c.executeWithRetry(ctx, "job-2", server)
+	if result.Status != "cancelled" || jobStatusForResult(result) != models.JobStatusCancelled {
+		t.Errorf("cancelled run: status %q, job status %s", result.Status, jobStatusForResult(result))
+	}
+
+	// Neither run is retried
+	if n := atomic.LoadInt32(&started); n != 2 {
+		t.Errorf("%d discoveries started, want 2", n)
+	}
+}
+
+func TestRunJobSkipsCancelledJob(t *testing.T) {
+	var started int32
+	c := newTestController(t, &started)
+
+	// A job cancelled while queued is no longer in c.jobs
+	c.runJob(queuedJob{
+		job:    &models.DiscoveryJob{ID: "cancelled"},
+		server: models.ServerConfig{Host: "10.0.0.15", Method: "blocking"},
+	})
+	if n := atomic.LoadInt32(&started); n != 0 {
+		t.Errorf("cancelled job started %d discoveries", n)
+	}
+	if n := len(c.resultChannel); n != 0 {
+		t.Errorf("cancelled job produced %d results", n)
+	}
+}
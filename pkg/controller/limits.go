@@ -0,0 +1,362 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// limitSlot is what a running job counts against
+type limitSlot struct {
+	region string
+	subnet string
+}
+
+// DispatchLimiter caps the jobs running at once overall, per region and per
+// /24 subnet, and paces new connections with a token bucket. Jobs that would
+// exceed a concurrency limit are held back, without blocking the worker that
+// pulled them, until a job counted against the same limit finishes. Once
+// maxDeferred jobs are held back, no more jobs are taken off the job queue
+// until a running job finishes.
+type DispatchLimiter struct {
+	MaxConcurrent int
+	MaxPerRegion  int
+	RegionLimits  map[string]int
+	MaxPerSubnet  int
+	bucket        *tokenBucket
+
+	mu          sync.Mutex
+	running     map[string]limitSlot // By job ID
+	regions     map[string]int
+	subnets     map[string]int
+	deferred    []queuedJob
+	maxDeferred int
+	released    chan struct{} // Closed and replaced whenever a job is released
+}
+
+// NewDispatchLimiter creates a limiter for the limits in config, or returns
+// nil if no limit is set
+func NewDispatchLimiter(config models.LimitsConfig) *DispatchLimiter {
+	if config.MaxConcurrent <= 0 && config.MaxPerRegion <= 0 && len(config.RegionLimits) == 0 &&
+		config.MaxPerSubnet <= 0 && config.ConnectionsPerSecond <= 0 {
+		return nil
+	}
+	l := &DispatchLimiter{
+		MaxConcurrent: config.MaxConcurrent,
+		MaxPerRegion:  config.MaxPerRegion,
+		RegionLimits:  config.RegionLimits,
+		MaxPerSubnet:  config.MaxPerSubnet,
+		running:       make(map[string]limitSlot),
+		regions:       make(map[string]int),
+		subnets:       make(map[string]int),
+		maxDeferred:   jobQueueSize,
+		released:      make(chan struct{}),
+	}
+	if config.ConnectionsPerSecond > 0 {
+		l.bucket = newTokenBucket(config.ConnectionsPerSecond, config.ConnectionBurst)
+	}
+	return l
+}
+
+// regionLimit returns the concurrency limit of a region, or 0 if it has none
+func (l *DispatchLimiter) regionLimit(region string) int {
+	if region == "" {
+		return 0
+	}
+	if limit, ok := l.RegionLimits[region]; ok {
+		return limit
+	}
+	return l.MaxPerRegion
+}
+
+// admit counts a job against the limits and reports whether it may start.
+// Jobs that may not start are not counted.
+func (l *DispatchLimiter) admit(item queuedJob) bool {
+	slot := limitSlot{region: item.server.Region, subnet: subnetKey(item.server.Host)}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.admitLocked(item.job.ID, slot)
+}
+
+func (l *DispatchLimiter) admitLocked(jobID string, slot limitSlot) bool {
+	if l.MaxConcurrent > 0 && len(l.running) >= l.MaxConcurrent {
+		return false
+	}
+	if limit := l.regionLimit(slot.region); limit > 0 && l.regions[slot.region] >= limit {
+		return false
+	}
+	if l.MaxPerSubnet > 0 && slot.subnet != "" && l.subnets[slot.subnet] >= l.MaxPerSubnet {
+		return false
+	}
+
+	l.running[jobID] = slot
+	if slot.region != "" {
+		l.regions[slot.region]++
+	}
+	if slot.subnet != "" {
+		l.subnets[slot.subnet]++
+	}
+	return true
+}
+
+// allowsLease reports whether a coordinator may lease a job to a worker
+// without exceeding the concurrency limits, given the jobs already leased to
+// or running on any worker. The connection rate is paced separately, by
+// takeLease.
+func (l *DispatchLimiter) allowsLease(job models.DiscoveryJob, active []models.DiscoveryJob) bool {
+	if l.MaxConcurrent > 0 && len(active) >= l.MaxConcurrent {
+		return false
+	}
+
+	subnet := subnetKey(job.Host)
+	var inRegion, inSubnet int
+	for _, other := range active {
+		if job.Region != "" && other.Region == job.Region {
+			inRegion++
+		}
+		if subnet != "" && subnetKey(other.Host) == subnet {
+			inSubnet++
+		}
+	}
+	if limit := l.regionLimit(job.Region); limit > 0 && inRegion >= limit {
+		return false
+	}
+	return l.MaxPerSubnet <= 0 || subnet == "" || inSubnet < l.MaxPerSubnet
+}
+
+// takeLease reports whether the connection rate allows a coordinator to
+// lease another job now, taking a token for it if so. Leases rather than
+// connections are paced in distributed mode, so that the rate holds across
+// every worker.
+func (l *DispatchLimiter) takeLease() bool {
+	return l.bucket == nil || l.bucket.take()
+}
+
+// leaseStatus returns the limits along with the jobs leased to or running on
+// any worker counted against them
+func (l *DispatchLimiter) leaseStatus(active []models.DiscoveryJob) models.LimitStatus {
+	status := models.LimitStatus{
+		MaxConcurrent: l.MaxConcurrent,
+		MaxPerRegion:  l.MaxPerRegion,
+		RegionLimits:  l.RegionLimits,
+		MaxPerSubnet:  l.MaxPerSubnet,
+		Running:       len(active),
+		Regions:       make(map[string]int),
+		Subnets:       make(map[string]int),
+	}
+	for _, job := range active {
+		if job.Region != "" {
+			status.Regions[job.Region]++
+		}
+		if subnet := subnetKey(job.Host); subnet != "" {
+			status.Subnets[subnet]++
+		}
+	}
+	if l.bucket != nil {
+		status.ConnectionsPerSecond = l.bucket.rate
+		tokens := l.bucket.available()
+		status.TokensAvailable = &tokens
+	}
+	return status
+}
+
+// release stops counting a job against the limits. Jobs that were never
+// admitted are ignored.
+func (l *DispatchLimiter) release(jobID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slot, ok := l.running[jobID]
+	if !ok {
+		return
+	}
+	delete(l.running, jobID)
+	close(l.released)
+	l.released = make(chan struct{})
+	if slot.region != "" {
+		if l.regions[slot.region]--; l.regions[slot.region] <= 0 {
+			delete(l.regions, slot.region)
+		}
+	}
+	if slot.subnet != "" {
+		if l.subnets[slot.subnet]--; l.subnets[slot.subnet] <= 0 {
+			delete(l.subnets, slot.subnet)
+		}
+	}
+}
+
+// hold keeps a job that may not start yet until nextDeferred admits it
+func (l *DispatchLimiter) hold(item queuedJob) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deferred = append(l.deferred, item)
+}
+
+// nextDeferred admits and returns the oldest held back job that the limits
+// now allow to start. If there is none and no more jobs can be held back, it
+// also returns a channel that is closed once a running job is released;
+// until then no job should be taken off the queue.
+func (l *DispatchLimiter) nextDeferred() (queuedJob, bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, item := range l.deferred {
+		slot := limitSlot{region: item.server.Region, subnet: subnetKey(item.server.Host)}
+		if l.admitLocked(item.job.ID, slot) {
+			l.deferred = append(l.deferred[:i], l.deferred[i+1:]...)
+			return item, true, nil
+		}
+	}
+	if len(l.deferred) >= l.maxDeferred {
+		return queuedJob{}, false, l.released
+	}
+	return queuedJob{}, false, nil
+}
+
+// drain returns a held back job without admitting it, so that it can be
+// closed out once the controller stops
+func (l *DispatchLimiter) drain() (queuedJob, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.deferred) == 0 {
+		return queuedJob{}, false
+	}
+	item := l.deferred[0]
+	l.deferred = l.deferred[1:]
+	return item, true
+}
+
+// waitForConnection blocks until the connection rate allows a new
+// connection. It returns early with ctx's error when ctx is done.
+func (l *DispatchLimiter) waitForConnection(ctx context.Context) error {
+	if l.bucket == nil {
+		return nil
+	}
+	delay := l.bucket.reserve()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the limits along with the jobs counted against them
+func (l *DispatchLimiter) Status() models.LimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := models.LimitStatus{
+		MaxConcurrent: l.MaxConcurrent,
+		MaxPerRegion:  l.MaxPerRegion,
+		RegionLimits:  l.RegionLimits,
+		MaxPerSubnet:  l.MaxPerSubnet,
+		Running:       len(l.running),
+		Regions:       make(map[string]int, len(l.regions)),
+		Subnets:       make(map[string]int, len(l.subnets)),
+		Deferred:      len(l.deferred),
+	}
+	for region, n := range l.regions {
+		status.Regions[region] = n
+	}
+	for subnet, n := range l.subnets {
+		status.Subnets[subnet] = n
+	}
+	if l.bucket != nil {
+		status.ConnectionsPerSecond = l.bucket.rate
+		tokens := l.bucket.available()
+		status.TokensAvailable = &tokens
+	}
+	return status
+}
+
+// subnetKey returns the /24 containing host, or "" if host is not an IPv4
+// address
+func subnetKey(host string) string {
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		return ""
+	}
+	mask := net.CIDRMask(24, 32)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+// tokenBucket allows rate events per second on average with bursts of up to
+// burst events
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// newTokenBucket creates a full bucket. burst defaults to 1.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now(), now: time.Now}
+}
+
+// refill adds the tokens accrued since the last call. Callers hold mu.
+func (b *tokenBucket) refill() {
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// reserve takes a token and returns how long the caller must wait before
+// using it. Tokens are taken in order, so waiting callers are served first
+// come first served.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// take takes a token if one is available without waiting
+func (b *tokenBucket) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// available returns the tokens that can be taken without waiting
+func (b *tokenBucket) available() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.tokens < 0 {
+		return 0
+	}
+	return b.tokens
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func limitedJob(id, region, host string) queuedJob {
+	return queuedJob{
+		job:    &models.DiscoveryJob{ID: id},
+		server: models.ServerConfig{Region: region, Host: host},
+	}
+}
+
+func TestDispatchLimiter(t *testing.T) {
+	if l := NewDispatchLimiter(models.LimitsConfig{}); l != nil {
+		t.Fatal("expected no limiter without limits")
+	}
+
+	l := NewDispatchLimiter(models.LimitsConfig{
+		MaxConcurrent: 4,
+		MaxPerRegion:  2,
+		RegionLimits:  map[string]int{"apac": 1},
+		MaxPerSubnet:  1,
+	})
+
+	admitted := []queuedJob{
+		limitedJob("east-1", "us-east", "10.0.1.5"),
+		limitedJob("east-2", "us-east", "10.0.2.5"),
+		limitedJob("apac-1", "apac", "10.8.0.5"),
+	}
+	for _, item := range admitted {
+		if !l.admit(item) {
+			t.Fatalf("job %s was held back", item.job.ID)
+		}
+	}
+
+	held := []queuedJob{
+		limitedJob("east-3", "us-east", "10.0.3.5"),   // region limit
+		limitedJob("apac-2", "apac", "10.8.1.5"),      // region override
+		limitedJob("subnet", "us-west", "10.0.1.200"), // same /24 as east-1
+	}
+	for _, item := range held {
+		if l.admit(item) {
+			t.Fatalf("job %s was admitted past its limit", item.job.ID)
+		}
+		l.hold(item)
+	}
+
+	if !l.admit(limitedJob("west-1", "us-west", "web01")) {
+		t.Fatal("job without an IPv4 address was held back")
+	}
+	if l.admit(limitedJob("west-2", "us-west", "10.9.0.5")) {
+		t.Fatal("job admitted past the global limit")
+	}
+
+	status := l.Status()
+	if status.Running != 4 || status.Deferred != 3 || status.Regions["us-east"] != 2 || status.Subnets["10.0.1.0/24"] != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	if _, ok, wait := l.nextDeferred(); ok || wait != nil {
+		t.Fatal("held back job started while every limit is reached")
+	}
+	l.release("east-1")
+	item, ok, _ := l.nextDeferred()
+	if !ok || item.job.ID != "east-3" {
+		t.Fatalf("got %+v, want the oldest held back job that fits", item.job)
+	}
+	if _, ok, _ := l.nextDeferred(); ok {
+		t.Fatal("second held back job started past the global limit")
+	}
+	if n := l.Status().Deferred; n != 2 {
+		t.Errorf("%d jobs held back, want 2", n)
+	}
+
+	// With the held back jobs at their cap, no more are taken off the queue
+	// until a running job finishes
+	l.maxDeferred = 2
+	_, ok, wait := l.nextDeferred()
+	if ok || wait == nil {
+		t.Fatal("no wait for a running job with the held back jobs at their cap")
+	}
+	l.release("east-3")
+	select {
+	case <-wait:
+	default:
+		t.Fatal("wait did not end when a job finished")
+	}
+}
+
+func TestDispatchLimiterLeases(t *testing.T) {
+	l := NewDispatchLimiter(models.LimitsConfig{MaxConcurrent: 4, MaxPerRegion: 2, MaxPerSubnet: 1})
+	// Jobs running on two different workers count against the same limits
+	active := []models.DiscoveryJob{
+		{ID: "east-1", Region: "us-east", Host: "10.0.1.5", WorkerID: "worker-1"},
+		{ID: "east-2", Region: "us-east", Host: "10.0.2.5", WorkerID: "worker-2"},
+	}
+
+	for _, job := range []models.DiscoveryJob{
+		{ID: "east-3", Region: "us-east", Host: "10.0.3.5"},
+		{ID: "subnet", Region: "us-west", Host: "10.0.1.200"},
+	} {
+		if l.allowsLease(job, active) {
+			t.Errorf("job %s leased past its limit", job.ID)
+		}
+	}
+	if !l.allowsLease(models.DiscoveryJob{ID: "west-1", Region: "us-west", Host: "10.0.9.5"}, active) {
+		t.Error("job within the limits was left queued")
+	}
+
+	active = append(active, models.DiscoveryJob{ID: "west-1"}, models.DiscoveryJob{ID: "west-2"})
+	if l.allowsLease(models.DiscoveryJob{ID: "apac-1", Region: "apac"}, active) {
+		t.Error("job leased past the global limit")
+	}
+}
+
+func TestDispatchLimiterLeaseStatus(t *testing.T) {
+	l := NewDispatchLimiter(models.LimitsConfig{MaxPerRegion: 2, ConnectionsPerSecond: 5, ConnectionBurst: 3})
+	active := []models.DiscoveryJob{
+		{ID: "east-1", Region: "us-east", Host: "10.0.1.5", WorkerID: "worker-1"},
+		{ID: "east-2", Region: "us-east", Host: "10.0.1.6", WorkerID: "worker-2"},
+		{ID: "west-1", Region: "us-west", Host: "db01", WorkerID: "worker-2"},
+	}
+
+	status := l.leaseStatus(active)
+	if status.Running != 3 || status.Regions["us-east"] != 2 || status.Regions["us-west"] != 1 || status.Subnets["10.0.1.0/24"] != 2 {
+		t.Errorf("unexpected lease status %+v", status)
+	}
+	if status.ConnectionsPerSecond != 5 || status.TokensAvailable == nil || *status.TokensAvailable != 3 {
+		t.Errorf("connection rate %.1f with %v tokens, want 5 with 3", status.ConnectionsPerSecond, status.TokensAvailable)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(2, 2)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	for i := 0; i < 2; i++ {
+		if d := b.reserve(); d != 0 {
+			t.Fatalf("burst connection %d waited %s", i, d)
+		}
+	}
+	if d := b.reserve(); d != 500*time.Millisecond {
+		t.Errorf("third connection waits %s, want 500ms", d)
+	}
+	if d := b.reserve(); d != time.Second {
+		t.Errorf("fourth connection waits %s, want 1s", d)
+	}
+
+	now = now.Add(3 * time.Second)
+	if got := b.available(); got != 2 {
+		t.Errorf("%.1f tokens after refilling, want the burst of 2", got)
+	}
+}
+
+func TestTokenBucketTake(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(2, 2)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	if !b.take() || !b.take() {
+		t.Fatal("burst was not taken")
+	}
+	if b.take() {
+		t.Error("took a token from an empty bucket")
+	}
+	now = now.Add(500 * time.Millisecond)
+	if !b.take() {
+		t.Error("no token after refilling for 500ms")
+	}
+}
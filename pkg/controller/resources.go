@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/mem"
+	"github.com/shirou/gopsutil/process"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// defaultResourceCheckInterval is how often resource usage is sampled when
+// ResourceConfig.CheckIntervalSeconds is unset
+const defaultResourceCheckInterval = 5 * time.Second
+
+// resourceUsage is one sample of local resource usage
+type resourceUsage struct {
+	cpuPercent    float64
+	memoryPercent float64
+	openFiles     int
+}
+
+// ResourceController pauses the job dispatcher while local CPU, memory or
+// open file descriptors exceed their limits. Usage is sampled in the
+// background so that waiting workers do not each measure it.
+type ResourceController struct {
+	CPUThreshold    float64
+	MemoryThreshold float64
+	OpenFilesLimit  int
+	checkInterval   time.Duration
+	sample          func() (resourceUsage, error)
+
+	mu       sync.Mutex
+	status   models.ThrottleStatus
+	released chan struct{} // Closed when the dispatcher may pull work again
+}
+
+// NewResourceController creates a controller for the limits in config, or
+// returns nil if no limit is set
+func NewResourceController(config models.ResourceConfig) *ResourceController {
+	if config.MaxCPUPercent <= 0 && config.MaxMemoryPercent <= 0 && config.MaxOpenFiles <= 0 {
+		return nil
+	}
+	interval := time.Duration(config.CheckIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultResourceCheckInterval
+	}
+	rc := &ResourceController{
+		CPUThreshold:    config.MaxCPUPercent,
+		MemoryThreshold: config.MaxMemoryPercent,
+		OpenFilesLimit:  config.MaxOpenFiles,
+		checkInterval:   interval,
+		released:        make(chan struct{}),
+	}
+	rc.sample = rc.sampleUsage
+	close(rc.released)
+	return rc
+}
+
+// Run samples resource usage every check interval until ctx is done
+func (rc *ResourceController) Run(ctx context.Context) {
+	ticker := time.NewTicker(rc.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		rc.check()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check samples resource usage and updates the throttling state
+func (rc *ResourceController) check() {
+	usage, err := rc.sample()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	var reasons []string
+	if rc.CPUThreshold > 0 && usage.cpuPercent > rc.CPUThreshold {
+		reasons = append(reasons, fmt.Sprintf("CPU %.1f%% above %.1f%%", usage.cpuPercent, rc.CPUThreshold))
+	}
+	if rc.MemoryThreshold > 0 && usage.memoryPercent > rc.MemoryThreshold {
+		reasons = append(reasons, fmt.Sprintf("memory %.1f%% above %.1f%%", usage.memoryPercent, rc.MemoryThreshold))
+	}
+	if rc.OpenFilesLimit > 0 && usage.openFiles > rc.OpenFilesLimit {
+		reasons = append(reasons, fmt.Sprintf("%d open files above %d", usage.openFiles, rc.OpenFilesLimit))
+	}
+
+	now := time.Now()
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	wasThrottled := rc.status.Throttled
+	rc.status.Throttled = len(reasons) > 0
+	rc.status.Reasons = reasons
+	rc.status.CPUPercent = usage.cpuPercent
+	rc.status.MemoryPercent = usage.memoryPercent
+	rc.status.OpenFiles = usage.openFiles
+	rc.status.CheckedAt = now
+
+	switch {
+	case rc.status.Throttled && !wasThrottled:
+		rc.status.Since = &now
+		rc.released = make(chan struct{})
+		log.Printf("Pausing discovery dispatch: %v", reasons)
+	case !rc.status.Throttled && wasThrottled:
+		log.Printf("Resuming discovery dispatch after %s", now.Sub(*rc.status.Since).Round(time.Second))
+		rc.status.Since = nil
+		close(rc.released)
+	}
+}
+
+// waitForResources blocks while usage is above the limits. It returns early
+// with ctx's error when ctx is done.
+func (rc *ResourceController) waitForResources(ctx context.Context) error {
+	rc.mu.Lock()
+	released := rc.released
+	rc.mu.Unlock()
+
+	select {
+	case <-released:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the current throttling state
+func (rc *ResourceController) Status() models.ThrottleStatus {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	status := rc.status
+	status.Reasons = append([]string(nil), rc.status.Reasons...)
+	return status
+}
+
+// sampleUsage measures the CPU and memory usage of the host and the file
+// descriptors open in this process. Only the limits that are set are
+// measured; a failed measurement is reported as zero.
+func (rc *ResourceController) sampleUsage() (resourceUsage, error) {
+	var usage resourceUsage
+	var errs []error
+
+	if rc.CPUThreshold > 0 {
+		percentages, err := cpu.Percent(time.Second, false)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("failed to get CPU usage: %w", err))
+		case len(percentages) > 0:
+			usage.cpuPercent = percentages[0]
+		}
+	}
+	if rc.MemoryThreshold > 0 {
+		if vmStat, err := mem.VirtualMemory(); err == nil {
+			usage.memoryPercent = vmStat.UsedPercent
+		} else {
+			errs = append(errs, fmt.Errorf("failed to get memory usage: %w", err))
+		}
+	}
+	if rc.OpenFilesLimit > 0 {
+		proc, err := process.NewProcess(int32(os.Getpid()))
+		if err == nil {
+			var fds int32
+			if fds, err = proc.NumFDs(); err == nil {
+				usage.openFiles = int(fds)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to count open files: %w", err))
+		}
+	}
+
+	return usage, errors.Join(errs...)
+}
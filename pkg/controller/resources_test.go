@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestResourceControllerThrottles(t *testing.T) {
+	if rc := NewResourceController(models.ResourceConfig{}); rc != nil {
+		t.Fatal("expected no resource controller without limits")
+	}
+
+	rc := NewResourceController(models.ResourceConfig{MaxCPUPercent: 80, MaxOpenFiles: 100})
+	usage := resourceUsage{cpuPercent: 50, openFiles: 10}
+	rc.sample = func() (resourceUsage, error) { return usage, nil }
+
+	rc.check()
+	if err := rc.waitForResources(context.Background()); err != nil || rc.Status().Throttled {
+		t.Fatalf("throttled below the limits: %+v", rc.Status())
+	}
+
+	usage = resourceUsage{cpuPercent: 95, openFiles: 150}
+	rc.check()
+	status := rc.Status()
+	if !status.Throttled || len(status.Reasons) != 2 || status.Since == nil || status.OpenFiles != 150 {
+		t.Fatalf("got %+v, want throttling on CPU and open files", status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := rc.waitForResources(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("waitForResources returned %v while throttled", err)
+	}
+
+	released := make(chan error)
+	go func() { released <- rc.waitForResources(context.Background()) }()
+	usage = resourceUsage{cpuPercent: 40, openFiles: 20}
+	rc.check()
+	select {
+	case err := <-released:
+		if err != nil {
+			t.Errorf("waitForResources returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting worker was not released")
+	}
+	if status := rc.Status(); status.Throttled || status.Since != nil {
+		t.Errorf("still throttled: %+v", status)
+	}
+}
+
+func TestJobProgressReportsThrottle(t *testing.T) {
+	c := NewDiscoveryController(&models.Config{}, nil, nil)
+	if c.JobProgress().Throttle != nil {
+		t.Error("throttle status reported without resource limits")
+	}
+
+	c = NewDiscoveryController(&models.Config{Resources: models.ResourceConfig{MaxMemoryPercent: 90}}, nil, nil)
+	c.resourceCtrl.sample = func() (resourceUsage, error) { return resourceUsage{memoryPercent: 95}, nil }
+	c.resourceCtrl.check()
+	if progress := c.JobProgress(); progress.Throttle == nil || !progress.Throttle.Throttled {
+		t.Errorf("got %+v, want a throttled dispatcher", progress.Throttle)
+	}
+}
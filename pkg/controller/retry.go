@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+	sshtransport "github.com/vobbilis/codegen/server-discovery/pkg/transport/ssh"
+)
+
+const (
+	defaultRetryDelay    = 5 * time.Second
+	defaultMaxRetryDelay = 2 * time.Minute
+)
+
+// winrmHTTPStatus extracts the status code from WinRM transport errors such
+// as "http error 503: ..." or "http response error: 401 - invalid content type"
+var winrmHTTPStatus = regexp.MustCompile(`http (?:response )?error:? (\d{3})`)
+
+// Error fragments that indicate the host rejected our credentials
+var authErrorMessages = []string{
+	"unable to authenticate",
+	"authentication failed",
+	"access is denied",
+	"logon failure",
+	"permission denied",
+	"invalid credentials",
+	"kdc_err_preauth_failed",
+	"kdc_err_c_principal_unknown",
+}
+
+// Error fragments that indicate a transient network problem
+var transientErrorMessages = []string{
+	"i/o timeout",
+	"connection refused",
+	"connection reset",
+	"no route to host",
+	"network is unreachable",
+	"broken pipe",
+	"tls handshake timeout",
+	"unexpected eof",
+}
+
+// retryPolicy describes how often and how quickly a discovery is retried
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// retryPolicyFor builds the retry policy for a server. A positive
+// ServerConfig.RetryCount overrides the global discovery.retryCount and a
+// negative one disables retries for that server.
+func (c *DiscoveryController) retryPolicyFor(server models.ServerConfig) retryPolicy {
+	retries := c.config.Discovery.RetryCount
+	if server.RetryCount != 0 {
+		retries = server.RetryCount
+	}
+	if retries < 0 {
+		retries = 0
+	}
+
+	policy := retryPolicy{
+		maxAttempts: retries + 1,
+		baseDelay:   c.config.Discovery.RetryDelay,
+		maxDelay:    c.config.Discovery.MaxRetryDelay,
+	}
+	if policy.baseDelay <= 0 {
+		policy.baseDelay = defaultRetryDelay
+	}
+	if policy.maxDelay <= 0 {
+		policy.maxDelay = defaultMaxRetryDelay
+	}
+	return policy
+}
+
+// backoff returns the delay before the attempt following the given one. The
+// delay doubles with every attempt up to maxDelay, and half of it is jittered
+// so that hosts failing together do not retry in lockstep.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.baseDelay
+	for i := 1; i < attempt && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// executeWithRetry runs discovery for a job, retrying transient failures with
+// exponential backoff. Every attempt that is retried is stored in the
+// discovery history; the final attempt is returned for the collector to store.
+func (c *DiscoveryController) executeWithRetry(ctx context.Context, jobID string, server models.ServerConfig) models.DiscoveryResult {
+	policy := c.retryPolicyFor(server)
+
+	for attempt := 1; ; attempt++ {
+		c.updateJob(jobID, func(job *models.DiscoveryJob) {
+			job.Attempts = attempt
+		})
+
+		startTime := time.Now()
+		result, err := c.executeDiscovery(ctx, server)
+		completeResult(&result, jobID, server, startTime, attempt)
+
+		if result.Success || attempt >= policy.maxAttempts || ctx.Err() != nil || !isRetryableError(err) {
+			return result
+		}
+
+		delay := policy.backoff(attempt)
+		log.Printf("Discovery attempt %d/%d for %s failed (%v), retrying in %s",
+			attempt, policy.maxAttempts, server.Host, err, delay.Round(time.Millisecond))
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			result.Status = contextStatus(ctx.Err())
+			result.Error = fmt.Sprintf("%s; interrupted while waiting to retry: %v", result.Error, ctx.Err())
+			result.EndTime = time.Now()
+			return result
+		}
+
+		result.Message = fmt.Sprintf("Attempt %d of %d failed, retried after %s",
+			attempt, policy.maxAttempts, delay.Round(time.Millisecond))
+		if _, err := c.StoreResultInDatabase(result); err != nil {
+			log.Printf("Warning: failed to record discovery attempt %d for job %s: %v", attempt, jobID, err)
+		}
+	}
+}
+
+// completeResult fills in the job bookkeeping fields of a discovery result
+func completeResult(result *models.DiscoveryResult, jobID string, server models.ServerConfig, startTime time.Time, attempt int) {
+	result.JobID = jobID
+	result.ServerID = server.ID
+	result.Server = server.Host
+	result.Region = server.Region
+	result.Method = server.Method
+	result.Attempt = attempt
+	if result.StartTime.IsZero() {
+		result.StartTime = startTime
+	}
+	result.EndTime = time.Now()
+	result.Success = result.Status == "completed"
+	if result.Status == "" {
+		result.Status = "failed"
+	}
+}
+
+// isRetryableError reports whether a discovery error is likely to be
+// transient. Authentication failures, host key mismatches and cancellations
+// are never retried.
+func isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if sshtransport.IsHostKeyMismatch(err) {
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range authErrorMessages {
+		if strings.Contains(msg, fragment) {
+			return false
+		}
+	}
+
+	if m := winrmHTTPStatus.FindStringSubmatch(msg); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return code >= 500
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	for _, fragment := range transientErrorMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
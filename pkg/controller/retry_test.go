@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+	sshtransport "github.com/vobbilis/codegen/server-discovery/pkg/transport/ssh"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"cancelled", context.Canceled, false},
+		{"deadline", fmt.Errorf("run: %w", context.DeadlineExceeded), false},
+		{"dial timeout", &net.OpError{Op: "dial", Err: timeoutError{}}, true},
+		{"connection refused", errors.New("failed to connect to SSH server: dial tcp 10.0.0.1:22: connect: connection refused"), true},
+		{"winrm 503", errors.New("http error 503: service unavailable"), true},
+		{"winrm 401", errors.New("http response error: 401 - invalid content type"), false},
+		{"ssh auth", errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]"), false},
+		{"script failure", errors.New("discovery script exited with code 1"), false},
+		{"host key mismatch", fmt.Errorf("ssh: handshake failed: %w", &sshtransport.HostKeyMismatchError{Host: "db01", Fingerprint: "SHA256:new", Known: []string{"SHA256:old"}}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableError(tt.err); got != tt.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 5, baseDelay: time.Second, maxDelay: 5 * time.Second}
+
+	for attempt, ceiling := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		for i := 0; i < 20; i++ {
+			delay := policy.backoff(attempt)
+			if delay < ceiling/2 || delay > ceiling {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", attempt, delay, ceiling/2, ceiling)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyFor(t *testing.T) {
+	c := &DiscoveryController{config: models.Config{
+		Discovery: models.DiscoveryConfig{RetryCount: 3, RetryDelay: 2 * time.Second},
+	}}
+
+	if got := c.retryPolicyFor(models.ServerConfig{}); got.maxAttempts != 4 || got.baseDelay != 2*time.Second {
+		t.Errorf("global policy = %+v, want 4 attempts with 2s base delay", got)
+	}
+	if got := c.retryPolicyFor(models.ServerConfig{RetryCount: 1}); got.maxAttempts != 2 {
+		t.Errorf("server override = %d attempts, want 2", got.maxAttempts)
+	}
+	if got := c.retryPolicyFor(models.ServerConfig{RetryCount: -1}); got.maxAttempts != 1 {
+		t.Errorf("disabled retries = %d attempts, want 1", got.maxAttempts)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/masterzen/winrm"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// WinRM authentication transports, see models.ServerConfig.WinRMAuth
+const (
+	WinRMAuthBasic       = "basic"
+	WinRMAuthNTLM        = "ntlm"
+	WinRMAuthKerberos    = "kerberos"
+	WinRMAuthCertificate = "certificate"
+)
+
+const (
+	winrmTimeout     = 30 * time.Second
+	defaultKrbConfig = "/etc/krb5.conf"
+	kinitTimeout     = 30 * time.Second
+)
+
+// getClient creates a new WinRM client using the server's auth transport
+func getClient(server models.ServerConfig) (*winrm.Client, error) {
+	var caCert, cert, key []byte
+	var err error
+	if server.WinRMCACert != "" {
+		if caCert, err = os.ReadFile(server.WinRMCACert); err != nil {
+			return nil, fmt.Errorf("unable to read WinRM CA bundle: %w", err)
+		}
+	}
+
+	auth := server.WinRMAuth
+	if auth == "" {
+		auth = WinRMAuthBasic
+	}
+	if auth == WinRMAuthCertificate {
+		if !server.WinRMHTTPS {
+			return nil, fmt.Errorf("WinRM certificate authentication requires HTTPS")
+		}
+		if server.WinRMCert == "" || server.WinRMKey == "" {
+			return nil, fmt.Errorf("WinRM certificate authentication requires winrm_cert and winrm_key")
+		}
+		if cert, err = os.ReadFile(server.WinRMCert); err != nil {
+			return nil, fmt.Errorf("unable to read WinRM client certificate: %w", err)
+		}
+		if key, err = os.ReadFile(server.WinRMKey); err != nil {
+			return nil, fmt.Errorf("unable to read WinRM client key: %w", err)
+		}
+	}
+
+	endpoint := winrm.NewEndpoint(
+		server.Host,
+		server.WinRMPort,
+		server.WinRMHTTPS,
+		server.WinRMInsecure,
+		caCert,
+		cert,
+		key,
+		winrmTimeout,
+	)
+
+	// Copy the defaults rather than decorating the shared DefaultParameters
+	params := *winrm.DefaultParameters
+	username, password := server.Username, server.Password
+
+	switch auth {
+	case WinRMAuthBasic:
+		return winrm.NewClient(endpoint, username, password)
+	case WinRMAuthNTLM:
+		params.TransportDecorator = func() winrm.Transporter { return &winrm.ClientNTLM{} }
+	case WinRMAuthCertificate:
+		params.TransportDecorator = func() winrm.Transporter { return &winrm.ClientAuthRequest{} }
+		username, password = "", ""
+	case WinRMAuthKerberos:
+		settings, err := kerberosSettings(server)
+		if err != nil {
+			return nil, err
+		}
+		params.TransportDecorator = func() winrm.Transporter { return winrm.NewClientKerberos(settings) }
+	default:
+		return nil, fmt.Errorf("unknown WinRM auth %q", server.WinRMAuth)
+	}
+
+	return winrm.NewClientWithParameters(endpoint, username, password, &params)
+}
+
+// kerberosSettings builds the Kerberos transport settings for a server. With
+// a keytab, a ticket is obtained into a private credential cache first since
+// the transport only accepts a password or a credential cache.
+func kerberosSettings(server models.ServerConfig) (*winrm.Settings, error) {
+	username, realm := splitPrincipal(server.Username)
+	if server.KrbRealm != "" {
+		realm = server.KrbRealm
+	}
+	if username == "" || realm == "" {
+		return nil, fmt.Errorf("Kerberos authentication requires a user@REALM username or krb_realm")
+	}
+
+	krbConfig := server.KrbConfig
+	if krbConfig == "" {
+		krbConfig = defaultKrbConfig
+	}
+	spn := server.KrbSPN
+	if spn == "" {
+		spn = "HTTP/" + server.Host
+	}
+	proto := "http"
+	if server.WinRMHTTPS {
+		proto = "https"
+	}
+
+	settings := &winrm.Settings{
+		WinRMUsername: username,
+		WinRMPassword: server.Password,
+		WinRMHost:     server.Host,
+		WinRMPort:     server.WinRMPort,
+		WinRMProto:    proto,
+		WinRMInsecure: server.WinRMInsecure,
+		KrbRealm:      realm,
+		KrbConfig:     krbConfig,
+		KrbSpn:        spn,
+	}
+
+	if server.KrbKeytab != "" {
+		ccache, err := keytabCCache(username+"@"+realm, server.KrbKeytab, krbConfig)
+		if err != nil {
+			return nil, err
+		}
+		settings.KrbCCache = ccache
+		settings.WinRMPassword = ""
+	} else if server.Password == "" {
+		return nil, fmt.Errorf("Kerberos authentication requires a password or krb_keytab")
+	}
+
+	return settings, nil
+}
+
+// ccacheDir is the private directory holding the credential caches written
+// by kinit, created on first use
+var ccacheDir struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// privateCCacheDir returns a directory only this user can read, so that
+// other users of the host cannot pick up or plant Kerberos tickets
+func privateCCacheDir() (string, error) {
+	ccacheDir.once.Do(func() {
+		ccacheDir.path, ccacheDir.err = os.MkdirTemp("", "server-discovery-krb5-")
+		if ccacheDir.err != nil {
+			ccacheDir.err = fmt.Errorf("failed to create Kerberos credential cache directory: %w", ccacheDir.err)
+		}
+	})
+	return ccacheDir.path, ccacheDir.err
+}
+
+// keytabCCache runs kinit to obtain a ticket for principal from keytab and
+// returns the path of the credential cache holding it. Each principal and
+// keytab pair has its own cache, which later calls refresh.
+func keytabCCache(principal, keytab, krbConfig string) (string, error) {
+	dir, err := privateCCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(principal + "\x00" + keytab))
+	ccache := filepath.Join(dir, "krb5cc-"+hex.EncodeToString(sum[:8]))
+
+	ctx, cancel := context.WithTimeout(context.Background(), kinitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "kinit", "-k", "-t", keytab, "-c", "FILE:"+ccache, principal)
+	cmd.Env = append(os.Environ(), "KRB5_CONFIG="+krbConfig)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("kinit for %s failed: %v: %s", principal, err, strings.TrimSpace(string(out)))
+	}
+	return ccache, nil
+}
+
+// splitPrincipal splits user@REALM into the user and the upper-case realm
+func splitPrincipal(username string) (string, string) {
+	if i := strings.LastIndex(username, "@"); i >= 0 {
+		return username[:i], strings.ToUpper(username[i+1:])
+	}
+	return username, ""
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"os"
+	"testing"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestGetClientValidatesAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		server models.ServerConfig
+	}{
+		{"unknown auth", models.ServerConfig{Host: "win01", WinRMAuth: "digest"}},
+		{"certificate over HTTP", models.ServerConfig{Host: "win01", WinRMAuth: WinRMAuthCertificate, WinRMCert: "c.pem", WinRMKey: "k.pem"}},
+		{"certificate without key", models.ServerConfig{Host: "win01", WinRMAuth: WinRMAuthCertificate, WinRMHTTPS: true, WinRMCert: "c.pem"}},
+		{"kerberos without realm", models.ServerConfig{Host: "win01", WinRMAuth: WinRMAuthKerberos, Username: "svc", Password: "x"}},
+		{"kerberos without secret", models.ServerConfig{Host: "win01", WinRMAuth: WinRMAuthKerberos, Username: "svc@corp.example.com"}},
+		{"missing CA bundle", models.ServerConfig{Host: "win01", WinRMHTTPS: true, WinRMCACert: "/nonexistent/ca.pem"}},
+	}
+	for _, tt := range tests {
+		if _, err := getClient(tt.server); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestKerberosSettings(t *testing.T) {
+	settings, err := kerberosSettings(models.ServerConfig{
+		Host:       "win01.corp.example.com",
+		WinRMPort:  5986,
+		WinRMHTTPS: true,
+		Username:   "svc-discovery@corp.example.com",
+		Password:   "secret",
+	})
+	if err != nil {
+		t.Fatalf("kerberosSettings returned error: %v", err)
+	}
+	if settings.WinRMUsername != "svc-discovery" || settings.KrbRealm != "CORP.EXAMPLE.COM" {
+		t.Errorf("unexpected principal %s@%s", settings.WinRMUsername, settings.KrbRealm)
+	}
+	if settings.KrbSpn != "HTTP/win01.corp.example.com" || settings.KrbConfig != defaultKrbConfig || settings.WinRMProto != "https" {
+		t.Errorf("unexpected defaults: spn=%s config=%s proto=%s", settings.KrbSpn, settings.KrbConfig, settings.WinRMProto)
+	}
+
+	settings, err = kerberosSettings(models.ServerConfig{
+		Host:      "win02",
+		Username:  "svc-discovery",
+		Password:  "secret",
+		KrbRealm:  "LAB.LOCAL",
+		KrbSPN:    "WSMAN/win02.lab.local",
+		KrbConfig: "/etc/discovery/krb5.conf",
+	})
+	if err != nil {
+		t.Fatalf("kerberosSettings returned error: %v", err)
+	}
+	if settings.KrbRealm != "LAB.LOCAL" || settings.KrbSpn != "WSMAN/win02.lab.local" || settings.KrbConfig != "/etc/discovery/krb5.conf" || settings.WinRMProto != "http" {
+		t.Errorf("overrides not applied: %+v", settings)
+	}
+}
+
+func TestPrivateCCacheDir(t *testing.T) {
+	dir, err := privateCCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("credential cache directory has mode %o, want 700", perm)
+	}
+	if again, _ := privateCCacheDir(); again != dir {
+		t.Errorf("got %s, then %s", dir, again)
+	}
+}
@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/masterzen/winrm"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// ConnectionPool manages WinRM client connections. Clients are keyed by
+// scheme, auth transport, user, host and port, reused across discoveries
+// and reaped once they have been idle for longer than idleTimeout.
+type ConnectionPool struct {
+	clients     map[string]*winrm.Client
+	mutex       sync.Mutex
+	maxSize     int
+	idleTimeout time.Duration
+	lastUsed    map[string]time.Time
+	inUse       map[string]int
+	stats       models.ConnectionPoolStats
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewConnectionPool creates a new WinRM connection pool
+func NewConnectionPool(maxSize int, idleTimeout time.Duration) *ConnectionPool {
+	return &ConnectionPool{
+		clients:     make(map[string]*winrm.Client),
+		lastUsed:    make(map[string]time.Time),
+		inUse:       make(map[string]int),
+		maxSize:     maxSize,
+		idleTimeout: idleTimeout,
+	}
+}
+
+// poolKey identifies the pooled client for a server. It includes a hash of
+// the credentials and TLS settings, so that a rotated password or a changed
+// credential_ref gets a new client instead of the stale authenticated one.
+func poolKey(server models.ServerConfig) string {
+	scheme := "http"
+	if server.WinRMHTTPS {
+		scheme = "https"
+	}
+	auth := server.WinRMAuth
+	if auth == "" {
+		auth = WinRMAuthBasic
+	}
+	credentials := sha256.Sum256([]byte(strings.Join([]string{
+		server.Username, server.Password, server.WinRMCert, server.WinRMKey, server.WinRMCACert,
+		strconv.FormatBool(server.WinRMInsecure), server.KrbKeytab, server.KrbRealm, server.KrbConfig, server.KrbSPN,
+	}, "\x00")))
+	return fmt.Sprintf("%s+%s://%s@%s:%d#%x", scheme, auth, server.Username, server.Host, server.WinRMPort, credentials[:8])
+}
+
+// Get returns a pooled client for the server, creating one if there is none.
+// Every successful Get must be paired with a Release.
+func (p *ConnectionPool) Get(server models.ServerConfig) (*winrm.Client, error) {
+	key := poolKey(server)
+
+	p.mutex.Lock()
+	if client, exists := p.clients[key]; exists {
+		p.stats.Hits++
+		p.acquire(key)
+		p.mutex.Unlock()
+		return client, nil
+	}
+	p.stats.Misses++
+	p.mutex.Unlock()
+
+	// Creating a client may involve a Kerberos login, so it happens unlocked
+	client, err := getClient(server)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Another discovery may have created a client for the server meanwhile
+	if existing, exists := p.clients[key]; exists {
+		p.acquire(key)
+		return existing, nil
+	}
+
+	// Make room by dropping the least recently used client, preferring ones
+	// no discovery is using. A winrm.Client holds no session of its own, so
+	// dropping one that is in use does not disturb its current user.
+	if p.maxSize > 0 && len(p.clients) >= p.maxSize {
+		if key := p.leastRecentlyUsed(); key != "" {
+			p.remove(key)
+			p.stats.Evictions++
+		}
+	}
+
+	p.clients[key] = client
+	p.acquire(key)
+	return client, nil
+}
+
+// acquire marks a pooled client as in use; callers hold the mutex
+func (p *ConnectionPool) acquire(key string) {
+	p.inUse[key]++
+	p.lastUsed[key] = time.Now()
+}
+
+// Release returns a client obtained from Get to the pool
+func (p *ConnectionPool) Release(server models.ServerConfig) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := poolKey(server)
+	if p.inUse[key] > 1 {
+		p.inUse[key]--
+	} else {
+		delete(p.inUse, key)
+	}
+	if _, exists := p.clients[key]; exists {
+		p.lastUsed[key] = time.Now()
+	}
+}
+
+// Evict drops the server's client so that the next Get creates a new one.
+// It is used after a failure that may have left the client unusable.
+func (p *ConnectionPool) Evict(server models.ServerConfig) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := poolKey(server)
+	if _, exists := p.clients[key]; exists {
+		p.remove(key)
+		p.stats.Evictions++
+	}
+}
+
+// Stats returns the pool's counters and current size
+func (p *ConnectionPool) Stats() models.ConnectionPoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stats := p.stats
+	stats.OpenClients = len(p.clients)
+	for key := range p.clients {
+		if p.inUse[key] > 0 {
+			stats.InUseClients++
+		}
+	}
+	stats.MaxSize = p.maxSize
+	return stats
+}
+
+// StartReaper starts a background goroutine that drops clients that have
+// been idle for longer than the idle timeout
+func (p *ConnectionPool) StartReaper() {
+	if p.idleTimeout <= 0 || p.done != nil {
+		return
+	}
+	p.done = make(chan struct{})
+
+	interval := p.idleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.reap(time.Now())
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the reaper and drops all clients
+func (p *ConnectionPool) Close() {
+	if p.done != nil {
+		close(p.done)
+		p.wg.Wait()
+		p.done = nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for key := range p.clients {
+		p.remove(key)
+	}
+}
+
+// reap drops idle clients that no discovery is using
+func (p *ConnectionPool) reap(now time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for key, lastUsed := range p.lastUsed {
+		if p.inUse[key] == 0 && now.Sub(lastUsed) > p.idleTimeout {
+			p.remove(key)
+			p.stats.Reaped++
+		}
+	}
+}
+
+// leastRecentlyUsed returns the key of the least recently used client,
+// preferring clients that are not in use; callers hold the mutex
+func (p *ConnectionPool) leastRecentlyUsed() string {
+	var oldestKey string
+	var oldestTime time.Time
+	oldestIdle := false
+	for key, t := range p.lastUsed {
+		idle := p.inUse[key] == 0
+		if oldestKey == "" || (idle && !oldestIdle) || (idle == oldestIdle && t.Before(oldestTime)) {
+			oldestKey = key
+			oldestTime = t
+			oldestIdle = idle
+		}
+	}
+	return oldestKey
+}
+
+// remove drops a client from the pool; callers hold the mutex
+func (p *ConnectionPool) remove(key string) {
+	delete(p.clients, key)
+	delete(p.lastUsed, key)
+}
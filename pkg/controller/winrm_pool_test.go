@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestPoolKeyCredentials(t *testing.T) {
+	server := models.ServerConfig{Host: "win-a", Username: "admin", Password: "old", WinRMPort: 5985}
+	rotated := server
+	rotated.Password = "new"
+	if poolKey(server) == poolKey(rotated) {
+		t.Error("rotated password reuses the client authenticated with the old one")
+	}
+	keytab := server
+	keytab.WinRMAuth, keytab.KrbKeytab = WinRMAuthKerberos, "/etc/discovery.keytab"
+	other := keytab
+	other.KrbKeytab = "/etc/other.keytab"
+	if poolKey(keytab) == poolKey(other) {
+		t.Error("different keytabs share a client")
+	}
+}
+
+func TestConnectionPoolReuse(t *testing.T) {
+	pool := NewConnectionPool(2, time.Minute)
+	a := models.ServerConfig{Host: "win-a", Username: "admin", WinRMPort: 5985}
+	b := models.ServerConfig{Host: "win-b", Username: "admin", WinRMPort: 5985}
+	c := models.ServerConfig{Host: "win-c", Username: "admin", WinRMPort: 5986, WinRMHTTPS: true}
+
+	for _, server := range []models.ServerConfig{a, a, b} {
+		if _, err := pool.Get(server); err != nil {
+			t.Fatalf("Get(%s) returned error: %v", server.Host, err)
+		}
+		pool.Release(server)
+	}
+	stats := pool.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.OpenClients != 2 || stats.InUseClients != 0 {
+		t.Errorf("unexpected stats after reuse: %+v", stats)
+	}
+
+	// a is in use, so the idle b is evicted to make room for c
+	pool.Get(a)
+	pool.Get(c)
+	if _, exists := pool.clients[poolKey(b)]; exists {
+		t.Error("expected the idle client to be evicted")
+	}
+	if _, exists := pool.clients[poolKey(a)]; !exists {
+		t.Error("expected the client in use to be kept")
+	}
+	stats = pool.Stats()
+	if stats.Evictions != 1 || stats.OpenClients != 2 || stats.InUseClients != 2 {
+		t.Errorf("unexpected stats after eviction: %+v", stats)
+	}
+
+	pool.Release(a)
+	pool.Release(c)
+	pool.Evict(c)
+	if stats := pool.Stats(); stats.Evictions != 2 || stats.OpenClients != 1 {
+		t.Errorf("unexpected stats after Evict: %+v", stats)
+	}
+}
+
+func TestConnectionPoolReap(t *testing.T) {
+	pool := NewConnectionPool(10, time.Minute)
+	idle := models.ServerConfig{Host: "win-idle", WinRMPort: 5985}
+	busy := models.ServerConfig{Host: "win-busy", WinRMPort: 5985}
+
+	pool.Get(idle)
+	pool.Release(idle)
+	pool.Get(busy)
+
+	pool.reap(time.Now().Add(2 * time.Minute))
+	if _, exists := pool.clients[poolKey(idle)]; exists {
+		t.Error("expected the idle client to be reaped")
+	}
+	if _, exists := pool.clients[poolKey(busy)]; !exists {
+		t.Error("expected the client in use to survive reaping")
+	}
+	if stats := pool.Stats(); stats.Reaped != 1 {
+		t.Errorf("Reaped = %d, want 1", stats.Reaped)
+	}
+
+	pool.StartReaper()
+	pool.Close()
+	if stats := pool.Stats(); stats.OpenClients != 0 {
+		t.Errorf("OpenClients after Close = %d, want 0", stats.OpenClients)
+	}
+}
@@ -0,0 +1,122 @@
+// Package credentials resolves the credential_ref values in the configuration
+// to usernames and secrets held outside of config.json
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// Provider names, used as credential_ref prefixes and in CredentialsConfig.Provider
+const (
+	ProviderEnv   = "env"
+	ProviderFile  = "file"
+	ProviderLocal = "local"
+	ProviderVault = "vault"
+)
+
+// ErrNotFound is returned when a provider has no credential with the requested name
+var ErrNotFound = errors.New("credential not found")
+
+// Credential holds the secrets resolved for a credential reference. Fields
+// the provider does not hold are left empty.
+type Credential struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Passphrase string `json:"passphrase"` // Decrypts an SSH private key
+}
+
+// CredentialProvider looks up credentials by name
+type CredentialProvider interface {
+	Get(ctx context.Context, name string) (Credential, error)
+}
+
+// Resolver dispatches credential references of the form [provider:]name to
+// the configured providers. References without a provider prefix use the
+// default provider.
+type Resolver struct {
+	providers       map[string]CredentialProvider
+	defaultProvider string
+}
+
+// New creates a Resolver for the providers enabled in config. The
+// environment provider is always available; the others are enabled by
+// setting their location.
+func New(config models.CredentialsConfig) (*Resolver, error) {
+	r := &Resolver{
+		providers:       map[string]CredentialProvider{ProviderEnv: NewEnvProvider(config.EnvPrefix)},
+		defaultProvider: config.Provider,
+	}
+	if r.defaultProvider == "" {
+		r.defaultProvider = ProviderEnv
+	}
+
+	if config.SecretsDir != "" {
+		r.providers[ProviderFile] = NewFileProvider(config.SecretsDir)
+	}
+	if config.VaultFile != "" {
+		local, err := OpenLocalVault(config.VaultFile, config.VaultKeyEnv)
+		if err != nil {
+			return nil, err
+		}
+		r.providers[ProviderLocal] = local
+	}
+	if config.VaultAddress != "" {
+		vault, err := NewVaultProvider(config)
+		if err != nil {
+			return nil, err
+		}
+		r.providers[ProviderVault] = vault
+	}
+
+	if _, ok := r.providers[r.defaultProvider]; !ok {
+		return nil, fmt.Errorf("default credential provider %q is not configured", r.defaultProvider)
+	}
+	return r, nil
+}
+
+// ForConfig creates a Resolver for config.Credentials and fills in the
+// database user and password from config.Database.CredentialRef, as both the
+// server and the workers need before connecting to the database
+func ForConfig(ctx context.Context, config *models.Config) (*Resolver, error) {
+	r, err := New(config.Credentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure credential providers: %w", err)
+	}
+	if ref := config.Database.CredentialRef; ref != "" {
+		cred, err := r.Get(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve database credentials: %w", err)
+		}
+		if cred.Username != "" {
+			config.Database.User = cred.Username
+		}
+		config.Database.Password = cred.Password
+	}
+	return r, nil
+}
+
+// Get resolves a credential reference
+func (r *Resolver) Get(ctx context.Context, ref string) (Credential, error) {
+	providerName, name := r.defaultProvider, ref
+	if i := strings.Index(ref, ":"); i >= 0 {
+		providerName, name = ref[:i], ref[i+1:]
+	}
+	if name == "" {
+		return Credential{}, fmt.Errorf("invalid credential reference %q", ref)
+	}
+
+	provider, ok := r.providers[providerName]
+	if !ok {
+		return Credential{}, fmt.Errorf("credential provider %q is not configured", providerName)
+	}
+	cred, err := provider.Get(ctx, name)
+	if err != nil {
+		return Credential{}, fmt.Errorf("failed to resolve credential %q: %w", ref, err)
+	}
+	return cred, nil
+}
@@ -0,0 +1,146 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestResolver(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "database"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "database", "username"), []byte("discovery\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "database", "password"), []byte("db-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DISCOVERY_CREDENTIAL_WIN_ADMIN_USERNAME", `CORP\svc`)
+	t.Setenv("DISCOVERY_CREDENTIAL_WIN_ADMIN_PASSWORD", "win-secret")
+
+	r, err := New(models.CredentialsConfig{SecretsDir: dir})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	ctx := context.Background()
+
+	cred, err := r.Get(ctx, "win-admin")
+	if err != nil || cred.Username != `CORP\svc` || cred.Password != "win-secret" {
+		t.Errorf("env credential = %+v, %v", cred, err)
+	}
+	cred, err = r.Get(ctx, "file:database")
+	if err != nil || cred.Username != "discovery" || cred.Password != "db-secret" || cred.Passphrase != "" {
+		t.Errorf("file credential = %+v, %v", cred, err)
+	}
+
+	if _, err := r.Get(ctx, "file:missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := r.Get(ctx, "file:../database"); err == nil {
+		t.Error("expected an error for a name escaping the secrets directory")
+	}
+	if _, err := r.Get(ctx, "vault:discovery/win-admin"); err == nil {
+		t.Error("expected an error for an unconfigured provider")
+	}
+	if _, err := New(models.CredentialsConfig{Provider: ProviderLocal}); err == nil {
+		t.Error("expected an error for an unconfigured default provider")
+	}
+}
+
+func TestForConfig(t *testing.T) {
+	t.Setenv("DISCOVERY_CREDENTIAL_DATABASE_USERNAME", "discovery")
+	t.Setenv("DISCOVERY_CREDENTIAL_DATABASE_PASSWORD", "db-secret")
+
+	config := &models.Config{Database: models.DatabaseConfig{User: "postgres", Password: "postgres", CredentialRef: "database"}}
+	if _, err := ForConfig(context.Background(), config); err != nil {
+		t.Fatalf("ForConfig returned error: %v", err)
+	}
+	if config.Database.User != "discovery" || config.Database.Password != "db-secret" {
+		t.Errorf("database credentials = %s/%s", config.Database.User, config.Database.Password)
+	}
+
+	config.Database.CredentialRef = "missing"
+	if _, err := ForConfig(context.Background(), config); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLocalVault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.vault")
+	stored := map[string]Credential{
+		"linux": {Username: "discovery", Passphrase: "key-secret"},
+	}
+	if err := WriteLocalVault(path, "vault-key", stored); err != nil {
+		t.Fatalf("WriteLocalVault returned error: %v", err)
+	}
+
+	if _, err := ReadLocalVault(path, "wrong-key"); err == nil {
+		t.Error("expected an error for a wrong passphrase")
+	}
+
+	t.Setenv("DISCOVERY_VAULT_KEY", "vault-key")
+	vault, err := OpenLocalVault(path, "")
+	if err != nil {
+		t.Fatalf("OpenLocalVault returned error: %v", err)
+	}
+	cred, err := vault.Get(context.Background(), "linux")
+	if err != nil || cred != stored["linux"] {
+		t.Errorf("credential = %+v, %v", cred, err)
+	}
+	if _, err := vault.Get(context.Background(), "windows"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" || r.Header.Get("X-Vault-Namespace") != "ops" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/discovery/win-admin" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"username":"svc","password":"vault-secret"},"metadata":{"version":3}}}`))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s.token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	vault, err := NewVaultProvider(models.CredentialsConfig{
+		VaultAddress:   server.URL + "/",
+		VaultMount:     "kv",
+		VaultNamespace: "ops",
+		VaultTokenFile: tokenFile,
+	})
+	if err != nil {
+		t.Fatalf("NewVaultProvider returned error: %v", err)
+	}
+
+	ctx := context.Background()
+	cred, err := vault.Get(ctx, "discovery/win-admin")
+	if err != nil || cred.Username != "svc" || cred.Password != "vault-secret" {
+		t.Errorf("credential = %+v, %v", cred, err)
+	}
+	if _, err := vault.Get(ctx, "discovery/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := os.WriteFile(tokenFile, []byte("s.revoked"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.Get(ctx, "discovery/win-admin"); err == nil {
+		t.Error("expected an error for a rejected token")
+	}
+}
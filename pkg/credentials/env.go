@@ -0,0 +1,51 @@
+package credentials
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+const defaultEnvPrefix = "DISCOVERY_CREDENTIAL_"
+
+// EnvProvider reads credentials from environment variables. The credential
+// "win-admin" is read from <prefix>WIN_ADMIN_USERNAME, <prefix>WIN_ADMIN_PASSWORD
+// and <prefix>WIN_ADMIN_PASSPHRASE.
+type EnvProvider struct {
+	prefix string
+}
+
+// NewEnvProvider creates an EnvProvider, defaulting the prefix to DISCOVERY_CREDENTIAL_
+func NewEnvProvider(prefix string) *EnvProvider {
+	if prefix == "" {
+		prefix = defaultEnvPrefix
+	}
+	return &EnvProvider{prefix: prefix}
+}
+
+// Get returns the credential stored under name
+func (p *EnvProvider) Get(ctx context.Context, name string) (Credential, error) {
+	base := p.prefix + envName(name)
+	username, hasUsername := os.LookupEnv(base + "_USERNAME")
+	password, hasPassword := os.LookupEnv(base + "_PASSWORD")
+	passphrase, hasPassphrase := os.LookupEnv(base + "_PASSPHRASE")
+	if !hasUsername && !hasPassword && !hasPassphrase {
+		return Credential{}, ErrNotFound
+	}
+	return Credential{Username: username, Password: password, Passphrase: passphrase}, nil
+}
+
+// envName upper-cases name and replaces characters not allowed in
+// environment variable names with underscores
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
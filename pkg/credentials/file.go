@@ -0,0 +1,55 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileProvider reads credentials from files laid out like Kubernetes secrets
+// mounted as volumes: the credential "win-admin" is the directory
+// <dir>/win-admin holding the files username, password and passphrase.
+type FileProvider struct {
+	dir string
+}
+
+// NewFileProvider creates a FileProvider reading credentials below dir
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{dir: dir}
+}
+
+// Get returns the credential stored under name
+func (p *FileProvider) Get(ctx context.Context, name string) (Credential, error) {
+	if !filepath.IsLocal(name) {
+		return Credential{}, fmt.Errorf("invalid credential name %q", name)
+	}
+	dir := filepath.Join(p.dir, name)
+	if _, err := os.Stat(dir); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Credential{}, ErrNotFound
+		}
+		return Credential{}, err
+	}
+
+	var cred Credential
+	for file, value := range map[string]*string{
+		"username":   &cred.Username,
+		"password":   &cred.Password,
+		"passphrase": &cred.Passphrase,
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Credential{}, err
+		}
+		// Secrets written with echo or an editor end with a newline
+		*value = strings.TrimRight(string(data), "\r\n")
+	}
+	return cred, nil
+}
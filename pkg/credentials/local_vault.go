@@ -0,0 +1,148 @@
+package credentials
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	defaultVaultKeyEnv = "DISCOVERY_VAULT_KEY"
+	localVaultVersion  = 1
+
+	// scrypt parameters recommended for interactive logins
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// localVaultFile is the on-disk format of an encrypted local vault. The
+// credentials are encrypted with AES-256-GCM under a key derived from the
+// vault passphrase with scrypt.
+type localVaultFile struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// LocalVault serves credentials from an encrypted vault file
+type LocalVault struct {
+	credentials map[string]Credential
+}
+
+// OpenLocalVault decrypts the vault at path with the passphrase held in the
+// environment variable keyEnv, which defaults to DISCOVERY_VAULT_KEY
+func OpenLocalVault(path, keyEnv string) (*LocalVault, error) {
+	if keyEnv == "" {
+		keyEnv = defaultVaultKeyEnv
+	}
+	passphrase := os.Getenv(keyEnv)
+	if passphrase == "" {
+		return nil, fmt.Errorf("credential vault %s is configured but %s is not set", path, keyEnv)
+	}
+
+	credentials, err := ReadLocalVault(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalVault{credentials: credentials}, nil
+}
+
+// Get returns the credential stored under name
+func (v *LocalVault) Get(ctx context.Context, name string) (Credential, error) {
+	cred, ok := v.credentials[name]
+	if !ok {
+		return Credential{}, ErrNotFound
+	}
+	return cred, nil
+}
+
+// ReadLocalVault decrypts the vault at path and returns its credentials by name
+func ReadLocalVault(path, passphrase string) (map[string]Credential, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read credential vault: %w", err)
+	}
+
+	var file localVaultFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("unable to parse credential vault: %w", err)
+	}
+	if file.Version != localVaultVersion {
+		return nil, fmt.Errorf("unsupported credential vault version %d", file.Version)
+	}
+
+	aead, err := vaultCipher(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("credential vault has an invalid nonce")
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt credential vault: wrong passphrase or corrupt file")
+	}
+
+	credentials := make(map[string]Credential)
+	if err := json.Unmarshal(plaintext, &credentials); err != nil {
+		return nil, fmt.Errorf("unable to parse credential vault contents: %w", err)
+	}
+	return credentials, nil
+}
+
+// WriteLocalVault encrypts credentials with passphrase and writes them to
+// path, replacing any existing vault. A fresh salt and nonce are used on
+// every write.
+func WriteLocalVault(path, passphrase string, credentials map[string]Credential) error {
+	if passphrase == "" {
+		return fmt.Errorf("credential vault passphrase is empty")
+	}
+	plaintext, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+
+	file := localVaultFile{Version: localVaultVersion, Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	aead, err := vaultCipher(passphrase, file.Salt)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Ciphertext = aead.Seal(nil, file.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("unable to write credential vault: %w", err)
+	}
+	return nil
+}
+
+// vaultCipher derives the vault key from passphrase and salt
+func vaultCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
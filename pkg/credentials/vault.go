@@ -0,0 +1,114 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+const (
+	defaultVaultMount = "secret"
+	vaultTimeout      = 10 * time.Second
+)
+
+// VaultProvider reads credentials from a HashiCorp Vault KV version 2 secrets
+// engine. The credential "discovery/win-admin" is the secret at that path
+// below the mount, with the keys username, password and passphrase.
+type VaultProvider struct {
+	address   string
+	mount     string
+	namespace string
+	tokenFile string
+	client    *http.Client
+}
+
+// NewVaultProvider creates a VaultProvider from the vault_* settings. The
+// token is read from vault_token_file on every request so that rotated
+// tokens are picked up, or from the VAULT_TOKEN environment variable.
+func NewVaultProvider(config models.CredentialsConfig) (*VaultProvider, error) {
+	if config.VaultTokenFile == "" && os.Getenv("VAULT_TOKEN") == "" {
+		return nil, fmt.Errorf("Vault credential provider requires vault_token_file or VAULT_TOKEN")
+	}
+	mount := strings.Trim(config.VaultMount, "/")
+	if mount == "" {
+		mount = defaultVaultMount
+	}
+	return &VaultProvider{
+		address:   strings.TrimRight(config.VaultAddress, "/"),
+		mount:     mount,
+		namespace: config.VaultNamespace,
+		tokenFile: config.VaultTokenFile,
+		client:    &http.Client{Timeout: vaultTimeout},
+	}, nil
+}
+
+// Get returns the credential stored under name
+func (p *VaultProvider) Get(ctx context.Context, name string) (Credential, error) {
+	token, err := p.token()
+	if err != nil {
+		return Credential{}, err
+	}
+
+	secretURL := fmt.Sprintf("%s/v1/%s/data/%s", p.address, url.PathEscape(p.mount), escapePath(strings.Trim(name, "/")))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, secretURL, nil)
+	if err != nil {
+		return Credential{}, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Credential{}, fmt.Errorf("Vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return Credential{}, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return Credential{}, fmt.Errorf("Vault returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Data struct {
+			Data Credential `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return Credential{}, fmt.Errorf("unable to decode Vault response: %w", err)
+	}
+	return secret.Data.Data, nil
+}
+
+// token returns the Vault token to authenticate with
+func (p *VaultProvider) token() (string, error) {
+	if p.tokenFile == "" {
+		return os.Getenv("VAULT_TOKEN"), nil
+	}
+	data, err := os.ReadFile(p.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read Vault token: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// escapePath escapes each segment of a slash separated secret path
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
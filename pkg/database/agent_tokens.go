@@ -0,0 +1,52 @@
+package database
+
+import (
+	"fmt"
+)
+
+// GetAgentToken retrieves the token a server's agent signs pushed inventory
+// with. It returns sql.ErrNoRows when the server has no token.
+func (d *Database) GetAgentToken(serverID int) (string, error) {
+	var token string
+	err := d.db.Get(&token, `
+		SELECT token FROM server_discovery.agent_tokens WHERE server_id = $1
+	`, serverID)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SetAgentToken stores a server's agent token, replacing any previous one
+func (d *Database) SetAgentToken(serverID int, token string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO server_discovery.agent_tokens (server_id, token)
+		VALUES ($1, $2)
+		ON CONFLICT (server_id) DO UPDATE
+		SET token = EXCLUDED.token, created_at = NOW(), last_used_at = NULL
+	`, serverID, token)
+	if err != nil {
+		return fmt.Errorf("error storing agent token: %w", err)
+	}
+	return nil
+}
+
+// TouchAgentToken records that a server's agent token was just used
+func (d *Database) TouchAgentToken(serverID int) error {
+	_, err := d.db.Exec(`
+		UPDATE server_discovery.agent_tokens SET last_used_at = NOW() WHERE server_id = $1
+	`, serverID)
+	if err != nil {
+		return fmt.Errorf("error updating agent token: %w", err)
+	}
+	return nil
+}
+
+// DeleteAgentToken revokes a server's agent token
+func (d *Database) DeleteAgentToken(serverID int) (int64, error) {
+	res, err := d.db.Exec(`DELETE FROM server_discovery.agent_tokens WHERE server_id = $1`, serverID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting agent token: %w", err)
+	}
+	return res.RowsAffected()
+}
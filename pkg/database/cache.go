@@ -0,0 +1,36 @@
+package database
+
+import "fmt"
+
+// InvalidateCachedResults records that cached results of a server, or of
+// every server if serverID is 0, must not be reused from now on
+func (d *Database) InvalidateCachedResults(serverID int) error {
+	_, err := d.db.Exec(`
+		INSERT INTO server_discovery.cache_invalidations (server_id, invalidated_at)
+		VALUES ($1, NOW())
+		ON CONFLICT (server_id) DO UPDATE SET invalidated_at = EXCLUDED.invalidated_at
+	`, serverID)
+	if err != nil {
+		return fmt.Errorf("error invalidating cached results: %w", err)
+	}
+	return nil
+}
+
+// CachedResultInvalidated reports whether a cached result, stored as
+// discoveryID for serverID, was invalidated after it was stored. Both times
+// come from the database clock.
+func (d *Database) CachedResultInvalidated(discoveryID, serverID int) (bool, error) {
+	var invalidated bool
+	err := d.db.Get(&invalidated, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM server_discovery.cache_invalidations ci
+			JOIN server_discovery.discovery_results dr ON dr.id = $1
+			WHERE ci.server_id IN (0, $2) AND ci.invalidated_at >= dr.created_at
+		)
+	`, discoveryID, serverID)
+	if err != nil {
+		return false, fmt.Errorf("error checking cache invalidations: %w", err)
+	}
+	return invalidated, nil
+}
@@ -63,6 +63,8 @@ func (d *Database) GetAllServers() ([]models.ServerWithDetails, error) {
 			s.region,
 			s.status,
 			s.last_checked,
+			COALESCE(s.discovery_method, '') as discovery_method,
+			COALESCE(s.credential_ref, '') as credential_ref,
 			COALESCE(m.cpu_usage, 0) as cpu_usage,
 			COALESCE(m.memory_total, 0) as memory_total,
 			COALESCE(m.memory_used, 0) as memory_used,
@@ -91,6 +93,8 @@ func (d *Database) GetAllServers() ([]models.ServerWithDetails, error) {
 			&server.Region,
 			&server.Status,
 			&server.LastChecked,
+			&server.DiscoveryMethod,
+			&server.CredentialRef,
 			&metrics.CPUUsage,
 			&metrics.MemoryTotal,
 			&metrics.MemoryUsed,
@@ -143,9 +147,22 @@ func (d *Database) GetServerDetails(serverID string) (*models.ServerDetails, err
 			sd.memory_total_gb,
 			sd.disk_total_gb,
 			sd.disk_free_gb,
-			sd.last_boot_time
+			sd.last_boot_time,
+			COALESCE(sd.kernel_version, ''),
+			COALESCE(sd.package_manager, ''),
+			COALESCE(sd.init_system, ''),
+			COALESCE(sd.selinux_status, ''),
+			COALESCE(sd.firewall_status, ''),
+			COALESCE(s.discovery_method, ''),
+			COALESCE(s.credential_ref, '')
 		FROM server_discovery.servers s
-		LEFT JOIN server_discovery.server_details sd ON s.id = sd.server_id
+		LEFT JOIN LATERAL (
+			SELECT *
+			FROM server_discovery.server_details
+			WHERE server_id = s.id
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		) sd ON true
 		WHERE s.id = $1
 	`, id)
 	if err != nil {
@@ -154,7 +171,7 @@ func (d *Database) GetServerDetails(serverID string) (*models.ServerDetails, err
 	defer rows.Close()
 
 	if !rows.Next() {
-		return nil, fmt.Errorf("server not found")
+		return nil, sql.ErrNoRows
 	}
 
 	var details models.ServerDetails
@@ -174,6 +191,13 @@ func (d *Database) GetServerDetails(serverID string) (*models.ServerDetails, err
 		&details.DiskTotalGB,
 		&details.DiskFreeGB,
 		&details.LastBootTime,
+		&details.KernelVersion,
+		&details.PackageManager,
+		&details.InitSystem,
+		&details.SELinuxStatus,
+		&details.FirewallStatus,
+		&details.DiscoveryMethod,
+		&details.CredentialRef,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error scanning server details: %v", err)
@@ -241,7 +265,7 @@ func (d *Database) GetServerDetails(serverID string) (*models.ServerDetails, err
 // GetServerDiscoveries retrieves discovery history for a specific server
 func (d *Database) GetServerDiscoveries(serverID string) ([]models.DiscoveryResult, error) {
 	rows, err := d.db.Queryx(`
-		SELECT id, server_id, success, message, start_time, end_time, status
+		SELECT id, server_id, success, message, start_time, end_time, status, COALESCE(attempt, 1), COALESCE(source, 'pull')
 		FROM server_discovery.discovery_results
 		WHERE server_id = $1
 		ORDER BY end_time DESC
@@ -262,6 +286,8 @@ func (d *Database) GetServerDiscoveries(serverID string) ([]models.DiscoveryResu
 			&d.StartTime,
 			&d.EndTime,
 			&d.Status,
+			&d.Attempt,
+			&d.Source,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning discovery row: %v", err)
@@ -274,19 +300,11 @@ func (d *Database) GetServerDiscoveries(serverID string) ([]models.DiscoveryResu
 
 // CreateDiscoveryResult creates a new discovery result in the database
 func (d *Database) CreateDiscoveryResult(result models.DiscoveryResult) (int, error) {
-	var id int
 	log.Printf("[DEBUG] Creating discovery result: %+v", result)
-	err := d.db.QueryRowx(`
-		INSERT INTO server_discovery.discovery_results (
-			server_id, success, message, start_time, end_time, output_path, error, status
-		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id
-	`, result.ServerID, result.Success, result.Message, result.StartTime,
-		result.EndTime, result.OutputPath, result.Error, result.Status).Scan(&id)
+	id, err := insertDiscoveryResult(d.db, result)
 	if err != nil {
 		log.Printf("[ERROR] Failed to create discovery result: %v", err)
-		return 0, fmt.Errorf("failed to create discovery result: %w", err)
+		return 0, err
 	}
 	log.Printf("[DEBUG] Created discovery result with ID: %d", id)
 	return id, nil
@@ -295,7 +313,7 @@ func (d *Database) CreateDiscoveryResult(result models.DiscoveryResult) (int, er
 // GetAllDiscoveries retrieves all discovery results from the database
 func (d *Database) GetAllDiscoveries() ([]models.DiscoveryResult, error) {
 	rows, err := d.db.Queryx(`
-		SELECT id, server_id, success, message, start_time, end_time, output_path, error, status
+		SELECT id, server_id, success, message, start_time, end_time, output_path, error, status, COALESCE(attempt, 1), COALESCE(source, 'pull')
 		FROM server_discovery.discovery_results
 		ORDER BY start_time DESC
 	`)
@@ -318,6 +336,8 @@ func (d *Database) GetAllDiscoveries() ([]models.DiscoveryResult, error) {
 			&outputPath,
 			&errorMsg,
 			&d.Status,
+			&d.Attempt,
+			&d.Source,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning discovery result row: %w", err)
@@ -456,7 +476,7 @@ func (d *Database) GetServerIPAddresses(serverID string) ([]models.IPAddress, er
 		FROM server_discovery.ip_addresses
 		WHERE discovery_id IN (
 			SELECT id FROM server_discovery.discovery_results
-			WHERE server_id = $1
+			WHERE server_id = $1 AND success
 			ORDER BY created_at DESC
 			LIMIT 1
 		)
@@ -499,11 +519,12 @@ func (d *Database) GetServerOpenPorts(serverID string) ([]models.Port, error) {
 			state,
 			CASE WHEN description IS NULL THEN '' ELSE description END as description,
 			process_id,
-			CASE WHEN process_name IS NULL THEN '' ELSE process_name END as process_name
+			CASE WHEN process_name IS NULL THEN '' ELSE process_name END as process_name,
+			COALESCE(protocol, 'tcp') as protocol
 		FROM server_discovery.open_ports
 		WHERE discovery_id IN (
 			SELECT id FROM server_discovery.discovery_results
-			WHERE server_id = $1
+			WHERE server_id = $1 AND success
 			ORDER BY created_at DESC
 			LIMIT 1
 		)
@@ -519,16 +540,18 @@ func (d *Database) GetServerOpenPorts(serverID string) ([]models.Port, error) {
 		var port models.Port
 		var remotePort sql.NullInt64
 		var remoteIP sql.NullString
+		var state sql.NullString
 		var processID sql.NullInt64
 		err := rows.Scan(
 			&port.LocalPort,
 			&port.LocalIP,
 			&remotePort,
 			&remoteIP,
-			&port.State,
+			&state,
 			&port.Description,
 			&processID,
 			&port.ProcessName,
+			&port.Protocol,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning port row: %v", err)
@@ -540,6 +563,9 @@ func (d *Database) GetServerOpenPorts(serverID string) ([]models.Port, error) {
 		if remoteIP.Valid {
 			port.RemoteIP = remoteIP.String
 		}
+		if state.Valid {
+			port.State = state.String
+		}
 		if processID.Valid {
 			pid := int(processID.Int64)
 			port.ProcessID = &pid
@@ -565,7 +591,7 @@ func (d *Database) GetServerInstalledSoftware(serverID string) ([]models.Softwar
 		FROM server_discovery.installed_software
 		WHERE discovery_id IN (
 			SELECT id FROM server_discovery.discovery_results
-			WHERE server_id = $1
+			WHERE server_id = $1 AND success
 			ORDER BY created_at DESC
 			LIMIT 1
 		)
@@ -615,7 +641,7 @@ func (d *Database) GetServerFilesystems(serverID string) ([]models.Filesystem, e
 		FROM server_discovery.filesystems
 		WHERE discovery_id IN (
 			SELECT id FROM server_discovery.discovery_results
-			WHERE server_id = $1
+			WHERE server_id = $1 AND success
 			ORDER BY created_at DESC
 			LIMIT 1
 		)
@@ -678,3 +704,34 @@ func (d *Database) GetAllServerTags() ([]models.Tag, error) {
 	}
 	return tags, nil
 }
+
+// SetServerDiscoveryMethod sets the discovery method of a server; an empty
+// method clears it. It returns sql.ErrNoRows if the server does not exist.
+func (d *Database) SetServerDiscoveryMethod(serverID int, method string) error {
+	res, err := d.db.Exec(`
+		UPDATE server_discovery.servers SET discovery_method = NULLIF($2, '') WHERE id = $1
+	`, serverID, method)
+	if err != nil {
+		return fmt.Errorf("error setting discovery method: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetServerCredentialRef sets the credential reference a server is
+// discovered with; an empty reference clears it. It returns sql.ErrNoRows if
+// the server does not exist.
+func (d *Database) SetServerCredentialRef(serverID int, ref string) error {
+	res, err := d.db.Exec(`
+		UPDATE server_discovery.servers SET credential_ref = NULLIF($2, '') WHERE id = $1
+	`, serverID, ref)
+	if err != nil {
+		return fmt.Errorf("error setting credential reference: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// StoreDiscovery records a discovery result together with the inventory
+// parsed from its output in a single transaction, so that the API never
+// sees a discovery with only part of its inventory. When result.Details is
+// set, the server row is upserted and the inventory tables are filled under
+// the new discovery ID, which is returned.
+func (d *Database) StoreDiscovery(result models.DiscoveryResult) (int, error) {
+	tx, err := d.db.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	details := result.Details
+	if details != nil {
+		serverID, err := upsertServer(tx, result.ServerID, result.Region, details, result.EndTime, result.Source == models.DiscoverySourcePush)
+		if err != nil {
+			return 0, err
+		}
+		result.ServerID = serverID
+	}
+
+	discoveryID, err := insertDiscoveryResult(tx, result)
+	if err != nil {
+		return 0, err
+	}
+
+	if details != nil {
+		if err := insertInventory(tx, result.ServerID, discoveryID, details); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit discovery %d: %w", discoveryID, err)
+	}
+	return discoveryID, nil
+}
+
+// upsertServer marks a discovered server online and refreshes its address
+// and OS type. Servers already in the inventory are matched by ID, others by
+// hostname. An inventory pushed by an agent only updates the server its token
+// belongs to, and leaves the address and OS type that pulled discoveries
+// connect with alone. It returns the server ID.
+func upsertServer(tx *sqlx.Tx, serverID int, region string, details *models.ServerDetails, checked time.Time, pushed bool) (int, error) {
+	if checked.IsZero() {
+		checked = time.Now()
+	}
+	ip, osType := details.IP, details.OSType
+	if pushed {
+		ip, osType = "", ""
+	}
+
+	if serverID > 0 {
+		res, err := tx.Exec(`
+			UPDATE server_discovery.servers
+			SET ip = COALESCE(NULLIF($2, ''), ip),
+				os_type = COALESCE(NULLIF($3, ''), os_type),
+				status = 'online',
+				last_checked = $4,
+				updated_at = NOW()
+			WHERE id = $1
+		`, serverID, ip, osType, checked)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update server %d: %w", serverID, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			return serverID, nil
+		}
+	}
+	if pushed {
+		return 0, fmt.Errorf("server %d of pushed inventory not found", serverID)
+	}
+
+	if details.Hostname == "" {
+		return 0, fmt.Errorf("discovery output has no hostname to match server on")
+	}
+
+	var id int
+	err := tx.QueryRowx(`
+		INSERT INTO server_discovery.servers (hostname, ip, os_type, region, status, last_checked)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), 'online', $5)
+		ON CONFLICT (hostname) DO UPDATE
+		SET ip = COALESCE(NULLIF(EXCLUDED.ip, ''), servers.ip),
+			os_type = COALESCE(EXCLUDED.os_type, servers.os_type),
+			region = COALESCE(servers.region, EXCLUDED.region),
+			status = 'online',
+			last_checked = EXCLUDED.last_checked,
+			updated_at = NOW()
+		RETURNING id
+	`, details.Hostname, details.IP, details.OSType, region, checked).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to upsert server %s: %w", details.Hostname, err)
+	}
+	return id, nil
+}
+
+// insertDiscoveryResult inserts a discovery_results row and returns its ID
+func insertDiscoveryResult(q sqlx.Queryer, result models.DiscoveryResult) (int, error) {
+	var id int
+	attempt := result.Attempt
+	if attempt == 0 {
+		attempt = 1
+	}
+	source := result.Source
+	if source == "" {
+		source = models.DiscoverySourcePull
+	}
+	err := q.QueryRowx(`
+		INSERT INTO server_discovery.discovery_results (
+			server_id, success, message, start_time, end_time, output_path, error, status, attempt, source
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, result.ServerID, result.Success, result.Message, result.StartTime,
+		result.EndTime, result.OutputPath, result.Error, result.Status, attempt, source).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create discovery result: %w", err)
+	}
+	return id, nil
+}
+
+// insertInventory writes the parsed server details into the inventory tables
+func insertInventory(tx *sqlx.Tx, serverID, discoveryID int, details *models.ServerDetails) error {
+	snapshots := make([][]byte, 4)
+	for i, v := range []interface{}{details.IPAddresses, details.InstalledSoftware, details.Services, details.OpenPorts} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode inventory snapshot: %w", err)
+		}
+		snapshots[i] = data
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO server_discovery.server_details (
+			server_id, discovery_id, os_name, os_version, cpu_model, cpu_count,
+			memory_total_gb, disk_total_gb, disk_free_gb, last_boot_time,
+			ip_addresses, installed_software, running_services, open_ports,
+			kernel_version, package_manager, init_system, selinux_status, firewall_status
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14,
+			NULLIF($15, ''), NULLIF($16, ''), NULLIF($17, ''), NULLIF($18, ''), NULLIF($19, ''))
+	`, serverID, discoveryID, details.OSName, details.OSVersion, details.CPUModel, details.CPUCount,
+		details.MemoryTotalGB, details.DiskTotalGB, details.DiskFreeGB, nullTime(details.LastBootTime),
+		snapshots[0], snapshots[1], snapshots[2], snapshots[3],
+		details.KernelVersion, details.PackageManager, details.InitSystem, details.SELinuxStatus, details.FirewallStatus)
+	if err != nil {
+		return fmt.Errorf("failed to insert server details: %w", err)
+	}
+
+	for _, ip := range details.IPAddresses {
+		_, err := tx.Exec(`
+			INSERT INTO server_discovery.ip_addresses (discovery_id, ip_address, interface_name)
+			VALUES ($1, $2, $3)
+		`, discoveryID, ip.IPAddress, ip.InterfaceName)
+		if err != nil {
+			return fmt.Errorf("failed to insert IP address %s: %w", ip.IPAddress, err)
+		}
+	}
+
+	for _, port := range details.OpenPorts {
+		_, err := tx.Exec(`
+			INSERT INTO server_discovery.open_ports (
+				discovery_id, local_port, local_ip, remote_port, remote_ip,
+				state, description, process_id, process_name, protocol
+			)
+			VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, NULLIF($9, ''),
+				COALESCE(NULLIF($10, ''), 'tcp'))
+		`, discoveryID, port.LocalPort, port.LocalIP, port.RemotePort, port.RemoteIP,
+			port.State, port.Description, port.ProcessID, port.ProcessName, port.Protocol)
+		if err != nil {
+			return fmt.Errorf("failed to insert open port %d: %w", port.LocalPort, err)
+		}
+	}
+
+	for _, software := range details.InstalledSoftware {
+		_, err := tx.Exec(`
+			INSERT INTO server_discovery.installed_software (discovery_id, name, version, install_date)
+			VALUES ($1, $2, $3, $4)
+		`, discoveryID, software.Name, software.Version, software.InstallDate)
+		if err != nil {
+			return fmt.Errorf("failed to insert installed software %s: %w", software.Name, err)
+		}
+	}
+
+	for _, fs := range details.Filesystems {
+		_, err := tx.Exec(`
+			INSERT INTO server_discovery.filesystems (
+				discovery_id, device, mount_point, fs_type, total_bytes, used_bytes,
+				free_bytes, used_percent, total_inodes, used_inodes, free_inodes
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (discovery_id, mount_point) DO NOTHING
+		`, discoveryID, fs.Device, fs.MountPoint, fs.FSType, fs.TotalBytes, fs.UsedBytes,
+			fs.FreeBytes, fs.UsedPercent, fs.TotalInodes, fs.UsedInodes, fs.FreeInodes)
+		if err != nil {
+			return fmt.Errorf("failed to insert filesystem %s: %w", fs.MountPoint, err)
+		}
+	}
+
+	for _, service := range details.Services {
+		_, err := tx.Exec(`
+			INSERT INTO server_discovery.running_services (discovery_id, name, display_name, status, start_mode)
+			VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''))
+		`, discoveryID, service.Name, service.DisplayName, service.Status, service.StartMode)
+		if err != nil {
+			return fmt.Errorf("failed to insert running service %s: %w", service.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// nullTime maps the zero time onto NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+const discoveryJobColumns = `
+	id,
+	COALESCE(server_id, 0) as server_id,
+	host,
+	COALESCE(region, '') as region,
+	status,
+	attempts,
+	discovery_id,
+	COALESCE(error, '') as error,
+	created_at,
+	started_at,
+	finished_at,
+	COALESCE(worker_id, '') as worker_id,
+	lease_expires_at,
+	force
+`
+
+// CreateDiscoveryJob records a newly queued discovery job
+func (d *Database) CreateDiscoveryJob(job models.DiscoveryJob) error {
+	_, err := d.db.Exec(`
+		INSERT INTO server_discovery.discovery_jobs (
+			id, server_id, host, region, status, created_at, force
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, job.ID, job.ServerID, job.Host, job.Region, job.Status, job.CreatedAt, job.Force)
+	if err != nil {
+		return fmt.Errorf("failed to create discovery job: %w", err)
+	}
+	return nil
+}
+
+// UpdateDiscoveryJob persists the current state of a discovery job. Jobs run
+// by a worker are only updated while still leased to it, and a pending cancel
+// request is not overwritten by progress updates.
+func (d *Database) UpdateDiscoveryJob(job models.DiscoveryJob) error {
+	_, err := d.db.Exec(`
+		UPDATE server_discovery.discovery_jobs
+		SET status = CASE WHEN status = $9 AND $2 = $10 THEN status ELSE $2 END,
+			attempts = $3,
+			discovery_id = $4,
+			error = NULLIF($5, ''),
+			started_at = $6,
+			finished_at = $7
+		WHERE id = $1 AND COALESCE(worker_id, '') = $8
+	`, job.ID, job.Status, job.Attempts, job.DiscoveryID, job.Error, job.StartedAt, job.FinishedAt,
+		job.WorkerID, models.JobStatusCancelling, models.JobStatusRunning)
+	if err != nil {
+		return fmt.Errorf("failed to update discovery job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// GetDiscoveryJobs retrieves the most recent discovery jobs, optionally filtered by status
+func (d *Database) GetDiscoveryJobs(status string, limit int) ([]models.DiscoveryJob, error) {
+	var jobs []models.DiscoveryJob
+	query := `
+		SELECT ` + discoveryJobColumns + `
+		FROM server_discovery.discovery_jobs
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	if err := d.db.Select(&jobs, query, status, limit); err != nil {
+		return nil, fmt.Errorf("error querying discovery jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// GetDiscoveryJobByID retrieves a single discovery job by its ID
+func (d *Database) GetDiscoveryJobByID(id string) (*models.DiscoveryJob, error) {
+	var job models.DiscoveryJob
+	err := d.db.QueryRowx(`
+		SELECT `+discoveryJobColumns+`
+		FROM server_discovery.discovery_jobs
+		WHERE id = $1
+	`, id).StructScan(&job)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying discovery job: %w", err)
+	}
+	return &job, nil
+}
+
+// FailInterruptedDiscoveryJobs marks jobs left queued or running by a previous
+// controller process as failed. Jobs leased to workers are left alone. It
+// returns the number of jobs updated.
+func (d *Database) FailInterruptedDiscoveryJobs() (int64, error) {
+	res, err := d.db.Exec(`
+		UPDATE server_discovery.discovery_jobs
+		SET status = $1,
+			error = 'interrupted by controller restart',
+			finished_at = $2
+		WHERE status IN ($3, $4) AND worker_id IS NULL
+	`, models.JobStatusFailed, time.Now(), models.JobStatusQueued, models.JobStatusRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset interrupted discovery jobs: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+const discoveryScheduleColumns = `
+	id,
+	name,
+	cron_expression,
+	scope,
+	COALESCE(region, '') as region,
+	COALESCE(tag_name, '') as tag_name,
+	COALESCE(tag_value, '') as tag_value,
+	enabled,
+	last_run_at,
+	next_run_at,
+	created_at,
+	updated_at
+`
+
+// GetSchedules retrieves all discovery schedules
+func (d *Database) GetSchedules() ([]models.DiscoverySchedule, error) {
+	var schedules []models.DiscoverySchedule
+	query := `
+		SELECT ` + discoveryScheduleColumns + `
+		FROM server_discovery.discovery_schedules
+		ORDER BY id
+	`
+	if err := d.db.Select(&schedules, query); err != nil {
+		return nil, fmt.Errorf("error querying discovery schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// GetScheduleByID retrieves a single discovery schedule by its ID
+func (d *Database) GetScheduleByID(id int) (*models.DiscoverySchedule, error) {
+	var schedule models.DiscoverySchedule
+	err := d.db.QueryRowx(`
+		SELECT `+discoveryScheduleColumns+`
+		FROM server_discovery.discovery_schedules
+		WHERE id = $1
+	`, id).StructScan(&schedule)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying discovery schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+// CreateSchedule inserts a discovery schedule and returns its ID
+func (d *Database) CreateSchedule(schedule models.DiscoverySchedule) (int, error) {
+	var id int
+	err := d.db.QueryRow(`
+		INSERT INTO server_discovery.discovery_schedules (
+			name, cron_expression, scope, region, tag_name, tag_value, enabled, next_run_at
+		)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7, $8)
+		RETURNING id
+	`, schedule.Name, schedule.CronExpression, schedule.Scope, schedule.Region,
+		schedule.TagName, schedule.TagValue, schedule.Enabled, schedule.NextRunAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create discovery schedule: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateSchedule persists changes to a discovery schedule
+func (d *Database) UpdateSchedule(schedule models.DiscoverySchedule) error {
+	res, err := d.db.Exec(`
+		UPDATE server_discovery.discovery_schedules
+		SET name = $2,
+			cron_expression = $3,
+			scope = $4,
+			region = NULLIF($5, ''),
+			tag_name = NULLIF($6, ''),
+			tag_value = NULLIF($7, ''),
+			enabled = $8,
+			next_run_at = $9
+		WHERE id = $1
+	`, schedule.ID, schedule.Name, schedule.CronExpression, schedule.Scope, schedule.Region,
+		schedule.TagName, schedule.TagValue, schedule.Enabled, schedule.NextRunAt)
+	if err != nil {
+		return fmt.Errorf("failed to update discovery schedule %d: %w", schedule.ID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteSchedule removes a discovery schedule
+func (d *Database) DeleteSchedule(id int) error {
+	res, err := d.db.Exec(`DELETE FROM server_discovery.discovery_schedules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete discovery schedule %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkScheduleRun records when a schedule last fired and when it fires next
+func (d *Database) MarkScheduleRun(id int, lastRun time.Time, nextRun *time.Time) error {
+	_, err := d.db.Exec(`
+		UPDATE server_discovery.discovery_schedules
+		SET last_run_at = $2,
+			next_run_at = $3
+		WHERE id = $1
+	`, id, lastRun, nextRun)
+	if err != nil {
+		return fmt.Errorf("failed to record run of discovery schedule %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// GetSSHHostKeys retrieves the host keys trusted for a server
+func (d *Database) GetSSHHostKeys(serverID int) ([]models.SSHHostKey, error) {
+	var keys []models.SSHHostKey
+	err := d.db.Select(&keys, `
+		SELECT id, server_id, key_type, public_key, fingerprint, COALESCE(comment, '') as comment, created_at
+		FROM server_discovery.ssh_keys
+		WHERE server_id = $1
+		ORDER BY id
+	`, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying SSH host keys: %w", err)
+	}
+	return keys, nil
+}
+
+// AddSSHHostKey records a trusted host key for a server
+func (d *Database) AddSSHHostKey(key models.SSHHostKey) error {
+	_, err := d.db.Exec(`
+		INSERT INTO server_discovery.ssh_keys (server_id, key_type, public_key, fingerprint, comment)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+		ON CONFLICT (server_id, fingerprint) DO NOTHING
+	`, key.ServerID, key.KeyType, key.PublicKey, key.Fingerprint, key.Comment)
+	if err != nil {
+		return fmt.Errorf("error storing SSH host key: %w", err)
+	}
+	return nil
+}
+
+// DeleteSSHHostKeys forgets the host keys trusted for a server, so that the
+// next connection trusts whichever key it presents
+func (d *Database) DeleteSSHHostKeys(serverID int) (int64, error) {
+	res, err := d.db.Exec(`DELETE FROM server_discovery.ssh_keys WHERE server_id = $1`, serverID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting SSH host keys: %w", err)
+	}
+	return res.RowsAffected()
+}
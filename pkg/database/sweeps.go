@@ -0,0 +1,329 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// ErrCandidateResolved is returned when approving or rejecting a candidate
+// that was already approved
+var ErrCandidateResolved = errors.New("candidate was already approved")
+
+// ErrServerExists is returned when approving a candidate whose hostname is
+// already in the inventory
+var ErrServerExists = errors.New("a server with this hostname already exists")
+
+const networkSweepColumns = `
+	id,
+	cidrs,
+	ports,
+	status,
+	total_hosts,
+	probed_hosts,
+	found_hosts,
+	COALESCE(error, '') as error,
+	started_at,
+	finished_at
+`
+
+const serverCandidateColumns = `
+	id,
+	sweep_id,
+	ip,
+	COALESCE(hostname, '') as hostname,
+	COALESCE(os_type, '') as os_type,
+	ports,
+	status,
+	server_id,
+	first_seen,
+	last_seen
+`
+
+// networkSweepRow scans the array columns of a network_sweeps row
+type networkSweepRow struct {
+	models.NetworkSweep
+	CIDRs pq.StringArray `db:"cidrs"`
+	Ports pq.Int64Array  `db:"ports"`
+}
+
+func (r networkSweepRow) sweep() models.NetworkSweep {
+	sweep := r.NetworkSweep
+	sweep.CIDRs = []string(r.CIDRs)
+	sweep.Ports = make([]int, len(r.Ports))
+	for i, port := range r.Ports {
+		sweep.Ports[i] = int(port)
+	}
+	return sweep
+}
+
+// serverCandidateRow scans the JSON ports column of a server_candidates row
+type serverCandidateRow struct {
+	models.ServerCandidate
+	Ports []byte `db:"ports"`
+}
+
+func (r serverCandidateRow) candidate() (models.ServerCandidate, error) {
+	candidate := r.ServerCandidate
+	if err := json.Unmarshal(r.Ports, &candidate.Ports); err != nil {
+		return candidate, fmt.Errorf("error decoding ports of candidate %d: %w", candidate.ID, err)
+	}
+	return candidate, nil
+}
+
+// CreateNetworkSweep records a newly started sweep and returns its ID
+func (d *Database) CreateNetworkSweep(sweep models.NetworkSweep) (int, error) {
+	ports := make(pq.Int64Array, len(sweep.Ports))
+	for i, port := range sweep.Ports {
+		ports[i] = int64(port)
+	}
+
+	var id int
+	err := d.db.QueryRowx(`
+		INSERT INTO server_discovery.network_sweeps (cidrs, ports, status, total_hosts, started_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, pq.StringArray(sweep.CIDRs), ports, sweep.Status, sweep.TotalHosts, sweep.StartedAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create network sweep: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateNetworkSweep persists the progress and state of a sweep
+func (d *Database) UpdateNetworkSweep(sweep models.NetworkSweep) error {
+	_, err := d.db.Exec(`
+		UPDATE server_discovery.network_sweeps
+		SET status = $2,
+			probed_hosts = $3,
+			found_hosts = $4,
+			error = NULLIF($5, ''),
+			finished_at = $6
+		WHERE id = $1
+	`, sweep.ID, sweep.Status, sweep.ProbedHosts, sweep.FoundHosts, sweep.Error, sweep.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update network sweep %d: %w", sweep.ID, err)
+	}
+	return nil
+}
+
+// GetNetworkSweeps retrieves the most recent sweeps
+func (d *Database) GetNetworkSweeps(limit int) ([]models.NetworkSweep, error) {
+	var rows []networkSweepRow
+	err := d.db.Select(&rows, `
+		SELECT `+networkSweepColumns+`
+		FROM server_discovery.network_sweeps
+		ORDER BY started_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying network sweeps: %w", err)
+	}
+
+	sweeps := make([]models.NetworkSweep, len(rows))
+	for i, row := range rows {
+		sweeps[i] = row.sweep()
+	}
+	return sweeps, nil
+}
+
+// GetNetworkSweepByID retrieves a single sweep by its ID
+func (d *Database) GetNetworkSweepByID(id int) (*models.NetworkSweep, error) {
+	var row networkSweepRow
+	err := d.db.QueryRowx(`
+		SELECT `+networkSweepColumns+`
+		FROM server_discovery.network_sweeps
+		WHERE id = $1
+	`, id).StructScan(&row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying network sweep: %w", err)
+	}
+
+	sweep := row.sweep()
+	return &sweep, nil
+}
+
+// FailInterruptedNetworkSweeps marks sweeps left running by a previous
+// controller process as failed. It returns the number of sweeps updated.
+func (d *Database) FailInterruptedNetworkSweeps() (int64, error) {
+	res, err := d.db.Exec(`
+		UPDATE server_discovery.network_sweeps
+		SET status = $1,
+			error = 'interrupted by controller restart',
+			finished_at = $2
+		WHERE status = $3
+	`, models.SweepStatusFailed, time.Now(), models.SweepStatusRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset interrupted network sweeps: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// GetInventoryIPs returns every address already known to the inventory,
+// either as a server's IP or as one of its discovered interface addresses
+func (d *Database) GetInventoryIPs() (map[string]bool, error) {
+	var ips []string
+	err := d.db.Select(&ips, `
+		SELECT ip FROM server_discovery.servers WHERE ip <> ''
+		UNION
+		SELECT ip_address FROM server_discovery.ip_addresses
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying inventory addresses: %w", err)
+	}
+
+	known := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		known[ip] = true
+	}
+	return known, nil
+}
+
+// UpsertServerCandidate records a host found by a sweep. A host found again
+// has its details refreshed but keeps its approval state.
+func (d *Database) UpsertServerCandidate(candidate models.ServerCandidate) error {
+	ports, err := json.Marshal(candidate.Ports)
+	if err != nil {
+		return fmt.Errorf("error encoding candidate ports: %w", err)
+	}
+
+	_, err = d.db.Exec(`
+		INSERT INTO server_discovery.server_candidates (sweep_id, ip, hostname, os_type, ports, status, first_seen, last_seen)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $7)
+		ON CONFLICT (ip) DO UPDATE
+		SET sweep_id = EXCLUDED.sweep_id,
+			hostname = COALESCE(EXCLUDED.hostname, server_candidates.hostname),
+			os_type = COALESCE(EXCLUDED.os_type, server_candidates.os_type),
+			ports = EXCLUDED.ports,
+			last_seen = EXCLUDED.last_seen
+	`, candidate.SweepID, candidate.IP, candidate.Hostname, candidate.OSType, ports,
+		models.CandidateStatusPending, candidate.LastSeen)
+	if err != nil {
+		return fmt.Errorf("failed to store candidate %s: %w", candidate.IP, err)
+	}
+	return nil
+}
+
+// GetServerCandidates retrieves sweep candidates, optionally filtered by status
+func (d *Database) GetServerCandidates(status string) ([]models.ServerCandidate, error) {
+	var rows []serverCandidateRow
+	err := d.db.Select(&rows, `
+		SELECT `+serverCandidateColumns+`
+		FROM server_discovery.server_candidates
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY last_seen DESC, id
+	`, status)
+	if err != nil {
+		return nil, fmt.Errorf("error querying server candidates: %w", err)
+	}
+
+	candidates := make([]models.ServerCandidate, 0, len(rows))
+	for _, row := range rows {
+		candidate, err := row.candidate()
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+// ApproveServerCandidate adds a candidate to the inventory as a server with
+// the given hostname, region and OS type, and returns the new server ID.
+// Empty fields fall back to what the sweep found; a candidate without a
+// hostname is added under its IP.
+func (d *Database) ApproveServerCandidate(id int, hostname, region, osType string) (int, error) {
+	tx, err := d.db.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var row serverCandidateRow
+	err = tx.QueryRowx(`
+		SELECT `+serverCandidateColumns+`
+		FROM server_discovery.server_candidates
+		WHERE id = $1
+		FOR UPDATE
+	`, id).StructScan(&row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, sql.ErrNoRows
+		}
+		return 0, fmt.Errorf("error querying server candidate: %w", err)
+	}
+	if row.Status == models.CandidateStatusApproved {
+		return 0, ErrCandidateResolved
+	}
+
+	if hostname == "" {
+		hostname = row.Hostname
+	}
+	if hostname == "" {
+		hostname = row.IP
+	}
+	if osType == "" {
+		osType = row.OSType
+	}
+
+	var serverID int
+	err = tx.QueryRowx(`
+		INSERT INTO server_discovery.servers (hostname, ip, os_type, region, status)
+		VALUES ($1, $2, COALESCE(NULLIF($3, ''), 'windows'), NULLIF($4, ''), 'unknown')
+		ON CONFLICT (hostname) DO NOTHING
+		RETURNING id
+	`, hostname, row.IP, osType, region).Scan(&serverID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrServerExists
+		}
+		return 0, fmt.Errorf("failed to add server %s: %w", hostname, err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE server_discovery.server_candidates SET status = $2, server_id = $3 WHERE id = $1
+	`, id, models.CandidateStatusApproved, serverID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update server candidate %d: %w", id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit approval of candidate %d: %w", id, err)
+	}
+	return serverID, nil
+}
+
+// RejectServerCandidate marks a pending candidate as rejected, so that later
+// sweeps do not offer it again
+func (d *Database) RejectServerCandidate(id int) error {
+	var status string
+	err := d.db.QueryRowx(`
+		UPDATE server_discovery.server_candidates
+		SET status = $2
+		WHERE id = $1 AND status <> $3
+		RETURNING status
+	`, id, models.CandidateStatusRejected, models.CandidateStatusApproved).Scan(&status)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := d.db.Get(&exists, `SELECT EXISTS (SELECT 1 FROM server_discovery.server_candidates WHERE id = $1)`, id); err != nil {
+			return fmt.Errorf("error querying server candidate: %w", err)
+		}
+		if exists {
+			return ErrCandidateResolved
+		}
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reject server candidate %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,443 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// workerNodeColumns selects a worker along with the number of jobs leased to it
+const workerNodeColumns = `
+	w.id,
+	w.hostname,
+	COALESCE(w.ip_address, '') as ip_address,
+	COALESCE(w.region, '') as region,
+	w.status,
+	w.capacity,
+	w.jobs_handled,
+	w.registered_at,
+	w.last_seen,
+	(
+		SELECT COUNT(*)
+		FROM server_discovery.discovery_jobs j
+		WHERE j.worker_id = w.id AND j.status IN ('leased', 'running', 'cancelling')
+	) as current_jobs
+`
+
+// activeJobStatuses are the states of jobs that hold a worker lease
+var activeJobStatuses = pq.StringArray{models.JobStatusLeased, models.JobStatusRunning, models.JobStatusCancelling}
+
+// activeDiscoveryJobsQuery selects the jobs leased to or running on a worker,
+// given activeJobStatuses
+const activeDiscoveryJobsQuery = `
+	SELECT ` + discoveryJobColumns + `
+	FROM server_discovery.discovery_jobs
+	WHERE worker_id IS NOT NULL AND status = ANY($1)
+`
+
+// StopLeasing is returned by the pick function of LeaseDiscoveryJobs to leave
+// the job and every job queued after it for a later call
+const StopLeasing = -2
+
+// RegisterWorkerNode records a worker as active, replacing any earlier
+// registration under the same ID
+func (d *Database) RegisterWorkerNode(node models.WorkerNode) error {
+	_, err := d.db.Exec(`
+		INSERT INTO server_discovery.worker_nodes (id, hostname, ip_address, region, status, capacity, registered_at, last_seen)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, NOW(), NOW())
+		ON CONFLICT (id) DO UPDATE SET
+			hostname = EXCLUDED.hostname,
+			ip_address = EXCLUDED.ip_address,
+			region = EXCLUDED.region,
+			status = EXCLUDED.status,
+			capacity = EXCLUDED.capacity,
+			registered_at = EXCLUDED.registered_at,
+			last_seen = EXCLUDED.last_seen
+	`, node.ID, node.Hostname, node.IPAddress, node.Region, models.WorkerStatusActive, node.Capacity)
+	if err != nil {
+		return fmt.Errorf("failed to register worker %s: %w", node.ID, err)
+	}
+	return nil
+}
+
+// HeartbeatWorkerNode records that a worker is alive with the given status
+// and extends the leases of the jobs it holds by lease. It returns the IDs of
+// held jobs the worker should stop running, because they were asked to cancel
+// or their lease was lost, or sql.ErrNoRows if the worker is not registered.
+func (d *Database) HeartbeatWorkerNode(id, status string, held []string, lease time.Duration) ([]string, error) {
+	tx, err := d.db.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE server_discovery.worker_nodes SET status = $2, last_seen = NOW() WHERE id = $1
+	`, id, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record heartbeat of worker %s: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	if len(held) == 0 {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit heartbeat of worker %s: %w", id, err)
+		}
+		return nil, nil
+	}
+
+	_, err = tx.Exec(`
+		UPDATE server_discovery.discovery_jobs
+		SET lease_expires_at = NOW() + $3 * INTERVAL '1 second'
+		WHERE id = ANY($2) AND worker_id = $1 AND status = ANY($4)
+	`, id, pq.StringArray(held), lease.Seconds(), activeJobStatuses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew leases of worker %s: %w", id, err)
+	}
+
+	var stop []string
+	err = tx.Select(&stop, `
+		SELECT id FROM server_discovery.discovery_jobs
+		WHERE id = ANY($2) AND (status = $3 OR worker_id IS DISTINCT FROM $1)
+	`, id, pq.StringArray(held), models.JobStatusCancelling)
+	if err != nil {
+		return nil, fmt.Errorf("error querying jobs to stop on worker %s: %w", id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit heartbeat of worker %s: %w", id, err)
+	}
+	return stop, nil
+}
+
+// releaseJobs returns the leased and running jobs matched by a WHERE clause
+// to the queue. Jobs that were being cancelled are closed out as cancelled
+// instead, since no worker is left to finish them.
+const releaseJobs = `
+	UPDATE server_discovery.discovery_jobs
+	SET status = CASE WHEN status = 'cancelling' THEN 'cancelled' ELSE 'queued' END,
+		error = CASE WHEN status = 'cancelling' THEN 'worker lost while cancelling' ELSE error END,
+		finished_at = CASE WHEN status = 'cancelling' THEN NOW() END,
+		started_at = NULL,
+		worker_id = NULL,
+		lease_expires_at = NULL
+	WHERE status IN ('leased', 'running', 'cancelling') AND `
+
+// StopWorkerNode marks a worker as stopped and returns its jobs to the queue
+func (d *Database) StopWorkerNode(id string) error {
+	tx, err := d.db.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE server_discovery.worker_nodes SET status = $2, last_seen = NOW() WHERE id = $1
+	`, id, models.WorkerStatusStopped); err != nil {
+		return fmt.Errorf("failed to stop worker %s: %w", id, err)
+	}
+	if _, err := tx.Exec(releaseJobs+`worker_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to release jobs of worker %s: %w", id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stop of worker %s: %w", id, err)
+	}
+	return nil
+}
+
+// GetWorkerNodes retrieves all registered workers
+func (d *Database) GetWorkerNodes() ([]models.WorkerNode, error) {
+	var nodes []models.WorkerNode
+	err := d.db.Select(&nodes, `
+		SELECT `+workerNodeColumns+`
+		FROM server_discovery.worker_nodes w
+		ORDER BY w.region, w.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying worker nodes: %w", err)
+	}
+	return nodes, nil
+}
+
+// MarkDeadWorkerNodes marks active workers that have not sent a heartbeat
+// within timeout as dead and returns their IDs
+func (d *Database) MarkDeadWorkerNodes(timeout time.Duration) ([]string, error) {
+	var ids []string
+	err := d.db.Select(&ids, `
+		UPDATE server_discovery.worker_nodes
+		SET status = $1
+		WHERE status IN ($2, $3) AND last_seen < NOW() - $4 * INTERVAL '1 second'
+		RETURNING id
+	`, models.WorkerStatusDead, models.WorkerStatusActive, models.WorkerStatusThrottled, timeout.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark dead worker nodes: %w", err)
+	}
+	return ids, nil
+}
+
+// LeaseDiscoveryJobs leases up to limit queued jobs, oldest first, to the
+// workers that pick chooses among those that are active and were seen within
+// timeout. The queue is read limit jobs at a time, so that jobs pick holds
+// back do not starve those queued behind them. pick returns an index into
+// workers, -1 to leave the job queued, or StopLeasing to stop for this call;
+// the CurrentJobs of the chosen worker is incremented before the next pick.
+// pick is also passed the jobs leased to or running on any worker, including
+// those leased so far in this call, so that it can apply limits across all
+// workers. Coordinators lease one at a time. It returns the number of jobs
+// leased.
+func (d *Database) LeaseDiscoveryJobs(limit int, lease, timeout time.Duration, pick func(job models.DiscoveryJob, workers []models.WorkerNode, active []models.DiscoveryJob) int) (int, error) {
+	tx, err := d.db.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Held until the transaction ends, so that no other coordinator leases
+	// jobs the active jobs below do not include yet
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('server_discovery.lease_discovery_jobs'))`); err != nil {
+		return 0, fmt.Errorf("failed to lock job leasing: %w", err)
+	}
+
+	var workers []models.WorkerNode
+	err = tx.Select(&workers, `
+		SELECT `+workerNodeColumns+`
+		FROM server_discovery.worker_nodes w
+		WHERE w.status = $1 AND w.last_seen >= NOW() - $2 * INTERVAL '1 second'
+	`, models.WorkerStatusActive, timeout.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("error querying live worker nodes: %w", err)
+	}
+	if len(workers) == 0 {
+		return 0, nil
+	}
+
+	var active []models.DiscoveryJob
+	if err := tx.Select(&active, activeDiscoveryJobsQuery, activeJobStatuses); err != nil {
+		return 0, fmt.Errorf("error querying active discovery jobs: %w", err)
+	}
+
+	page := func(after *models.DiscoveryJob) ([]models.DiscoveryJob, error) {
+		var jobs []models.DiscoveryJob
+		var afterCreated *time.Time
+		afterID := ""
+		if after != nil {
+			afterCreated, afterID = &after.CreatedAt, after.ID
+		}
+		err := tx.Select(&jobs, `
+			SELECT `+discoveryJobColumns+`
+			FROM server_discovery.discovery_jobs
+			WHERE status = $1 AND ($2::timestamptz IS NULL OR (created_at, id) > ($2, $3))
+			ORDER BY created_at, id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		`, models.JobStatusQueued, afterCreated, afterID, limit)
+		if err != nil {
+			return nil, fmt.Errorf("error querying queued discovery jobs: %w", err)
+		}
+		return jobs, nil
+	}
+	leaseJob := func(job models.DiscoveryJob, worker models.WorkerNode) error {
+		_, err := tx.Exec(`
+			UPDATE server_discovery.discovery_jobs
+			SET status = $2, worker_id = $3, lease_expires_at = NOW() + $4 * INTERVAL '1 second'
+			WHERE id = $1
+		`, job.ID, models.JobStatusLeased, worker.ID, lease.Seconds())
+		if err != nil {
+			return fmt.Errorf("failed to lease discovery job %s: %w", job.ID, err)
+		}
+		return nil
+	}
+
+	leased, err := leaseQueuedJobs(limit, workers, active, page, pick, leaseJob)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit job leases: %w", err)
+	}
+	return leased, nil
+}
+
+// leaseQueuedJobs walks the queued jobs page by page, oldest first, leasing
+// those pick assigns a worker until limit jobs are leased, pick returns
+// StopLeasing, the queue is exhausted or no worker has room left. page returns up to limit jobs queued
+// after the given one, or the oldest ones if it is nil. Jobs held back by
+// pick do not keep later jobs from being leased.
+func leaseQueuedJobs(limit int, workers []models.WorkerNode, active []models.DiscoveryJob,
+	page func(after *models.DiscoveryJob) ([]models.DiscoveryJob, error),
+	pick func(job models.DiscoveryJob, workers []models.WorkerNode, active []models.DiscoveryJob) int,
+	lease func(job models.DiscoveryJob, worker models.WorkerNode) error) (int, error) {
+	leased := 0
+	var after *models.DiscoveryJob
+	for leased < limit && hasSpareCapacity(workers) {
+		jobs, err := page(after)
+		if err != nil {
+			return 0, err
+		}
+		for _, job := range jobs {
+			if leased == limit {
+				break
+			}
+			i := pick(job, workers, active)
+			if i == StopLeasing {
+				return leased, nil
+			}
+			if i < 0 {
+				continue
+			}
+			if err := lease(job, workers[i]); err != nil {
+				return 0, err
+			}
+			workers[i].CurrentJobs++
+			active = append(active, job)
+			leased++
+		}
+		if len(jobs) < limit {
+			break
+		}
+		after = &jobs[len(jobs)-1]
+	}
+	return leased, nil
+}
+
+// hasSpareCapacity reports whether any active worker can take another job
+func hasSpareCapacity(workers []models.WorkerNode) bool {
+	for _, worker := range workers {
+		if worker.Status == models.WorkerStatusActive && worker.CurrentJobs < worker.Capacity {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimDiscoveryJobs marks up to limit of the jobs leased to a worker as
+// running and returns them
+func (d *Database) ClaimDiscoveryJobs(workerID string, limit int) ([]models.DiscoveryJob, error) {
+	tx, err := d.db.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var jobs []models.DiscoveryJob
+	err = tx.Select(&jobs, `
+		UPDATE server_discovery.discovery_jobs
+		SET status = $3, started_at = NOW()
+		WHERE id IN (
+			SELECT id
+			FROM server_discovery.discovery_jobs
+			WHERE worker_id = $1 AND status = $4
+			ORDER BY created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+discoveryJobColumns,
+		workerID, limit, models.JobStatusRunning, models.JobStatusLeased)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim discovery jobs: %w", err)
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE server_discovery.worker_nodes SET jobs_handled = jobs_handled + $2 WHERE id = $1
+	`, workerID, len(jobs)); err != nil {
+		return nil, fmt.Errorf("failed to count jobs of worker %s: %w", workerID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit job claims: %w", err)
+	}
+	return jobs, nil
+}
+
+// ReclaimExpiredLeases releases jobs whose lease ran out, because their
+// worker died or lost its database connection. It returns the number of jobs
+// released.
+func (d *Database) ReclaimExpiredLeases() (int64, error) {
+	res, err := d.db.Exec(releaseJobs + `lease_expires_at < NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reclaim expired job leases: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// RequestDiscoveryJobCancel cancels a job that no worker has started yet, or
+// asks the worker running it to cancel it. It returns the job's new status,
+// or sql.ErrNoRows if the job is not queued, leased or running.
+func (d *Database) RequestDiscoveryJobCancel(id string) (string, error) {
+	var status string
+	err := d.db.QueryRowx(`
+		UPDATE server_discovery.discovery_jobs
+		SET status = CASE WHEN status = $2 THEN $3 ELSE $4 END,
+			error = CASE WHEN status = $2 THEN error ELSE 'cancelled before start' END,
+			finished_at = CASE WHEN status = $2 THEN NULL ELSE NOW() END,
+			worker_id = CASE WHEN status = $2 THEN worker_id END,
+			lease_expires_at = CASE WHEN status = $2 THEN lease_expires_at END
+		WHERE id = $1 AND status IN ($5, $6, $2)
+		RETURNING status
+	`, id, models.JobStatusRunning, models.JobStatusCancelling, models.JobStatusCancelled,
+		models.JobStatusQueued, models.JobStatusLeased).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", sql.ErrNoRows
+		}
+		return "", fmt.Errorf("failed to cancel discovery job %s: %w", id, err)
+	}
+	return status, nil
+}
+
+// HasActiveDiscoveryJob reports whether a server has a job that is queued,
+// leased or running
+func (d *Database) HasActiveDiscoveryJob(serverID int) (bool, error) {
+	var exists bool
+	err := d.db.Get(&exists, `
+		SELECT EXISTS (
+			SELECT 1 FROM server_discovery.discovery_jobs
+			WHERE server_id = $1 AND (status = $2 OR status = ANY($3))
+		)
+	`, serverID, models.JobStatusQueued, activeJobStatuses)
+	if err != nil {
+		return false, fmt.Errorf("error querying active discovery jobs: %w", err)
+	}
+	return exists, nil
+}
+
+// GetActiveDiscoveryJobs retrieves the jobs leased to or running on any worker
+func (d *Database) GetActiveDiscoveryJobs() ([]models.DiscoveryJob, error) {
+	var jobs []models.DiscoveryJob
+	if err := d.db.Select(&jobs, activeDiscoveryJobsQuery, activeJobStatuses); err != nil {
+		return nil, fmt.Errorf("error querying active discovery jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// CountDiscoveryJobs counts the jobs created since the given time by status
+func (d *Database) CountDiscoveryJobs(since time.Time) (map[string]int, error) {
+	var rows []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	err := d.db.Select(&rows, `
+		SELECT status, COUNT(*) as count
+		FROM server_discovery.discovery_jobs
+		WHERE created_at >= $1
+		GROUP BY status
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("error counting discovery jobs: %w", err)
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
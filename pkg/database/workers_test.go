@@ -0,0 +1,121 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// queuePages serves queued jobs in pages of limit the way the page query
+// does, counting the pages read
+func queuePages(queue []models.DiscoveryJob, limit int, pages *int) func(after *models.DiscoveryJob) ([]models.DiscoveryJob, error) {
+	return func(after *models.DiscoveryJob) ([]models.DiscoveryJob, error) {
+		*pages++
+		start := 0
+		if after != nil {
+			for i, job := range queue {
+				if job.ID == after.ID {
+					start = i + 1
+				}
+			}
+		}
+		end := start + limit
+		if end > len(queue) {
+			end = len(queue)
+		}
+		return queue[start:end], nil
+	}
+}
+
+func TestLeaseQueuedJobsSkipsBlockedJobs(t *testing.T) {
+	const limit = 100
+	created := time.Now()
+
+	// More than a page of jobs in a saturated region ahead of one that is not
+	var queue []models.DiscoveryJob
+	for i := 0; i < 2*limit+10; i++ {
+		queue = append(queue, models.DiscoveryJob{ID: fmt.Sprintf("blocked-%03d", i), Region: "us-east", CreatedAt: created})
+	}
+	queue = append(queue, models.DiscoveryJob{ID: "eu-west-1", Region: "eu-west", CreatedAt: created})
+
+	workers := []models.WorkerNode{{ID: "w1", Status: models.WorkerStatusActive, Capacity: 10}}
+	pick := func(job models.DiscoveryJob, workers []models.WorkerNode, active []models.DiscoveryJob) int {
+		if job.Region == "us-east" {
+			return -1
+		}
+		return 0
+	}
+	var leasedIDs []string
+	lease := func(job models.DiscoveryJob, worker models.WorkerNode) error {
+		leasedIDs = append(leasedIDs, job.ID)
+		return nil
+	}
+
+	pages := 0
+	leased, err := leaseQueuedJobs(limit, workers, nil, queuePages(queue, limit, &pages), pick, lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leased != 1 || len(leasedIDs) != 1 || leasedIDs[0] != "eu-west-1" {
+		t.Errorf("leased %d jobs %v, want eu-west-1", leased, leasedIDs)
+	}
+	if pages != 3 {
+		t.Errorf("read %d pages, want 3", pages)
+	}
+}
+
+func TestLeaseQueuedJobsStops(t *testing.T) {
+	const limit = 5
+	var queue []models.DiscoveryJob
+	for i := 0; i < 20; i++ {
+		queue = append(queue, models.DiscoveryJob{ID: fmt.Sprintf("job-%02d", i)})
+	}
+	pick := func(job models.DiscoveryJob, workers []models.WorkerNode, active []models.DiscoveryJob) int {
+		return pickFirstFree(workers)
+	}
+	lease := func(job models.DiscoveryJob, worker models.WorkerNode) error { return nil }
+
+	// Stops at limit jobs
+	pages := 0
+	workers := []models.WorkerNode{{ID: "w1", Status: models.WorkerStatusActive, Capacity: 50}}
+	if leased, _ := leaseQueuedJobs(limit, workers, nil, queuePages(queue, limit, &pages), pick, lease); leased != limit || pages != 1 {
+		t.Errorf("leased %d jobs over %d pages, want %d over 1", leased, pages, limit)
+	}
+
+	// Stops reading the queue once every worker is full
+	pages = 0
+	workers = []models.WorkerNode{{ID: "w1", Status: models.WorkerStatusActive, Capacity: 2, CurrentJobs: 1}}
+	if leased, _ := leaseQueuedJobs(limit, workers, nil, queuePages(queue, limit, &pages), pick, lease); leased != 1 || pages != 1 {
+		t.Errorf("leased %d jobs over %d pages, want 1 over 1", leased, pages)
+	}
+	if workers[0].CurrentJobs != 2 {
+		t.Errorf("worker has %d jobs, want 2", workers[0].CurrentJobs)
+	}
+
+	// Stops when pick says so
+	pages = 0
+	workers = []models.WorkerNode{{ID: "w1", Status: models.WorkerStatusActive, Capacity: 50}}
+	picked := 0
+	stopAfterTwo := func(job models.DiscoveryJob, workers []models.WorkerNode, active []models.DiscoveryJob) int {
+		if picked == 2 {
+			return StopLeasing
+		}
+		picked++
+		return 0
+	}
+	if leased, _ := leaseQueuedJobs(limit, workers, nil, queuePages(queue, limit, &pages), stopAfterTwo, lease); leased != 2 {
+		t.Errorf("leased %d jobs, want 2", leased)
+	}
+}
+
+// pickFirstFree picks the first worker with room for another job
+func pickFirstFree(workers []models.WorkerNode) int {
+	for i, worker := range workers {
+		if worker.CurrentJobs < worker.Capacity {
+			return i
+		}
+	}
+	return -1
+}
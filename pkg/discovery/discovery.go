@@ -1,22 +1,73 @@
 package discovery
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+	sshtransport "github.com/vobbilis/codegen/server-discovery/pkg/transport/ssh"
 )
 
+// cleanupTimeout bounds removal of the remote working directory, which runs
+// even when the discovery itself was cancelled
+const cleanupTimeout = 30 * time.Second
+
 // ServerDiscoverer interface defines methods for server discovery
 type ServerDiscoverer interface {
-	ExecuteDiscovery(server models.ServerConfig, outputDir string) (models.DiscoveryResult, error)
+	ExecuteDiscovery(ctx context.Context, server models.ServerConfig, outputDir string) (models.DiscoveryResult, error)
 	ParseDiscoveryOutput(outputPath string) (models.ServerDetails, error)
 }
 
-// RunLinuxDiscovery executes discovery on a Linux server
-func RunLinuxDiscovery(config models.SSHConfig, outputDir string) (string, error) {
+// RunLinuxDiscovery uploads the discovery script to a Linux server over SSH,
+// runs it and downloads server_details.json and summary.txt into a new
+// directory under outputDir. It returns the local output directory.
+func RunLinuxDiscovery(ctx context.Context, pool *sshtransport.Pool, config models.SSHConfig, script []byte, outputDir string) (string, error) {
+	client, err := pool.Get(ctx, config)
+	if err != nil {
+		return "", fmt.Errorf("failed to get SSH client: %w", err)
+	}
+	defer pool.Release(client)
+
+	// Create a temporary directory for the script
+	tempDir := fmt.Sprintf("/tmp/server_discovery_%d", time.Now().UnixNano())
+	if _, err := sshtransport.Run(ctx, client, "mkdir -p "+sshtransport.Quote(tempDir)); err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		if _, err := sshtransport.Run(cleanupCtx, client, "rm -rf "+sshtransport.Quote(tempDir)); err != nil {
+			log.Printf("Warning: failed to clean up %s on %s: %v", tempDir, config.Host, err)
+		}
+	}()
+
+	// Upload and run the discovery script
+	remoteScript := path.Join(tempDir, "Enhanced-ServerDiscovery.sh")
+	if err := sshtransport.Upload(ctx, client, remoteScript, script, 0755); err != nil {
+		return "", fmt.Errorf("failed to upload discovery script: %w", err)
+	}
+
+	cmd := fmt.Sprintf("cd %s && bash %s %s", sshtransport.Quote(tempDir), sshtransport.Quote(remoteScript), sshtransport.Quote(tempDir))
+	if _, err := sshtransport.Run(ctx, client, cmd); err != nil {
+		return "", fmt.Errorf("failed to run discovery script: %w", err)
+	}
+
+	// The script writes into a <hostname>_<timestamp> directory below tempDir
+	out, err := sshtransport.Run(ctx, client, fmt.Sprintf("find %s -mindepth 2 -maxdepth 2 -name server_details.json", sshtransport.Quote(tempDir)))
+	if err != nil {
+		return "", fmt.Errorf("failed to locate discovery output: %w", err)
+	}
+	remoteJSON := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	if remoteJSON == "" {
+		return "", fmt.Errorf("discovery script did not produce server_details.json")
+	}
+
 	// Create a unique output directory for this execution
 	timestamp := time.Now().Format("20060102_150405")
 	executionDir := filepath.Join(outputDir, fmt.Sprintf("%s_%s", config.Host, timestamp))
@@ -24,7 +75,26 @@ func RunLinuxDiscovery(config models.SSHConfig, outputDir string) (string, error
 		return "", fmt.Errorf("failed to create execution directory: %w", err)
 	}
 
-	// For now, just return the directory path
-	// In a real implementation, this would execute discovery commands via SSH
+	jsonContent, err := sshtransport.Download(ctx, client, remoteJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to download JSON output: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(executionDir, "server_details.json"), jsonContent, 0644); err != nil {
+		return "", fmt.Errorf("failed to write JSON output: %w", err)
+	}
+
+	// The summary and log are informational, so failing to fetch them is not fatal
+	remoteDir := path.Dir(remoteJSON)
+	for _, name := range []string{"summary.txt", "discovery.log"} {
+		content, err := sshtransport.Download(ctx, client, path.Join(remoteDir, name))
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(executionDir, name), content, 0644); err != nil {
+			log.Printf("Warning: failed to write %s: %v", name, err)
+		}
+	}
+
 	return executionDir, nil
 }
@@ -0,0 +1,145 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+	sshtransport "github.com/vobbilis/codegen/server-discovery/pkg/transport/ssh"
+)
+
+// Linux collectors, see models.Config.LinuxCollector
+const (
+	LinuxCollectorScript   = "script"
+	LinuxCollectorCommands = "commands"
+)
+
+// linuxCommand is a read-only command whose output is saved as <name>.txt
+type linuxCommand struct {
+	name string
+	cmd  string
+}
+
+// linuxCommands are run by the command-based collector. Each only reads
+// system state and may be missing on a given host; its section is then empty.
+var linuxCommands = []linuxCommand{
+	{"hostname", "hostname || cat /proc/sys/kernel/hostname"},
+	{"os_release", "cat /etc/os-release"},
+	{"kernel", "uname -r"},
+	{"cpuinfo", "cat /proc/cpuinfo"},
+	{"meminfo", "cat /proc/meminfo"},
+	{"loadavg", "cat /proc/loadavg"},
+	// Two samples of the cpu line a second apart give the current CPU usage
+	{"stat", "cat /proc/stat; sleep 1; head -n 1 /proc/stat"},
+	{"proc", "ls /proc"},
+	{"mounts", "cat /proc/mounts"},
+	{"df", "df -P -k"},
+	{"df_inodes", "df -P -i"},
+	{"ip_addr", "ip -o addr show"},
+	{"sockets", "ss -tuanp"},
+	{"dpkg", `dpkg-query -W -f '${Package}\t${Version}\n'`},
+	{"rpm", `rpm -qa --qf '%{NAME}\t%{VERSION}-%{RELEASE}\t%{INSTALLTIME}\n'`},
+	{"services", "systemctl list-units --type=service --all --no-legend --no-pager --plain"},
+	{"unit_files", "systemctl list-unit-files --type=service --no-legend --no-pager"},
+	{"init", "cat /proc/1/comm"},
+	{"selinux", "getenforce"},
+	{"firewall", "if command -v firewall-cmd >/dev/null; then firewall-cmd --state; elif command -v ufw >/dev/null; then ufw status | sed -n 's/^Status: *//p'; fi"},
+}
+
+// RunLinuxCommands collects a Linux server's inventory by running
+// linuxCommands in a single SSH session, without uploading a script or
+// depending on tools beyond coreutils. The output of each command is saved
+// in a new directory under outputDir, which is returned.
+func RunLinuxCommands(ctx context.Context, pool *sshtransport.Pool, config models.SSHConfig, outputDir string) (string, error) {
+	client, err := pool.Get(ctx, config)
+	if err != nil {
+		return "", fmt.Errorf("failed to get SSH client: %w", err)
+	}
+	defer pool.Release(client)
+
+	marker, err := sectionMarker()
+	if err != nil {
+		return "", err
+	}
+	out, err := sshtransport.Run(ctx, client, "sh -c "+sshtransport.Quote(commandScript(marker)))
+	if err != nil {
+		return "", fmt.Errorf("failed to run discovery commands: %w", err)
+	}
+
+	sections := splitSections(string(out), marker)
+	if len(sections) == 0 {
+		return "", fmt.Errorf("discovery commands produced no output")
+	}
+
+	timestamp := time.Now().Format("20060102_150405")
+	executionDir := filepath.Join(outputDir, fmt.Sprintf("%s_%s", config.Host, timestamp))
+	if err := os.MkdirAll(executionDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create execution directory: %w", err)
+	}
+	for name, content := range sections {
+		if err := os.WriteFile(filepath.Join(executionDir, name+".txt"), []byte(content), 0644); err != nil {
+			return "", fmt.Errorf("failed to write %s output: %w", name, err)
+		}
+	}
+
+	return executionDir, nil
+}
+
+// sectionMarker returns a random marker that cannot clash with command output
+func sectionMarker() (string, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return "@@server-discovery-" + hex.EncodeToString(nonce), nil
+}
+
+// commandScript builds a POSIX shell script running every command in
+// linuxCommands, each preceded by a "<marker> <name>" line. Errors are
+// discarded so that a missing tool only leaves its section empty.
+func commandScript(marker string) string {
+	var b strings.Builder
+	b.WriteString("LC_ALL=C; export LC_ALL\n")
+	for _, c := range linuxCommands {
+		fmt.Fprintf(&b, "echo '%s %s'\n", marker, c.name)
+		fmt.Fprintf(&b, "{ %s; } 2>/dev/null\n", c.cmd)
+	}
+	b.WriteString("exit 0\n")
+	return b.String()
+}
+
+// splitSections splits the output of commandScript into each command's output by name
+func splitSections(output, marker string) map[string]string {
+	sections := make(map[string]string)
+	var name string
+	var content strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, ok := strings.CutPrefix(line, marker+" "); ok {
+			if name != "" {
+				sections[name] = content.String()
+			}
+			name = rest
+			content.Reset()
+			continue
+		}
+		if name != "" {
+			content.WriteString(line)
+			content.WriteByte('\n')
+		}
+	}
+	if name != "" {
+		sections[name] = content.String()
+	}
+	return sections
+}
@@ -0,0 +1,139 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitSections(t *testing.T) {
+	script := commandScript("@@m")
+	if !strings.Contains(script, "echo '@@m hostname'\n") || !strings.HasSuffix(script, "exit 0\n") {
+		t.Errorf("unexpected script:\n%s", script)
+	}
+
+	output := "motd noise\n@@m hostname\nweb01\n@@m selinux\n@@m kernel\n5.15.0\nline two\n"
+	sections := splitSections(output, "@@m")
+	want := map[string]string{"hostname": "web01\n", "selinux": "", "kernel": "5.15.0\nline two\n"}
+	if len(sections) != len(want) {
+		t.Fatalf("got sections %q, want %q", sections, want)
+	}
+	for name, content := range want {
+		if sections[name] != content {
+			t.Errorf("section %s = %q, want %q", name, sections[name], content)
+		}
+	}
+}
+
+// sampleLinuxCommands is trimmed command output from an Ubuntu host
+var sampleLinuxCommands = map[string]string{
+	"hostname":   "web01\n",
+	"kernel":     "5.15.0-105-generic\n",
+	"os_release": "NAME=\"Ubuntu\"\nVERSION_ID=\"22.04\"\nPRETTY_NAME=\"Ubuntu 22.04.4 LTS\"\n",
+	"cpuinfo":    "processor\t: 0\nmodel name\t: Intel(R) Xeon(R) CPU E5-2680 v4\nprocessor\t: 1\nmodel name\t: Intel(R) Xeon(R) CPU E5-2680 v4\n",
+	"meminfo":    "MemTotal:        8388608 kB\nMemFree:          1048576 kB\nMemAvailable:    4194304 kB\n",
+	"loadavg":    "0.12 0.10 0.05 1/210 4242\n",
+	"stat":       "cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 50 0 50 350 50 0 0 0 0 0\nbtime 1700000000\ncpu  130 0 120 740 110 0 0 0 0 0\n",
+	"proc":       "1\n2\n812\nacpi\ncpuinfo\nself\n",
+	"mounts":     "/dev/sda1 / ext4 rw,relatime 0 0\n/dev/sdb1 /srv/my\\040data xfs rw 0 0\ntmpfs /run tmpfs rw 0 0\n",
+	"df": "Filesystem     1024-blocks     Used Available Capacity Mounted on\n" +
+		"/dev/sda1         41943040 10485760  31457280      25% /\n" +
+		"/dev/sdb1         10485760        0  10485760       0% /srv/my data\n" +
+		"tmpfs              1048576        0   1048576       0% /run\n",
+	"df_inodes": "Filesystem     Inodes IUsed IFree IUse% Mounted on\n/dev/sda1        1000   100   900   10% /\n",
+	"ip_addr": "1: lo    inet 127.0.0.1/8 scope host lo\\       valid_lft forever preferred_lft forever\n" +
+		"2: eth0    inet 10.0.0.15/24 brd 10.0.0.255 scope global eth0\\       valid_lft forever preferred_lft forever\n" +
+		"2: eth0    inet6 fe80::1/64 scope link \\       valid_lft forever preferred_lft forever\n",
+	"sockets": "Netid State  Recv-Q Send-Q Local Address:Port  Peer Address:Port Process\n" +
+		"udp   UNCONN 0      0      127.0.0.53%lo:53       0.0.0.0:*\n" +
+		"tcp   LISTEN 0      128          0.0.0.0:22       0.0.0.0:*     users:((\"sshd\",pid=812,fd=3))\n" +
+		"tcp   ESTAB  0      0          10.0.0.15:22     10.0.0.9:51234\n" +
+		"tcp   LISTEN 0      511             [::]:80          [::]:*\n",
+	"dpkg":       "openssh-server\t1:8.9p1-3ubuntu0.7\nnginx\t1.18.0-6ubuntu14.4\n",
+	"services":   "ssh.service loaded active running OpenBSD Secure Shell server\ncron.service loaded active running Regular background program processing daemon\nsnapd.socket loaded active listening Socket activation\n",
+	"unit_files": "ssh.service enabled enabled\ncron.service enabled enabled\n",
+	"init":       "systemd\n",
+	"firewall":   "active\n",
+}
+
+func TestParseLinuxCommands(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range sampleLinuxCommands {
+		if err := os.WriteFile(filepath.Join(dir, name+".txt"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	details, err := ParseLinuxCommands(dir)
+	if err != nil {
+		t.Fatalf("ParseLinuxCommands returned error: %v", err)
+	}
+
+	if details.Hostname != "web01" || details.OSName != "Ubuntu 22.04.4 LTS" || details.OSVersion != "22.04" || details.OSType != "linux" {
+		t.Errorf("unexpected system fields: %+v", details)
+	}
+	if details.SELinuxStatus != "disabled" || details.FirewallStatus != "active" || details.InitSystem != "systemd" || details.PackageManager != "dpkg" {
+		t.Errorf("unexpected status fields: selinux=%s firewall=%s init=%s packages=%s",
+			details.SELinuxStatus, details.FirewallStatus, details.InitSystem, details.PackageManager)
+	}
+	if details.CPUCount != 2 || details.CPUModel != "Intel(R) Xeon(R) CPU E5-2680 v4" || details.MemoryTotalGB != 8 {
+		t.Errorf("unexpected hardware: %d x %s, %.2f GB", details.CPUCount, details.CPUModel, details.MemoryTotalGB)
+	}
+	if details.LastBootTime.Unix() != 1700000000 {
+		t.Errorf("LastBootTime = %v", details.LastBootTime)
+	}
+	m := details.Metrics
+	if m.CPUUsage != 50 || m.LoadAverage != 0.12 || m.ProcessCount != 3 || m.MemoryUsed != 4<<30 {
+		t.Errorf("unexpected metrics: %+v", m)
+	}
+
+	if len(details.Filesystems) != 3 {
+		t.Fatalf("got %d filesystems, want 3", len(details.Filesystems))
+	}
+	root, data := details.Filesystems[0], details.Filesystems[1]
+	if root.FSType != "ext4" || root.TotalBytes != 40<<30 || root.UsedPercent != 25 || root.TotalInodes != 1000 {
+		t.Errorf("unexpected root filesystem: %+v", root)
+	}
+	if data.MountPoint != "/srv/my data" || data.FSType != "xfs" {
+		t.Errorf("unexpected data filesystem: %+v", data)
+	}
+	if details.DiskTotalGB != 50 || details.DiskFreeGB != 40 {
+		t.Errorf("disk totals = %.2f/%.2f, want 50/40", details.DiskTotalGB, details.DiskFreeGB)
+	}
+
+	if details.IP != "10.0.0.15" || len(details.IPAddresses) != 3 || details.IPAddresses[2].IPAddress != "fe80::1" {
+		t.Errorf("unexpected addresses: %s %+v", details.IP, details.IPAddresses)
+	}
+
+	if len(details.OpenPorts) != 4 {
+		t.Fatalf("got %d ports, want 4: %+v", len(details.OpenPorts), details.OpenPorts)
+	}
+	dns, sshd, session, http := details.OpenPorts[0], details.OpenPorts[1], details.OpenPorts[2], details.OpenPorts[3]
+	if dns.Protocol != "udp" || dns.LocalIP != "127.0.0.53" || dns.LocalPort != 53 || dns.State != "" {
+		t.Errorf("unexpected udp port: %+v", dns)
+	}
+	if sshd.State != "LISTENING" || sshd.ProcessName != "sshd" || sshd.ProcessID == nil || *sshd.ProcessID != 812 {
+		t.Errorf("unexpected sshd port: %+v", sshd)
+	}
+	if session.State != "ESTABLISHED" || session.RemoteIP != "10.0.0.9" || session.RemotePort != 51234 {
+		t.Errorf("unexpected established port: %+v", session)
+	}
+	if http.LocalIP != "::" || http.LocalPort != 80 {
+		t.Errorf("unexpected IPv6 port: %+v", http)
+	}
+
+	if len(details.InstalledSoftware) != 2 || details.InstalledSoftware[0].Version != "1:8.9p1-3ubuntu0.7" {
+		t.Errorf("unexpected software: %+v", details.InstalledSoftware)
+	}
+	if len(details.Services) != 2 || details.Services[0].Name != "ssh" || details.Services[0].Status != "running" ||
+		details.Services[0].StartMode != "enabled" || details.Services[0].Description != "OpenBSD Secure Shell server" {
+		t.Errorf("unexpected services: %+v", details.Services)
+	}
+}
+
+func TestParseLinuxCommandsEmpty(t *testing.T) {
+	if _, err := ParseLinuxCommands(t.TempDir()); err == nil {
+		t.Error("expected an error for a directory without command output")
+	}
+}
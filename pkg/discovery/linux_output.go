@@ -0,0 +1,75 @@
+package discovery
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// linuxDiscoveryOutput is the server_details.json written by
+// Enhanced-ServerDiscovery.sh. Its interface and filesystem sections do not
+// match models.ServerDetails and are converted after decoding.
+type linuxDiscoveryOutput struct {
+	models.ServerDetails
+	NetworkInterfaces []struct {
+		Name        string   `json:"name"`
+		IPAddresses []string `json:"ip_addresses"`
+	} `json:"network_interfaces"`
+	MountedFilesystems []struct {
+		Device     string  `json:"device"`
+		MountPoint string  `json:"mount_point"`
+		FSType     string  `json:"fs_type"`
+		TotalGB    float64 `json:"total_gb"`
+		UsedGB     float64 `json:"used_gb"`
+		FreeGB     float64 `json:"free_gb"`
+		UsedInodes int64   `json:"used_inodes"`
+		FreeInodes int64   `json:"free_inodes"`
+	} `json:"mounted_filesystems"`
+}
+
+// ParseServerDetailsJSON decodes a server_details.json, either as written by
+// Enhanced-ServerDiscovery.sh or in the shape of models.ServerDetails, as the
+// local collector and cmd/agent write it
+func ParseServerDetailsJSON(data []byte) (models.ServerDetails, error) {
+	var output linuxDiscoveryOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return models.ServerDetails{}, err
+	}
+
+	details := output.ServerDetails
+	for _, iface := range output.NetworkInterfaces {
+		for _, ip := range iface.IPAddresses {
+			details.IPAddresses = append(details.IPAddresses, models.IPAddress{IPAddress: ip, InterfaceName: iface.Name})
+			if details.IP == "" && iface.Name != "lo" && !strings.HasPrefix(ip, "127.") && !strings.Contains(ip, ":") {
+				details.IP = ip
+			}
+		}
+	}
+
+	const gb = 1 << 30
+	for _, fs := range output.MountedFilesystems {
+		filesystem := models.Filesystem{
+			Device:      fs.Device,
+			MountPoint:  fs.MountPoint,
+			FSType:      fs.FSType,
+			TotalBytes:  int64(fs.TotalGB * gb),
+			UsedBytes:   int64(fs.UsedGB * gb),
+			FreeBytes:   int64(fs.FreeGB * gb),
+			UsedInodes:  fs.UsedInodes,
+			FreeInodes:  fs.FreeInodes,
+			TotalInodes: fs.UsedInodes + fs.FreeInodes,
+		}
+		if fs.TotalGB > 0 {
+			filesystem.UsedPercent = math.Round(fs.UsedGB/fs.TotalGB*10000) / 100
+		}
+		details.Filesystems = append(details.Filesystems, filesystem)
+		if strings.HasPrefix(fs.Device, "/dev/") {
+			details.DiskTotalGB += fs.TotalGB
+			details.DiskFreeGB += fs.FreeGB
+		}
+	}
+
+	return details, nil
+}
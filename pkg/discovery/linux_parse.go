@@ -0,0 +1,419 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// ssStates maps ss socket states onto the netstat-style names stored in open_ports
+var ssStates = map[string]string{
+	"LISTEN":     "LISTENING",
+	"ESTAB":      "ESTABLISHED",
+	"SYN-SENT":   "SYN_SENT",
+	"SYN-RECV":   "SYN_RECEIVED",
+	"FIN-WAIT-1": "FIN_WAIT_1",
+	"FIN-WAIT-2": "FIN_WAIT_2",
+	"TIME-WAIT":  "TIME_WAIT",
+	"CLOSE-WAIT": "CLOSE_WAIT",
+	"LAST-ACK":   "LAST_ACK",
+	"CLOSING":    "CLOSING",
+	"UNCONN":     "",
+}
+
+// ParseLinuxCommands builds server details from the command output saved by
+// RunLinuxCommands in dir. Sections that are missing or empty are skipped.
+func ParseLinuxCommands(dir string) (models.ServerDetails, error) {
+	sections := make(map[string]string)
+	for _, c := range linuxCommands {
+		data, err := os.ReadFile(filepath.Join(dir, c.name+".txt"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return models.ServerDetails{}, fmt.Errorf("failed to read %s output: %w", c.name, err)
+		}
+		sections[c.name] = string(data)
+	}
+	if len(sections) == 0 {
+		return models.ServerDetails{}, fmt.Errorf("no Linux discovery output found in %s", dir)
+	}
+
+	details := models.ServerDetails{
+		OSType:         "linux",
+		Hostname:       strings.TrimSpace(sections["hostname"]),
+		KernelVersion:  strings.TrimSpace(sections["kernel"]),
+		SELinuxStatus:  strings.TrimSpace(sections["selinux"]),
+		FirewallStatus: strings.TrimSpace(sections["firewall"]),
+		InitSystem:     strings.TrimSpace(sections["init"]),
+		Metrics:        &models.ServerMetrics{},
+	}
+	if details.SELinuxStatus == "" {
+		details.SELinuxStatus = "disabled"
+	}
+	if details.FirewallStatus == "" {
+		details.FirewallStatus = "unknown"
+	}
+	if details.InitSystem == "" {
+		details.InitSystem = "unknown"
+	}
+
+	osRelease := parseKeyValues(sections["os_release"], "=")
+	details.OSName = firstNonEmpty(osRelease["PRETTY_NAME"], osRelease["NAME"])
+	details.OSVersion = osRelease["VERSION_ID"]
+
+	parseCPUInfo(sections["cpuinfo"], &details)
+	parseMemInfo(sections["meminfo"], &details)
+	parseStat(sections["stat"], &details)
+	if fields := strings.Fields(sections["loadavg"]); len(fields) > 0 {
+		details.Metrics.LoadAverage, _ = strconv.ParseFloat(fields[0], 64)
+	}
+	for _, name := range strings.Fields(sections["proc"]) {
+		if _, err := strconv.Atoi(name); err == nil {
+			details.Metrics.ProcessCount++
+		}
+	}
+
+	parseFilesystems(sections["df"], sections["df_inodes"], sections["mounts"], &details)
+	parseIPAddresses(sections["ip_addr"], &details)
+	details.OpenPorts = parseSockets(sections["sockets"])
+	parsePackages(sections["dpkg"], sections["rpm"], &details)
+	details.Services = parseServices(sections["services"], sections["unit_files"])
+
+	return details, nil
+}
+
+// parseKeyValues parses KEY<sep>value lines, removing quotes around values
+func parseKeyValues(text, sep string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := strings.Cut(line, sep)
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values
+}
+
+// parseCPUInfo reads the processor model and count from /proc/cpuinfo
+func parseCPUInfo(text string, details *models.ServerDetails) {
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "processor":
+			details.CPUCount++
+		case "model name", "Hardware", "cpu model":
+			if details.CPUModel == "" {
+				details.CPUModel = strings.TrimSpace(value)
+			}
+		}
+	}
+}
+
+// parseMemInfo reads total and available memory from /proc/meminfo
+func parseMemInfo(text string, details *models.ServerDetails) {
+	kb := func(value string) int64 {
+		n, _ := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		return n * 1024
+	}
+	info := parseKeyValues(text, ":")
+	total := kb(info["MemTotal"])
+	available := kb(info["MemAvailable"])
+	if info["MemAvailable"] == "" {
+		// Kernels before 3.14 do not report MemAvailable
+		available = kb(info["MemFree"]) + kb(info["Buffers"]) + kb(info["Cached"])
+	}
+	details.MemoryTotalGB = roundGB(total)
+	details.Metrics.MemoryTotal = total
+	details.Metrics.MemoryUsed = total - available
+}
+
+// parseStat reads the boot time from /proc/stat and the CPU usage between
+// the first and last aggregate cpu lines
+func parseStat(text string, details *models.ServerDetails) {
+	var first, last []float64
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "btime":
+			if boot, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				details.LastBootTime = time.Unix(boot, 0).UTC()
+			}
+		case "cpu":
+			times := make([]float64, 0, len(fields)-1)
+			for _, f := range fields[1:] {
+				v, _ := strconv.ParseFloat(f, 64)
+				times = append(times, v)
+			}
+			if first == nil {
+				first = times
+			}
+			last = times
+		}
+	}
+	if len(first) < 4 || len(last) != len(first) {
+		return
+	}
+
+	// Idle time is the idle and iowait columns
+	var total, idle float64
+	for i := range first {
+		delta := last[i] - first[i]
+		total += delta
+		if i == 3 || i == 4 {
+			idle += delta
+		}
+	}
+	if total > 0 {
+		details.Metrics.CPUUsage = math.Round((total-idle)/total*10000) / 100
+	}
+}
+
+// parseFilesystems combines the block and inode usage reported by df -P with
+// the filesystem types from /proc/mounts
+func parseFilesystems(df, dfInodes, mounts string, details *models.ServerDetails) {
+	fsTypes := make(map[string]string)
+	for _, line := range strings.Split(mounts, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 {
+			fsTypes[unescapeMount(fields[1])] = fields[2]
+		}
+	}
+
+	type inodes struct{ total, used, free int64 }
+	inodeUsage := make(map[string]inodes)
+	for _, fields := range dfRows(dfInodes) {
+		total, _ := strconv.ParseInt(fields[1], 10, 64)
+		used, _ := strconv.ParseInt(fields[2], 10, 64)
+		free, _ := strconv.ParseInt(fields[3], 10, 64)
+		inodeUsage[fields[5]] = inodes{total, used, free}
+	}
+
+	var diskTotal, diskFree int64
+	for _, fields := range dfRows(df) {
+		total, _ := strconv.ParseInt(fields[1], 10, 64)
+		used, _ := strconv.ParseInt(fields[2], 10, 64)
+		free, _ := strconv.ParseInt(fields[3], 10, 64)
+		fs := models.Filesystem{
+			Device:     fields[0],
+			MountPoint: fields[5],
+			FSType:     fsTypes[fields[5]],
+			TotalBytes: total * 1024,
+			UsedBytes:  used * 1024,
+			FreeBytes:  free * 1024,
+		}
+		if total > 0 {
+			fs.UsedPercent = math.Round(float64(used)/float64(total)*10000) / 100
+		}
+		if i, ok := inodeUsage[fs.MountPoint]; ok {
+			fs.TotalInodes, fs.UsedInodes, fs.FreeInodes = i.total, i.used, i.free
+		}
+		details.Filesystems = append(details.Filesystems, fs)
+
+		if strings.HasPrefix(fs.Device, "/dev/") {
+			diskTotal += fs.TotalBytes
+			diskFree += fs.FreeBytes
+			details.Metrics.DiskTotal += fs.TotalBytes
+			details.Metrics.DiskUsed += fs.UsedBytes
+		}
+	}
+	details.DiskTotalGB = roundGB(diskTotal)
+	details.DiskFreeGB = roundGB(diskFree)
+}
+
+// dfRows returns the data rows of df -P output as six fields, rejoining
+// mount points that contain spaces
+func dfRows(text string) [][]string {
+	var rows [][]string
+	for i, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 6 {
+			continue
+		}
+		rows = append(rows, append(fields[:5:5], strings.Join(fields[5:], " ")))
+	}
+	return rows
+}
+
+// unescapeMount decodes the octal escapes /proc/mounts uses for spaces and tabs
+func unescapeMount(s string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(s)
+}
+
+// parseIPAddresses reads the addresses listed by ip -o addr show. The first
+// global IPv4 address becomes the server's IP.
+func parseIPAddresses(text string, details *models.ServerDetails) {
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || (fields[2] != "inet" && fields[2] != "inet6") {
+			continue
+		}
+		ip, _, _ := strings.Cut(fields[3], "/")
+		iface := strings.TrimSuffix(fields[1], ":")
+		details.IPAddresses = append(details.IPAddresses, models.IPAddress{IPAddress: ip, InterfaceName: iface})
+		if details.IP == "" && fields[2] == "inet" && iface != "lo" &&
+			!strings.HasPrefix(ip, "127.") && !strings.HasPrefix(ip, "169.254.") {
+			details.IP = ip
+		}
+	}
+}
+
+// parseSockets reads the TCP and UDP sockets listed by ss -tuanp. The owning
+// process is only reported for sockets the SSH user may inspect.
+func parseSockets(text string) []models.Port {
+	var ports []models.Port
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || (fields[0] != "tcp" && fields[0] != "udp") {
+			continue
+		}
+		localIP, localPort, ok := splitSocketAddress(fields[4])
+		if !ok {
+			continue
+		}
+		port := models.Port{
+			Protocol:  fields[0],
+			LocalIP:   localIP,
+			LocalPort: localPort,
+			State:     fields[1],
+		}
+		if state, ok := ssStates[fields[1]]; ok {
+			port.State = state
+		}
+		if remoteIP, remotePort, ok := splitSocketAddress(fields[5]); ok && remotePort != 0 {
+			port.RemoteIP = remoteIP
+			port.RemotePort = remotePort
+		}
+		if len(fields) > 6 {
+			port.ProcessName, port.ProcessID = socketProcess(strings.Join(fields[6:], " "))
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// splitSocketAddress splits an ss address such as 0.0.0.0:22, [::]:443,
+// *:68 or 127.0.0.53%lo:53 into the IP and port
+func splitSocketAddress(addr string) (string, int, bool) {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return "", 0, false
+	}
+	host, portText := addr[:i], addr[i+1:]
+	host = strings.Trim(host, "[]")
+	if zone := strings.Index(host, "%"); zone >= 0 {
+		host = host[:zone]
+	}
+	if host == "*" {
+		host = "0.0.0.0"
+	}
+	if portText == "*" {
+		return host, 0, net.ParseIP(host) != nil
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return "", 0, false
+	}
+	return host, port, true
+}
+
+// socketProcess reads the first process from an ss process column such as
+// users:(("sshd",pid=812,fd=3))
+func socketProcess(column string) (string, *int) {
+	_, rest, ok := strings.Cut(column, `(("`)
+	if !ok {
+		return "", nil
+	}
+	name, rest, _ := strings.Cut(rest, `"`)
+	_, rest, ok = strings.Cut(rest, "pid=")
+	if !ok {
+		return name, nil
+	}
+	pidText, _, _ := strings.Cut(rest, ",")
+	pid, err := strconv.Atoi(strings.TrimRight(pidText, ")"))
+	if err != nil {
+		return name, nil
+	}
+	return name, &pid
+}
+
+// parsePackages reads the packages listed by dpkg-query or rpm, whichever
+// produced output
+func parsePackages(dpkg, rpm string, details *models.ServerDetails) {
+	for _, line := range strings.Split(dpkg, "\n") {
+		if name, version, ok := strings.Cut(line, "\t"); ok {
+			details.PackageManager = "dpkg"
+			details.InstalledSoftware = append(details.InstalledSoftware, models.Software{Name: name, Version: version})
+		}
+	}
+	if details.PackageManager != "" {
+		return
+	}
+
+	for _, line := range strings.Split(rpm, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || fields[0] == "gpg-pubkey" {
+			continue
+		}
+		details.PackageManager = "rpm"
+		software := models.Software{Name: fields[0], Version: fields[1]}
+		if len(fields) > 2 {
+			if installed, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+				software.InstallDate = time.Unix(installed, 0).UTC().Format("2006-01-02")
+			}
+		}
+		details.InstalledSoftware = append(details.InstalledSoftware, software)
+	}
+	if details.PackageManager == "" {
+		details.PackageManager = "unknown"
+	}
+}
+
+// parseServices reads systemd services from systemctl list-units, taking
+// their start mode from systemctl list-unit-files
+func parseServices(units, unitFiles string) []models.Service {
+	startModes := make(map[string]string)
+	for _, line := range strings.Split(unitFiles, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			startModes[fields[0]] = fields[1]
+		}
+	}
+
+	var services []models.Service
+	for _, line := range strings.Split(units, "\n") {
+		// UNIT LOAD ACTIVE SUB DESCRIPTION...
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasSuffix(fields[0], ".service") {
+			continue
+		}
+		services = append(services, models.Service{
+			Name:        strings.TrimSuffix(fields[0], ".service"),
+			Status:      fields[3],
+			Description: strings.Join(fields[4:], " "),
+			StartMode:   startModes[fields[0]],
+		})
+	}
+	return services
+}
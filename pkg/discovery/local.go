@@ -0,0 +1,307 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/host"
+	"github.com/shirou/gopsutil/load"
+	"github.com/shirou/gopsutil/mem"
+	psnet "github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// cpuSampleInterval is how long CPU usage is measured for
+const cpuSampleInterval = time.Second
+
+// LocalDiscoverer implements ServerDiscoverer for the host it runs on,
+// reading the inventory through gopsutil instead of a remote session
+type LocalDiscoverer struct{}
+
+func init() {
+	Register(Method{
+		Name:         MethodLocal,
+		Capabilities: Capabilities{Transport: TransportLocal},
+		New: func(ctx context.Context, env Environment, server models.ServerConfig) (ServerDiscoverer, error) {
+			return &LocalDiscoverer{}, nil
+		},
+	})
+}
+
+// ExecuteDiscovery collects the local host's inventory and saves it as
+// server_details.json in a new directory under outputDir
+func (d *LocalDiscoverer) ExecuteDiscovery(ctx context.Context, server models.ServerConfig, outputDir string) (models.DiscoveryResult, error) {
+	result := models.DiscoveryResult{
+		Status:      "running",
+		LastChecked: time.Now(),
+	}
+
+	details, err := CollectLocal(ctx)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = fmt.Sprintf("local discovery failed: %v", err)
+		return result, err
+	}
+
+	executionDir, err := writeServerDetails(outputDir, details.Hostname, details)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result, err
+	}
+
+	result.OutputPath = executionDir
+	result.Status = "completed"
+	return result, nil
+}
+
+// ParseDiscoveryOutput reads the server_details.json written by ExecuteDiscovery
+func (d *LocalDiscoverer) ParseDiscoveryOutput(outputPath string) (models.ServerDetails, error) {
+	return readServerDetails(outputPath)
+}
+
+// writeServerDetails saves details as server_details.json in a new
+// "<name>_<timestamp>" directory under outputDir, which is returned
+func writeServerDetails(outputDir, name string, details models.ServerDetails) (string, error) {
+	data, err := json.MarshalIndent(details, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode discovery output: %w", err)
+	}
+
+	timestamp := time.Now().Format("20060102_150405")
+	executionDir := filepath.Join(outputDir, fmt.Sprintf("%s_%s", name, timestamp))
+	if err := os.MkdirAll(executionDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create execution directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(executionDir, "server_details.json"), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write discovery output: %w", err)
+	}
+	return executionDir, nil
+}
+
+// readServerDetails reads the server_details.json saved by writeServerDetails
+func readServerDetails(outputPath string) (models.ServerDetails, error) {
+	data, err := os.ReadFile(filepath.Join(outputPath, "server_details.json"))
+	if err != nil {
+		return models.ServerDetails{}, fmt.Errorf("failed to read JSON output: %w", err)
+	}
+
+	var details models.ServerDetails
+	if err := json.Unmarshal(data, &details); err != nil {
+		return models.ServerDetails{}, fmt.Errorf("failed to parse JSON output: %w", err)
+	}
+	return details, nil
+}
+
+// CollectLocal gathers the host, CPU, memory, disk, network, connection and
+// process inventory of the local host. Only a failure to read the host
+// information is an error; sections that cannot be read are logged and left
+// empty.
+func CollectLocal(ctx context.Context) (models.ServerDetails, error) {
+	info, err := host.InfoWithContext(ctx)
+	if err != nil {
+		return models.ServerDetails{}, fmt.Errorf("failed to read host information: %w", err)
+	}
+
+	details := models.ServerDetails{
+		Hostname:      info.Hostname,
+		OSType:        info.OS,
+		OSName:        localOSName(info),
+		OSVersion:     info.PlatformVersion,
+		KernelVersion: info.KernelVersion,
+		LastBootTime:  time.Unix(int64(info.BootTime), 0).UTC(),
+		Metrics:       &models.ServerMetrics{},
+	}
+
+	if cpus, err := cpu.InfoWithContext(ctx); err == nil && len(cpus) > 0 {
+		details.CPUModel = strings.TrimSpace(cpus[0].ModelName)
+	} else if err != nil {
+		log.Printf("Warning: failed to read CPU information: %v", err)
+	}
+	if count, err := cpu.CountsWithContext(ctx, true); err == nil {
+		details.CPUCount = count
+	}
+	if percent, err := cpu.PercentWithContext(ctx, cpuSampleInterval, false); err == nil && len(percent) > 0 {
+		details.Metrics.CPUUsage = math.Round(percent[0]*100) / 100
+	}
+	if avg, err := load.AvgWithContext(ctx); err == nil {
+		details.Metrics.LoadAverage = avg.Load1
+	}
+
+	if vm, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+		details.MemoryTotalGB = roundGB(int64(vm.Total))
+		details.Metrics.MemoryTotal = int64(vm.Total)
+		details.Metrics.MemoryUsed = int64(vm.Total - vm.Available)
+	} else {
+		log.Printf("Warning: failed to read memory usage: %v", err)
+	}
+
+	collectLocalDisks(ctx, &details)
+	collectLocalAddresses(ctx, &details)
+
+	// Processes are read first so that ports can name their owning process
+	processNames := collectLocalProcesses(ctx, &details)
+	collectLocalConnections(ctx, &details, processNames)
+
+	return details, nil
+}
+
+// localOSName returns a readable OS name such as "ubuntu 22.04". On Windows
+// the platform already is the full product name.
+func localOSName(info *host.InfoStat) string {
+	if info.OS == "windows" || info.PlatformVersion == "" {
+		return firstNonEmpty(info.Platform, info.OS)
+	}
+	return info.Platform + " " + info.PlatformVersion
+}
+
+// collectLocalDisks reads the usage of the physical partitions. Devices
+// mounted more than once count towards the disk totals only once.
+func collectLocalDisks(ctx context.Context, details *models.ServerDetails) {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		log.Printf("Warning: failed to list partitions: %v", err)
+		return
+	}
+
+	var diskTotal, diskFree int64
+	counted := make(map[string]bool)
+	for _, partition := range partitions {
+		usage, err := disk.UsageWithContext(ctx, partition.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+		details.Filesystems = append(details.Filesystems, models.Filesystem{
+			MountPoint:  partition.Mountpoint,
+			Device:      partition.Device,
+			FSType:      partition.Fstype,
+			TotalBytes:  int64(usage.Total),
+			UsedBytes:   int64(usage.Used),
+			FreeBytes:   int64(usage.Free),
+			UsedPercent: math.Round(usage.UsedPercent*100) / 100,
+			TotalInodes: int64(usage.InodesTotal),
+			UsedInodes:  int64(usage.InodesUsed),
+			FreeInodes:  int64(usage.InodesFree),
+		})
+		if !counted[partition.Device] {
+			counted[partition.Device] = true
+			diskTotal += int64(usage.Total)
+			diskFree += int64(usage.Free)
+			details.Metrics.DiskTotal += int64(usage.Total)
+			details.Metrics.DiskUsed += int64(usage.Used)
+		}
+	}
+	details.DiskTotalGB = roundGB(diskTotal)
+	details.DiskFreeGB = roundGB(diskFree)
+}
+
+// collectLocalAddresses reads the interface addresses. The first global
+// IPv4 address becomes the server's IP.
+func collectLocalAddresses(ctx context.Context, details *models.ServerDetails) {
+	interfaces, err := psnet.InterfacesWithContext(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to list network interfaces: %v", err)
+		return
+	}
+
+	for _, iface := range interfaces {
+		for _, addr := range iface.Addrs {
+			ip, _, _ := strings.Cut(addr.Addr, "/")
+			details.IPAddresses = append(details.IPAddresses, models.IPAddress{IPAddress: ip, InterfaceName: iface.Name})
+			if parsed := net.ParseIP(ip); details.IP == "" && parsed != nil && parsed.To4() != nil &&
+				!parsed.IsLoopback() && !parsed.IsLinkLocalUnicast() {
+				details.IP = ip
+			}
+		}
+	}
+}
+
+// collectLocalProcesses reads the running processes and returns their names
+// by process ID. Details of processes the agent may not inspect are left empty.
+func collectLocalProcesses(ctx context.Context, details *models.ServerDetails) map[int]string {
+	names := make(map[int]string)
+	processes, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to list processes: %v", err)
+		return names
+	}
+
+	for _, p := range processes {
+		proc := models.Process{ProcessID: int(p.Pid)}
+		proc.Name, _ = p.NameWithContext(ctx)
+		proc.Path, _ = p.ExeWithContext(ctx)
+		proc.CommandLine, _ = p.CmdlineWithContext(ctx)
+		if ppid, err := p.PpidWithContext(ctx); err == nil {
+			proc.ParentProcessID = int(ppid)
+		}
+		if created, err := p.CreateTimeWithContext(ctx); err == nil && created > 0 {
+			start := time.UnixMilli(created).UTC()
+			proc.StartTime = &start
+		}
+		if times, err := p.TimesWithContext(ctx); err == nil {
+			proc.CPUSeconds = math.Round((times.User+times.System)*100) / 100
+		}
+		if memory, err := p.MemoryInfoWithContext(ctx); err == nil {
+			proc.WorkingSetMB = math.Round(float64(memory.RSS)/(1<<20)*100) / 100
+		}
+		if threads, err := p.NumThreadsWithContext(ctx); err == nil {
+			proc.Threads = int(threads)
+		}
+		if fds, err := p.NumFDsWithContext(ctx); err == nil {
+			proc.Handles = int(fds)
+		}
+
+		names[proc.ProcessID] = proc.Name
+		details.Processes = append(details.Processes, proc)
+	}
+	details.Metrics.ProcessCount = len(details.Processes)
+	return names
+}
+
+// collectLocalConnections reads the TCP and UDP sockets
+func collectLocalConnections(ctx context.Context, details *models.ServerDetails, processNames map[int]string) {
+	connections, err := psnet.ConnectionsWithContext(ctx, "inet")
+	if err != nil {
+		log.Printf("Warning: failed to list network connections: %v", err)
+		return
+	}
+
+	for _, c := range connections {
+		protocol := "tcp"
+		if c.Type == 2 { // SOCK_DGRAM
+			protocol = "udp"
+		}
+		port := models.Port{
+			Protocol:    protocol,
+			LocalIP:     c.Laddr.IP,
+			LocalPort:   int(c.Laddr.Port),
+			RemoteIP:    c.Raddr.IP,
+			RemotePort:  int(c.Raddr.Port),
+			State:       c.Status,
+			ProcessName: processNames[int(c.Pid)],
+		}
+		switch c.Status {
+		case "LISTEN":
+			port.State = "LISTENING"
+		case "NONE":
+			port.State = ""
+		}
+		if c.Pid > 0 {
+			pid := int(c.Pid)
+			port.ProcessID = &pid
+		}
+		details.OpenPorts = append(details.OpenPorts, port)
+	}
+}
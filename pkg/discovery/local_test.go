@@ -0,0 +1,51 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestLocalDiscoverer(t *testing.T) {
+	d := &LocalDiscoverer{}
+	result, err := d.ExecuteDiscovery(context.Background(), models.ServerConfig{}, t.TempDir())
+	if err != nil {
+		t.Fatalf("ExecuteDiscovery returned error: %v", err)
+	}
+	if result.Status != "completed" || result.OutputPath == "" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	details, err := d.ParseDiscoveryOutput(result.OutputPath)
+	if err != nil {
+		t.Fatalf("ParseDiscoveryOutput returned error: %v", err)
+	}
+	if details.Hostname == "" || details.OSType == "" || details.CPUCount == 0 || details.MemoryTotalGB == 0 {
+		t.Errorf("host information missing: %+v", details)
+	}
+	if details.Metrics == nil || details.Metrics.ProcessCount == 0 {
+		t.Errorf("process count missing: %+v", details.Metrics)
+	}
+
+	// The test binary itself must be among the processes
+	var self *models.Process
+	for i := range details.Processes {
+		if details.Processes[i].ProcessID == os.Getpid() {
+			self = &details.Processes[i]
+		}
+	}
+	if self == nil || self.Name == "" {
+		t.Errorf("own process %d missing or unnamed: %+v", os.Getpid(), self)
+	}
+
+	for _, fs := range details.Filesystems {
+		if info, err := os.Stat(fs.MountPoint); err != nil || !info.IsDir() {
+			t.Errorf("filesystem mounted on %q, which is not a directory: %v", fs.MountPoint, err)
+		}
+		if fs.TotalBytes <= 0 || fs.UsedBytes+fs.FreeBytes > fs.TotalBytes {
+			t.Errorf("inconsistent usage for %s: %+v", fs.MountPoint, fs)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// psDatePattern matches the Microsoft JSON date format written by
+// ConvertTo-Json, e.g. /Date(1589294613000)/ or /Date(1589294613000+0200)/
+var psDatePattern = regexp.MustCompile(`^/Date\((-?\d+)([+-]\d{4})?\)/$`)
+
+// decodePSText converts the output of PowerShell's Out-File to UTF-8. Windows
+// PowerShell writes UTF-16LE with a byte order mark by default, so UTF-16 in
+// either byte order and UTF-8 with or without a BOM are accepted.
+func decodePSText(data []byte) ([]byte, error) {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return data[3:], nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		order = binary.BigEndian
+	default:
+		return data, nil
+	}
+
+	data = data[2:]
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("truncated UTF-16 text")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+
+	runes := utf16.Decode(units)
+	buf := make([]byte, 0, len(runes))
+	for _, r := range runes {
+		buf = utf8.AppendRune(buf, r)
+	}
+	return buf, nil
+}
+
+// unmarshalPSList decodes a JSON value that ConvertTo-Json may have written
+// as a single object instead of a one-element array, or as nothing at all
+func unmarshalPSList[T any](data []byte) ([]T, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+	if data[0] != '[' {
+		var item T
+		if err := json.Unmarshal(data, &item); err != nil {
+			return nil, err
+		}
+		return []T{item}, nil
+	}
+
+	var items []T
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// psList is a list field that ConvertTo-Json may have collapsed to a single object
+type psList[T any] []T
+
+// UnmarshalJSON implements json.Unmarshaler
+func (l *psList[T]) UnmarshalJSON(data []byte) error {
+	items, err := unmarshalPSList[T](data)
+	if err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+// psTime is a timestamp written by ConvertTo-Json. Windows PowerShell writes
+// DateTime values either as "/Date(ms)/" strings or, for values carrying
+// extended type data, as {"value": "/Date(ms)/", "DateTime": "..."} objects.
+// PowerShell 7 writes ISO 8601 strings.
+type psTime struct {
+	time.Time
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *psTime) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	if data[0] == '{' {
+		var wrapped struct {
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return err
+		}
+		return t.UnmarshalJSON(wrapped.Value)
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid PowerShell date %s", data)
+	}
+	parsed, err := parsePSDate(s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+// ptr returns the time as a pointer, or nil for the zero time
+func (t psTime) ptr() *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	v := t.Time
+	return &v
+}
+
+// parsePSDate parses a "/Date(ms)/" or ISO 8601 timestamp. DateTime.MinValue
+// is mapped onto the zero time.
+func parsePSDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if m := psDatePattern.FindStringSubmatch(s); m != nil {
+		ms, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid PowerShell date %q: %w", s, err)
+		}
+		// The milliseconds are always UTC; the offset only records the writer's zone
+		t := time.UnixMilli(ms).UTC()
+		if m[2] != "" {
+			hours, _ := strconv.Atoi(m[2][1:3])
+			minutes, _ := strconv.Atoi(m[2][3:5])
+			offset := hours*3600 + minutes*60
+			if m[2][0] == '-' {
+				offset = -offset
+			}
+			t = t.In(time.FixedZone("", offset))
+		}
+		if t.Year() <= 1 {
+			return time.Time{}, nil
+		}
+		return t, nil
+	}
+
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.9999999", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid PowerShell date %q", s)
+}
+
+// psEnum is an enumeration value. Windows PowerShell serializes most enums
+// as their numeric value while PowerShell 7 writes their names.
+type psEnum struct {
+	name   string
+	number int
+	isNum  bool
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (e *psEnum) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if data[0] == '"' {
+		return json.Unmarshal(data, &e.name)
+	}
+	if bytes.Equal(data, []byte("true")) || bytes.Equal(data, []byte("false")) {
+		e.name = map[bool]string{true: "True", false: "False"}[data[0] == 't']
+		return nil
+	}
+
+	n, err := strconv.Atoi(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid PowerShell enum value %s", data)
+	}
+	e.number, e.isNum = n, true
+	return nil
+}
+
+// String returns the enum's name, looking numeric values up in names
+func (e psEnum) String(names map[int]string) string {
+	if !e.isNum {
+		return e.name
+	}
+	if name, ok := names[e.number]; ok {
+		return name
+	}
+	return strconv.Itoa(e.number)
+}
+
+// psString is a string field that may hold a number or boolean, such as the
+// registry InstallDate or VLAN ID values
+type psString string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (s *psString) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0 || bytes.Equal(data, []byte("null")):
+		*s = ""
+	case data[0] == '"':
+		var v string
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*s = psString(v)
+	default:
+		*s = psString(data)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+	sshtransport "github.com/vobbilis/codegen/server-discovery/pkg/transport/ssh"
+)
+
+// Names of the built-in discovery methods
+const (
+	MethodLinux   = "linux"
+	MethodWindows = "windows"
+	MethodLocal   = "local"
+	MethodSNMP    = "snmp"
+)
+
+// Transports discovery methods connect over
+const (
+	TransportSSH   = "ssh"
+	TransportWinRM = "winrm"
+	TransportSNMP  = "snmp"
+	TransportLocal = "local"
+)
+
+// Capabilities describe what a discovery method connects over and which
+// servers it is picked for when they have no method of their own
+type Capabilities struct {
+	Transport string   `json:"transport"`
+	OSTypes   []string `json:"os_types,omitempty"` // Matched case-insensitively as substrings of the server's os_type
+}
+
+// Environment holds the shared resources the controller passes to
+// discoverer factories
+type Environment struct {
+	Config  models.Config
+	SSHPool *sshtransport.Pool
+
+	// SSHConfig resolves the SSH settings and credentials for a server
+	SSHConfig func(ctx context.Context, server models.ServerConfig) (models.SSHConfig, error)
+}
+
+// Factory creates the discoverer for one discovery of server
+type Factory func(ctx context.Context, env Environment, server models.ServerConfig) (ServerDiscoverer, error)
+
+// Method is a named way of discovering servers
+type Method struct {
+	Name string `json:"name"`
+	Capabilities
+	New Factory `json:"-"`
+}
+
+// Registry holds discovery methods by name
+type Registry struct {
+	mu      sync.RWMutex
+	methods map[string]Method
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{methods: make(map[string]Method)}
+}
+
+// defaultRegistry holds the methods registered with Register
+var defaultRegistry = NewRegistry()
+
+// Register adds a method to the default registry. It is meant to be called
+// from init functions and panics if the method is invalid or its name is
+// already taken.
+func Register(method Method) {
+	if err := defaultRegistry.Register(method); err != nil {
+		panic(err)
+	}
+}
+
+// DefaultRegistry returns a copy of the methods added with Register, to which
+// callers can add methods of their own
+func DefaultRegistry() *Registry {
+	return defaultRegistry.Clone()
+}
+
+// Register adds a method to the registry
+func (r *Registry) Register(method Method) error {
+	if method.Name == "" || method.New == nil {
+		return fmt.Errorf("discovery method needs a name and a factory")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.methods[method.Name]; ok {
+		return fmt.Errorf("discovery method %q is already registered", method.Name)
+	}
+	r.methods[method.Name] = method
+	return nil
+}
+
+// Lookup returns the method registered as name
+func (r *Registry) Lookup(name string) (Method, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	method, ok := r.methods[name]
+	return method, ok
+}
+
+// Methods returns the registered methods sorted by name
+func (r *Registry) Methods() []Method {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	methods := make([]Method, 0, len(r.methods))
+	for _, method := range r.methods {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+	return methods
+}
+
+// MethodFor returns the name of the method declaring osType, or "" if there
+// is none. Methods are tried in name order.
+func (r *Registry) MethodFor(osType string) string {
+	osType = strings.ToLower(osType)
+	if osType == "" {
+		return ""
+	}
+	for _, method := range r.Methods() {
+		for _, t := range method.OSTypes {
+			if strings.Contains(osType, strings.ToLower(t)) {
+				return method.Name
+			}
+		}
+	}
+	return ""
+}
+
+// New creates the discoverer for server using its Method
+func (r *Registry) New(ctx context.Context, env Environment, server models.ServerConfig) (ServerDiscoverer, error) {
+	method, ok := r.Lookup(server.Method)
+	if !ok {
+		return nil, fmt.Errorf("unknown discovery method %q", server.Method)
+	}
+	return method.New(ctx, env, server)
+}
+
+// Clone returns a copy of the registry
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clone := NewRegistry()
+	for name, method := range r.methods {
+		clone.methods[name] = method
+	}
+	return clone
+}
@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := DefaultRegistry()
+	if _, ok := registry.Lookup(MethodLocal); !ok {
+		t.Fatal("local method is not registered")
+	}
+
+	aix := Method{
+		Name:         "aix",
+		Capabilities: Capabilities{Transport: TransportSSH, OSTypes: []string{"AIX"}},
+		New: func(ctx context.Context, env Environment, server models.ServerConfig) (ServerDiscoverer, error) {
+			return &LocalDiscoverer{}, nil
+		},
+	}
+	if err := registry.Register(aix); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(aix); err == nil {
+		t.Error("expected an error registering a method twice")
+	}
+	if _, ok := DefaultRegistry().Lookup("aix"); ok {
+		t.Error("registering on a copy changed the default registry")
+	}
+
+	for osType, want := range map[string]string{"aix": "aix", "IBM AIX 7.2": "aix", "network": MethodSNMP, "linux": "", "": ""} {
+		if got := registry.MethodFor(osType); got != want {
+			t.Errorf("MethodFor(%q) = %q, want %q", osType, got, want)
+		}
+	}
+
+	var names []string
+	for _, method := range registry.Methods() {
+		names = append(names, method.Name)
+	}
+	if len(names) != 3 || names[0] != "aix" || names[2] != MethodSNMP {
+		t.Errorf("Methods() = %v", names)
+	}
+
+	if _, err := registry.New(context.Background(), Environment{}, models.ServerConfig{Method: "solaris"}); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+}
+
+func TestSNMPConfigFor(t *testing.T) {
+	server := models.ServerConfig{Host: "10.0.0.20", Username: "discovery", Password: "public"}
+	if config := snmpConfigFor(server); config.Host != "10.0.0.20" || config.Community != "public" || config.Username != "" {
+		t.Errorf("SNMPv2c config = %+v", config)
+	}
+
+	server.SNMPVersion, server.Password, server.SNMPPrivPassword = "3", "authpass", "privpass"
+	config := snmpConfigFor(server)
+	if config.Community != "" || config.Username != "discovery" || config.AuthPassword != "authpass" || config.PrivPassword != "privpass" {
+		t.Errorf("SNMPv3 config = %+v", config)
+	}
+}
@@ -0,0 +1,320 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+	"github.com/vobbilis/codegen/server-discovery/pkg/transport/snmp"
+)
+
+// OSTypeNetwork is the OS type of appliances discovered over SNMP
+const OSTypeNetwork = "network"
+
+// Subtrees walked by SNMP discovery
+const (
+	oidSystem        = "1.3.6.1.2.1.1"
+	oidInterfaces    = "1.3.6.1.2.1.2"
+	oidIPAddrTable   = "1.3.6.1.2.1.4.20"
+	oidHrStorage     = "1.3.6.1.2.1.25.2"
+	oidHrSWInstalled = "1.3.6.1.2.1.25.6.3"
+)
+
+// Columns and scalars read from the walked subtrees
+const (
+	oidSysDescr           = "1.3.6.1.2.1.1.1.0"
+	oidSysUpTime          = "1.3.6.1.2.1.1.3.0"
+	oidSysName            = "1.3.6.1.2.1.1.5.0"
+	oidIfDescr            = "1.3.6.1.2.1.2.2.1.2."
+	oidIPAdEntIfIndex     = "1.3.6.1.2.1.4.20.1.2."
+	oidHrMemorySize       = "1.3.6.1.2.1.25.2.2.0"
+	oidHrStorageEntry     = "1.3.6.1.2.1.25.2.3.1."
+	oidHrSWInstalledEntry = "1.3.6.1.2.1.25.6.3.1."
+)
+
+// Columns of hrStorageTable and hrSWInstalledTable
+const (
+	hrStorageType            = "2"
+	hrStorageDescr           = "3"
+	hrStorageAllocationUnits = "4"
+	hrStorageSize            = "5"
+	hrStorageUsed            = "6"
+	hrSWInstalledName        = "2"
+	hrSWInstalledDate        = "5"
+)
+
+// hrStorageTypes names the hrStorageTypes (HOST-RESOURCES-TYPES) reported
+// as filesystems; RAM is read as memory instead
+var hrStorageTypes = map[string]string{
+	"1.3.6.1.2.1.25.2.1.4":  "fixed",
+	"1.3.6.1.2.1.25.2.1.5":  "removable",
+	"1.3.6.1.2.1.25.2.1.7":  "compact-disc",
+	"1.3.6.1.2.1.25.2.1.8":  "ramdisk",
+	"1.3.6.1.2.1.25.2.1.9":  "flash",
+	"1.3.6.1.2.1.25.2.1.10": "network",
+}
+
+// hrStorageRAM is the hrStorageType of physical memory
+const hrStorageRAM = "1.3.6.1.2.1.25.2.1.2"
+
+// SNMPDiscoverer implements ServerDiscoverer for network appliances that
+// offer neither a shell nor WinRM, reading their inventory over SNMP
+type SNMPDiscoverer struct {
+	config snmp.Config
+}
+
+func init() {
+	Register(Method{
+		Name:         MethodSNMP,
+		Capabilities: Capabilities{Transport: TransportSNMP, OSTypes: []string{OSTypeNetwork}},
+		New: func(ctx context.Context, env Environment, server models.ServerConfig) (ServerDiscoverer, error) {
+			return NewSNMPDiscoverer(snmpConfigFor(server)), nil
+		},
+	})
+}
+
+// NewSNMPDiscoverer creates a discoverer for the agent described by config
+func NewSNMPDiscoverer(config snmp.Config) *SNMPDiscoverer {
+	return &SNMPDiscoverer{config: config}
+}
+
+// snmpConfigFor builds the SNMP agent settings for a server. SNMPv2c uses
+// SNMPCommunity, falling back to Password; SNMPv3 authenticates Username
+// with Password.
+func snmpConfigFor(server models.ServerConfig) snmp.Config {
+	config := snmp.Config{
+		Host:         server.Host,
+		Port:         server.SNMPPort,
+		Version:      server.SNMPVersion,
+		Community:    server.SNMPCommunity,
+		AuthProtocol: server.SNMPAuthProtocol,
+		PrivProtocol: server.SNMPPrivProtocol,
+		PrivPassword: server.SNMPPrivPassword,
+	}
+	if config.Version == "3" {
+		config.Username = server.Username
+		config.AuthPassword = server.Password
+	} else if config.Community == "" {
+		config.Community = server.Password
+	}
+	return config
+}
+
+// ExecuteDiscovery walks the device's MIBs and saves the inventory mapped
+// from them as server_details.json in a new directory under outputDir
+func (d *SNMPDiscoverer) ExecuteDiscovery(ctx context.Context, server models.ServerConfig, outputDir string) (models.DiscoveryResult, error) {
+	result := models.DiscoveryResult{
+		Server:      server.Host,
+		Status:      "running",
+		LastChecked: time.Now(),
+	}
+
+	details, err := CollectSNMP(ctx, d.config)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = fmt.Sprintf("SNMP discovery failed: %v", err)
+		return result, err
+	}
+
+	executionDir, err := writeServerDetails(outputDir, d.config.Host, details)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result, err
+	}
+
+	result.OutputPath = executionDir
+	result.Status = "completed"
+	return result, nil
+}
+
+// ParseDiscoveryOutput reads the server_details.json written by ExecuteDiscovery
+func (d *SNMPDiscoverer) ParseDiscoveryOutput(outputPath string) (models.ServerDetails, error) {
+	return readServerDetails(outputPath)
+}
+
+// CollectSNMP walks the system, interfaces, ipAddrTable, hrStorage and
+// hrSWInstalled subtrees of an SNMP agent and maps them onto ServerDetails.
+// Only the system group is required; appliances commonly lack the host
+// resources MIB.
+func CollectSNMP(ctx context.Context, config snmp.Config) (models.ServerDetails, error) {
+	client, err := snmp.Dial(ctx, config)
+	if err != nil {
+		return models.ServerDetails{}, err
+	}
+	defer client.Close()
+
+	var vars []snmp.Variable
+	collect := func(v snmp.Variable) error {
+		vars = append(vars, v)
+		return nil
+	}
+	for _, root := range []string{oidSystem, oidInterfaces, oidIPAddrTable, oidHrStorage, oidHrSWInstalled} {
+		if err := client.Walk(ctx, root, collect); err != nil {
+			return models.ServerDetails{}, fmt.Errorf("failed to walk %s: %w", root, err)
+		}
+	}
+
+	details := SNMPDetails(vars, time.Now())
+	if details.Hostname == "" {
+		return details, fmt.Errorf("agent returned no sysName")
+	}
+	// Prefer the address the device was polled on
+	for _, addr := range details.IPAddresses {
+		if addr.IPAddress == config.Host {
+			details.IP = config.Host
+		}
+	}
+	return details, nil
+}
+
+// SNMPDetails maps walked SNMP variables onto ServerDetails. now is the time
+// sysUpTime is counted back from to find the last boot.
+func SNMPDetails(vars []snmp.Variable, now time.Time) models.ServerDetails {
+	details := models.ServerDetails{
+		OSType:  OSTypeNetwork,
+		Metrics: &models.ServerMetrics{},
+	}
+
+	ifNames := make(map[string]string)
+	addrIfIndex := make(map[string]string)
+	storage := make(map[string]map[string]snmp.Variable)
+	software := make(map[string]map[string]snmp.Variable)
+	var storageOrder, softwareOrder []string
+	var memorySizeKB int64
+
+	for _, v := range vars {
+		switch {
+		case v.OID == oidSysDescr:
+			details.OSName = firstLine(v.String())
+		case v.OID == oidSysName:
+			details.Hostname = v.String()
+		case v.OID == oidSysUpTime:
+			details.LastBootTime = now.Add(-time.Duration(v.Int()) * 10 * time.Millisecond).UTC().Truncate(time.Second)
+		case v.OID == oidHrMemorySize:
+			memorySizeKB = v.Int()
+		case strings.HasPrefix(v.OID, oidIfDescr):
+			ifNames[strings.TrimPrefix(v.OID, oidIfDescr)] = v.String()
+		case strings.HasPrefix(v.OID, oidIPAdEntIfIndex):
+			addrIfIndex[strings.TrimPrefix(v.OID, oidIPAdEntIfIndex)] = v.String()
+		case strings.HasPrefix(v.OID, oidHrStorageEntry):
+			column, index, _ := strings.Cut(strings.TrimPrefix(v.OID, oidHrStorageEntry), ".")
+			if storage[index] == nil {
+				storage[index] = make(map[string]snmp.Variable)
+				storageOrder = append(storageOrder, index)
+			}
+			storage[index][column] = v
+		case strings.HasPrefix(v.OID, oidHrSWInstalledEntry):
+			column, index, _ := strings.Cut(strings.TrimPrefix(v.OID, oidHrSWInstalledEntry), ".")
+			if software[index] == nil {
+				software[index] = make(map[string]snmp.Variable)
+				softwareOrder = append(softwareOrder, index)
+			}
+			software[index][column] = v
+		}
+	}
+
+	// ipAddrTable is indexed by the address itself
+	for _, v := range vars {
+		addr, ok := strings.CutPrefix(v.OID, oidIPAdEntIfIndex)
+		if !ok {
+			continue
+		}
+		details.IPAddresses = append(details.IPAddresses, models.IPAddress{
+			IPAddress:     addr,
+			InterfaceName: ifNames[addrIfIndex[addr]],
+		})
+		if ip := net.ParseIP(addr); details.IP == "" && ip != nil && !ip.IsLoopback() && !ip.IsUnspecified() {
+			details.IP = addr
+		}
+	}
+
+	var diskTotal, diskFree int64
+	for _, index := range storageOrder {
+		row := storage[index]
+		units := row[hrStorageAllocationUnits].Int()
+		total, used := row[hrStorageSize].Int()*units, row[hrStorageUsed].Int()*units
+		storageType := row[hrStorageType].String()
+
+		if storageType == hrStorageRAM {
+			details.Metrics.MemoryTotal = total
+			details.Metrics.MemoryUsed = used
+			continue
+		}
+		fsType, ok := hrStorageTypes[storageType]
+		if !ok || total <= 0 {
+			continue
+		}
+		fs := models.Filesystem{
+			MountPoint: row[hrStorageDescr].String(),
+			FSType:     fsType,
+			TotalBytes: total,
+			UsedBytes:  used,
+			FreeBytes:  total - used,
+		}
+		fs.UsedPercent = math.Round(float64(used)/float64(total)*10000) / 100
+		details.Filesystems = append(details.Filesystems, fs)
+		if fsType == "fixed" {
+			diskTotal += total
+			diskFree += total - used
+			details.Metrics.DiskTotal += total
+			details.Metrics.DiskUsed += used
+		}
+	}
+	if details.Metrics.MemoryTotal == 0 {
+		details.Metrics.MemoryTotal = memorySizeKB * 1024
+	}
+	details.MemoryTotalGB = roundGB(details.Metrics.MemoryTotal)
+	details.DiskTotalGB = roundGB(diskTotal)
+	details.DiskFreeGB = roundGB(diskFree)
+
+	for _, index := range softwareOrder {
+		row := software[index]
+		if row[hrSWInstalledName].String() == "" {
+			continue
+		}
+		name, version := splitPackageVersion(row[hrSWInstalledName].String())
+		details.InstalledSoftware = append(details.InstalledSoftware, models.Software{
+			Name:        name,
+			Version:     version,
+			InstallDate: snmpDate(row[hrSWInstalledDate].Bytes()),
+		})
+	}
+
+	return details
+}
+
+// splitPackageVersion splits an hrSWInstalledName such as
+// "openssl-libs-1.1.1k-9.el8" at the first dash or space followed by a digit.
+// Names without a version are returned whole.
+func splitPackageVersion(name string) (string, string) {
+	for i := 1; i < len(name)-1; i++ {
+		if (name[i] == '-' || name[i] == ' ') && unicode.IsDigit(rune(name[i+1])) {
+			return name[:i], name[i+1:]
+		}
+	}
+	return name, ""
+}
+
+// snmpDate formats the date of an SNMPv2-TC DateAndTime value as YYYY-MM-DD
+func snmpDate(b []byte) string {
+	if len(b) < 4 {
+		return ""
+	}
+	year := int(b[0])<<8 | int(b[1])
+	if year == 0 || b[2] == 0 || b[3] == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", year, b[2], b[3])
+}
+
+// firstLine returns the first line of s, trimmed
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return strings.TrimSpace(strings.TrimRightFunc(line, func(r rune) bool { return r == '\r' || r == 0 }))
+}
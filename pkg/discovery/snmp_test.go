@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+	"github.com/vobbilis/codegen/server-discovery/pkg/transport/snmp"
+)
+
+// applianceMIB is what a storage appliance running net-snmp answers with
+var applianceMIB = []snmp.Variable{
+	{OID: "1.3.6.1.2.1.1.1.0", Type: snmp.OctetString, Value: []byte("NAS OS 7.1\r\nBuild 2291")},
+	{OID: "1.3.6.1.2.1.1.3.0", Type: snmp.TimeTicks, Value: uint64(360000)},
+	{OID: "1.3.6.1.2.1.1.5.0", Type: snmp.OctetString, Value: []byte("nas01")},
+	{OID: "1.3.6.1.2.1.2.1.0", Type: snmp.Integer, Value: int64(2)},
+	{OID: "1.3.6.1.2.1.2.2.1.2.1", Type: snmp.OctetString, Value: []byte("lo")},
+	{OID: "1.3.6.1.2.1.2.2.1.2.2", Type: snmp.OctetString, Value: []byte("eth0")},
+	{OID: "1.3.6.1.2.1.4.20.1.1.10.0.0.20", Type: snmp.IPAddress, Value: "10.0.0.20"},
+	{OID: "1.3.6.1.2.1.4.20.1.1.127.0.0.1", Type: snmp.IPAddress, Value: "127.0.0.1"},
+	{OID: "1.3.6.1.2.1.4.20.1.2.10.0.0.20", Type: snmp.Integer, Value: int64(2)},
+	{OID: "1.3.6.1.2.1.4.20.1.2.127.0.0.1", Type: snmp.Integer, Value: int64(1)},
+	{OID: "1.3.6.1.2.1.25.2.2.0", Type: snmp.Integer, Value: int64(4194304)},
+	{OID: "1.3.6.1.2.1.25.2.3.1.2.1", Type: snmp.ObjectIdentifier, Value: "1.3.6.1.2.1.25.2.1.2"},
+	{OID: "1.3.6.1.2.1.25.2.3.1.2.31", Type: snmp.ObjectIdentifier, Value: "1.3.6.1.2.1.25.2.1.4"},
+	{OID: "1.3.6.1.2.1.25.2.3.1.3.1", Type: snmp.OctetString, Value: []byte("Physical memory")},
+	{OID: "1.3.6.1.2.1.25.2.3.1.3.31", Type: snmp.OctetString, Value: []byte("/volume1")},
+	{OID: "1.3.6.1.2.1.25.2.3.1.4.1", Type: snmp.Integer, Value: int64(1024)},
+	{OID: "1.3.6.1.2.1.25.2.3.1.4.31", Type: snmp.Integer, Value: int64(4096)},
+	{OID: "1.3.6.1.2.1.25.2.3.1.5.1", Type: snmp.Integer, Value: int64(8388608)},
+	{OID: "1.3.6.1.2.1.25.2.3.1.5.31", Type: snmp.Integer, Value: int64(26214400)},
+	{OID: "1.3.6.1.2.1.25.2.3.1.6.1", Type: snmp.Integer, Value: int64(2097152)},
+	{OID: "1.3.6.1.2.1.25.2.3.1.6.31", Type: snmp.Integer, Value: int64(6553600)},
+	{OID: "1.3.6.1.2.1.25.6.3.1.2.1", Type: snmp.OctetString, Value: []byte("openssl-libs-1.1.1k-9.el8")},
+	{OID: "1.3.6.1.2.1.25.6.3.1.2.2", Type: snmp.OctetString, Value: []byte("nas-firmware")},
+	{OID: "1.3.6.1.2.1.25.6.3.1.5.1", Type: snmp.OctetString, Value: []byte{0x07, 0xe8, 3, 14, 10, 30, 0, 0}},
+	{OID: "1.3.6.1.2.1.25.6.3.1.5.2", Type: snmp.OctetString, Value: []byte{0, 0, 1, 1, 0, 0, 0, 0}},
+	{OID: "1.3.6.1.2.1.31.1.1.1.1.2", Type: snmp.OctetString, Value: []byte("outside the walked subtrees")},
+}
+
+func TestSNMPDetails(t *testing.T) {
+	details := SNMPDetails(applianceMIB, time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC))
+
+	if got := details.LastBootTime.Format("2006-01-02T15:04:05Z"); got != "2024-03-20T11:00:00Z" {
+		t.Errorf("LastBootTime = %s", got)
+	}
+	if details.IP != "10.0.0.20" {
+		t.Errorf("IP = %s, want the first non-loopback address", details.IP)
+	}
+	if details.MemoryTotalGB != 8 || details.Metrics.MemoryUsed != 2<<30 {
+		t.Errorf("unexpected memory: %.2f GB, %d used", details.MemoryTotalGB, details.Metrics.MemoryUsed)
+	}
+
+	if len(details.Filesystems) != 1 {
+		t.Fatalf("got %d filesystems, want 1: %+v", len(details.Filesystems), details.Filesystems)
+	}
+	fs := details.Filesystems[0]
+	if fs.MountPoint != "/volume1" || fs.FSType != "fixed" || fs.TotalBytes != 100<<30 || fs.UsedPercent != 25 {
+		t.Errorf("unexpected filesystem: %+v", fs)
+	}
+	if details.DiskTotalGB != 100 || details.DiskFreeGB != 75 {
+		t.Errorf("disk totals = %.2f/%.2f, want 100/75", details.DiskTotalGB, details.DiskFreeGB)
+	}
+
+	want := []models.Software{
+		{Name: "openssl-libs", Version: "1.1.1k-9.el8", InstallDate: "2024-03-14"},
+		{Name: "nas-firmware"},
+	}
+	if len(details.InstalledSoftware) != len(want) {
+		t.Fatalf("got software %+v, want %+v", details.InstalledSoftware, want)
+	}
+	for i, sw := range details.InstalledSoftware {
+		if sw != want[i] {
+			t.Errorf("software %d = %+v, want %+v", i, sw, want[i])
+		}
+	}
+}
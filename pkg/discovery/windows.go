@@ -0,0 +1,180 @@
+package discovery
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/masterzen/winrm"
+)
+
+// Markers framing the base64-encoded bundle on stdout
+const (
+	bundleBeginMarker = "<<<SERVER-DISCOVERY-BUNDLE"
+	bundleEndMarker   = "SERVER-DISCOVERY-BUNDLE>>>"
+)
+
+// zipPathPattern matches the archive path Enhanced-ServerDiscovery.ps1 logs
+// once it has zipped its output folder
+var zipPathPattern = regexp.MustCompile(`(?m)ZIP archive: (.+\.zip)\s*$`)
+
+// RunWindowsDiscovery runs the discovery script on a Windows server over
+// WinRM, then streams the zipped bundle it leaves on the host back over
+// stdout and unpacks it into a new directory under outputDir. It returns the
+// local output directory.
+func RunWindowsDiscovery(ctx context.Context, client *winrm.Client, host, script, transfer, outputDir string) (string, error) {
+	stdout, err := runDiscoveryScript(ctx, client, host, script, transfer)
+	if err != nil {
+		return "", fmt.Errorf("failed to run discovery script: %w", err)
+	}
+
+	remoteZip, err := bundlePath(stdout)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		cleanup := fmt.Sprintf("Remove-Item -LiteralPath %[1]s, ((%[1]s) -replace '\\.zip$', '') -Recurse -Force",
+			psQuote(remoteZip))
+		if _, err := RunPowerShell(cleanupCtx, client, cleanup); err != nil {
+			log.Printf("Warning: failed to clean up %s on %s: %v", remoteZip, host, err)
+		}
+	}()
+
+	bundle, err := downloadBundle(ctx, client, remoteZip)
+	if err != nil {
+		return "", err
+	}
+
+	// Create a unique output directory for this execution
+	timestamp := time.Now().Format("20060102_150405")
+	executionDir := filepath.Join(outputDir, fmt.Sprintf("%s_%s", host, timestamp))
+	if err := os.MkdirAll(executionDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create execution directory: %w", err)
+	}
+	if err := extractZip(bundle, executionDir); err != nil {
+		return "", fmt.Errorf("failed to unpack discovery bundle: %w", err)
+	}
+
+	return executionDir, nil
+}
+
+// PowerShellCommand returns a powershell.exe command line running script.
+// -EncodedCommand takes base64 of the UTF-16LE script text.
+func PowerShellCommand(script string) string {
+	units := utf16.Encode([]rune(script))
+	data := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(data[2*i:], u)
+	}
+	return "powershell.exe -NoProfile -NonInteractive -ExecutionPolicy Bypass -EncodedCommand " +
+		base64.StdEncoding.EncodeToString(data)
+}
+
+// psQuote quotes s as a PowerShell single-quoted string literal
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// bundlePath finds the archive path in the discovery script's output
+func bundlePath(stdout string) (string, error) {
+	matches := zipPathPattern.FindAllStringSubmatch(stdout, -1)
+	if len(matches) == 0 {
+		return "", fmt.Errorf("discovery script did not report a ZIP archive")
+	}
+	return strings.TrimSpace(matches[len(matches)-1][1]), nil
+}
+
+// downloadBundle reads a file from the Windows host as base64 on stdout
+func downloadBundle(ctx context.Context, client *winrm.Client, remotePath string) ([]byte, error) {
+	script := fmt.Sprintf("$ErrorActionPreference = 'Stop'\n"+
+		"$data = [Convert]::ToBase64String([IO.File]::ReadAllBytes(%s))\n"+
+		"[Console]::Out.Write('%s' + $data + '%s')\n",
+		psQuote(remotePath), bundleBeginMarker, bundleEndMarker)
+
+	stdout, err := RunPowerShell(ctx, client, script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download discovery bundle: %w", err)
+	}
+	return decodeBundle(stdout)
+}
+
+// decodeBundle extracts and decodes the base64 text between the bundle markers
+func decodeBundle(stdout string) ([]byte, error) {
+	start := strings.Index(stdout, bundleBeginMarker)
+	end := strings.LastIndex(stdout, bundleEndMarker)
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("discovery bundle missing from output")
+	}
+	encoded := strings.Join(strings.Fields(stdout[start+len(bundleBeginMarker):end]), "")
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode discovery bundle: %w", err)
+	}
+	return data, nil
+}
+
+// extractZip unpacks a zip archive into dir. Entries written by .NET
+// Framework's ZipFile may use backslash separators; entries that would
+// escape dir are rejected.
+func extractZip(data []byte, dir string) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range reader.File {
+		name := path.Clean(strings.ReplaceAll(file.Name, `\`, "/"))
+		if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("invalid path %q in archive", file.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		if file.FileInfo().IsDir() || strings.HasSuffix(file.Name, "/") || strings.HasSuffix(file.Name, `\`) {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := writeZipFile(file, target); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// writeZipFile copies a single archive entry to target
+func writeZipFile(file *zip.File, target string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,453 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+const bytesPerGB = 1 << 30
+
+// Numeric enum values written by Windows PowerShell
+var (
+	serviceStatusNames = map[int]string{
+		1: "Stopped", 2: "StartPending", 3: "StopPending", 4: "Running",
+		5: "ContinuePending", 6: "PausePending", 7: "Paused",
+	}
+	serviceStartTypeNames = map[int]string{
+		0: "Boot", 1: "System", 2: "Automatic", 3: "Manual", 4: "Disabled",
+	}
+	tcpStateNames = map[int]string{
+		1: "Closed", 2: "Listen", 3: "SynSent", 4: "SynReceived", 5: "Established",
+		6: "FinWait1", 7: "FinWait2", 8: "CloseWait", 9: "Closing", 10: "LastAck",
+		11: "TimeWait", 12: "DeleteTCB", 100: "Bound",
+	}
+	firewallEnabledNames   = map[int]string{1: "True", 2: "False"}
+	firewallDirectionNames = map[int]string{1: "Inbound", 2: "Outbound"}
+	firewallActionNames    = map[int]string{0: "NotConfigured", 2: "Allow", 4: "Block"}
+	addressFamilyNames     = map[int]string{2: "IPv4", 23: "IPv6"}
+)
+
+// portStates maps Get-NetTCPConnection states onto the netstat-style names
+// stored in open_ports
+var portStates = map[string]string{
+	"closed":      "CLOSED",
+	"listen":      "LISTENING",
+	"synsent":     "SYN_SENT",
+	"synreceived": "SYN_RECEIVED",
+	"established": "ESTABLISHED",
+	"finwait1":    "FIN_WAIT_1",
+	"finwait2":    "FIN_WAIT_2",
+	"closewait":   "CLOSE_WAIT",
+	"closing":     "CLOSING",
+	"lastack":     "LAST_ACK",
+	"timewait":    "TIME_WAIT",
+	"deletetcb":   "DELETE_TCB",
+	"bound":       "BOUND",
+}
+
+// Records written by Enhanced-ServerDiscovery.ps1, limited to the fields
+// mapped onto models.ServerDetails
+type (
+	psSystemInfo struct {
+		CsName                      string `json:"CsName"`
+		CsDNSHostName               string `json:"CsDNSHostName"`
+		CsNumberOfLogicalProcessors int    `json:"CsNumberOfLogicalProcessors"`
+		CsTotalPhysicalMemory       int64  `json:"CsTotalPhysicalMemory"`
+		OsName                      string `json:"OsName"`
+		OsVersion                   string `json:"OsVersion"`
+		OsLastBootUpTime            psTime `json:"OsLastBootUpTime"`
+		WindowsProductName          string `json:"WindowsProductName"`
+	}
+
+	psHardwareInfo struct {
+		Processor psList[struct {
+			Name                      string `json:"Name"`
+			NumberOfLogicalProcessors int    `json:"NumberOfLogicalProcessors"`
+		}] `json:"Processor"`
+		PhysicalMemory psList[struct {
+			Capacity int64 `json:"Capacity"`
+		}] `json:"PhysicalMemory"`
+		LogicalDisks psList[struct {
+			DeviceID   string `json:"DeviceID"`
+			DriveType  int    `json:"DriveType"`
+			FileSystem string `json:"FileSystem"`
+			Size       int64  `json:"Size"`
+			FreeSpace  int64  `json:"FreeSpace"`
+		}] `json:"LogicalDisks"`
+	}
+
+	psOSInfo struct {
+		CSName         string `json:"CSName"`
+		Caption        string `json:"Caption"`
+		Version        string `json:"Version"`
+		LastBootUpTime psTime `json:"LastBootUpTime"`
+	}
+
+	psIPAddress struct {
+		IPAddress      string `json:"IPAddress"`
+		InterfaceAlias string `json:"InterfaceAlias"`
+		AddressFamily  psEnum `json:"AddressFamily"`
+	}
+
+	psTCPConnection struct {
+		LocalAddress  string `json:"LocalAddress"`
+		LocalPort     int    `json:"LocalPort"`
+		RemoteAddress string `json:"RemoteAddress"`
+		RemotePort    int    `json:"RemotePort"`
+		State         psEnum `json:"State"`
+		OwningProcess int    `json:"OwningProcess"`
+		LocalService  string `json:"LocalService"`
+	}
+
+	psUDPEndpoint struct {
+		LocalAddress  string `json:"LocalAddress"`
+		LocalPort     int    `json:"LocalPort"`
+		OwningProcess int    `json:"OwningProcess"`
+		LocalService  string `json:"LocalService"`
+	}
+
+	psProcess struct {
+		ProcessID       int     `json:"ProcessId"`
+		ProcessName     string  `json:"ProcessName"`
+		Path            string  `json:"Path"`
+		CommandLine     string  `json:"CommandLine"`
+		StartTime       psTime  `json:"StartTime"`
+		CPU             float64 `json:"CPU"`
+		WorkingSetMB    float64 `json:"WorkingSetMB"`
+		Threads         int     `json:"Threads"`
+		Handles         int     `json:"Handles"`
+		ParentProcessID int     `json:"ParentProcessId"`
+	}
+
+	psService struct {
+		Name        string `json:"Name"`
+		DisplayName string `json:"DisplayName"`
+		Status      psEnum `json:"Status"`
+		StartType   psEnum `json:"StartType"`
+		Description string `json:"Description"`
+	}
+
+	psSoftware struct {
+		DisplayName    string   `json:"DisplayName"`
+		DisplayVersion psString `json:"DisplayVersion"`
+		InstallDate    psString `json:"InstallDate"`
+	}
+
+	psFirewallRule struct {
+		Name        string `json:"Name"`
+		DisplayName string `json:"DisplayName"`
+		Description string `json:"Description"`
+		Enabled     psEnum `json:"Enabled"`
+		Direction   psEnum `json:"Direction"`
+		Action      psEnum `json:"Action"`
+		Profile     psEnum `json:"Profile"`
+	}
+
+	psRoute struct {
+		DestinationPrefix string `json:"DestinationPrefix"`
+		NextHop           string `json:"NextHop"`
+		InterfaceAlias    string `json:"InterfaceAlias"`
+		RouteMetric       int    `json:"RouteMetric"`
+		AddressFamily     psEnum `json:"AddressFamily"`
+	}
+
+	psDNSSetting struct {
+		InterfaceAlias  string         `json:"InterfaceAlias"`
+		AddressFamily   psEnum         `json:"AddressFamily"`
+		ServerAddresses psList[string] `json:"ServerAddresses"`
+	}
+
+	psUpdate struct {
+		HotFixID    string `json:"HotFixID"`
+		Description string `json:"Description"`
+		InstalledOn psTime `json:"InstalledOn"`
+		InstalledBy string `json:"InstalledBy"`
+	}
+)
+
+// ParseWindowsBundle builds server details from the files written by
+// Enhanced-ServerDiscovery.ps1 into dir. Missing files are skipped; a file
+// that cannot be decoded is an error.
+func ParseWindowsBundle(dir string) (models.ServerDetails, error) {
+	b := bundleReader{dir: dir}
+	details := models.ServerDetails{OSType: "windows"}
+
+	var system psSystemInfo
+	b.readObject("system_info.json", &system)
+	var osInfo psOSInfo
+	b.readObject("os_info.json", &osInfo)
+	var hardware psHardwareInfo
+	b.readObject("hardware_info.json", &hardware)
+
+	details.Hostname = firstNonEmpty(system.CsDNSHostName, system.CsName, osInfo.CSName)
+	details.OSName = firstNonEmpty(osInfo.Caption, system.OsName, system.WindowsProductName)
+	details.OSVersion = firstNonEmpty(osInfo.Version, system.OsVersion)
+	if !osInfo.LastBootUpTime.IsZero() {
+		details.LastBootTime = osInfo.LastBootUpTime.Time
+	} else {
+		details.LastBootTime = system.OsLastBootUpTime.Time
+	}
+
+	// Processor and memory
+	for _, cpu := range hardware.Processor {
+		if details.CPUModel == "" {
+			details.CPUModel = strings.TrimSpace(cpu.Name)
+		}
+		details.CPUCount += cpu.NumberOfLogicalProcessors
+	}
+	if details.CPUCount == 0 {
+		details.CPUCount = system.CsNumberOfLogicalProcessors
+	}
+	var memory int64
+	for _, module := range hardware.PhysicalMemory {
+		memory += module.Capacity
+	}
+	if memory == 0 {
+		memory = system.CsTotalPhysicalMemory
+	}
+	details.MemoryTotalGB = roundGB(memory)
+
+	// Local fixed disks (DriveType 3)
+	var diskTotal, diskFree int64
+	for _, disk := range hardware.LogicalDisks {
+		if disk.DriveType != 3 || disk.Size == 0 {
+			continue
+		}
+		details.Filesystems = append(details.Filesystems, models.Filesystem{
+			Device:      disk.DeviceID,
+			MountPoint:  disk.DeviceID + `\`,
+			FSType:      disk.FileSystem,
+			TotalBytes:  disk.Size,
+			UsedBytes:   disk.Size - disk.FreeSpace,
+			FreeBytes:   disk.FreeSpace,
+			UsedPercent: math.Round(float64(disk.Size-disk.FreeSpace)/float64(disk.Size)*10000) / 100,
+		})
+		diskTotal += disk.Size
+		diskFree += disk.FreeSpace
+	}
+	details.DiskTotalGB = roundGB(diskTotal)
+	details.DiskFreeGB = roundGB(diskFree)
+
+	// Addresses
+	for _, ip := range readList[psIPAddress](&b, "ip_addresses.json") {
+		details.IPAddresses = append(details.IPAddresses, models.IPAddress{IPAddress: ip.IPAddress, InterfaceName: ip.InterfaceAlias})
+		if details.IP == "" && ip.AddressFamily.String(addressFamilyNames) == "IPv4" &&
+			!strings.HasPrefix(ip.IPAddress, "127.") && !strings.HasPrefix(ip.IPAddress, "169.254.") {
+			details.IP = ip.IPAddress
+		}
+	}
+
+	// Processes are read first so that ports can name their owning process
+	processNames := make(map[int]string)
+	for _, p := range readList[psProcess](&b, "process_details.json") {
+		processNames[p.ProcessID] = p.ProcessName
+		details.Processes = append(details.Processes, models.Process{
+			ProcessID:       p.ProcessID,
+			ParentProcessID: p.ParentProcessID,
+			Name:            p.ProcessName,
+			Path:            p.Path,
+			CommandLine:     p.CommandLine,
+			StartTime:       p.StartTime.ptr(),
+			CPUSeconds:      p.CPU,
+			WorkingSetMB:    p.WorkingSetMB,
+			Threads:         p.Threads,
+			Handles:         p.Handles,
+		})
+	}
+
+	for _, c := range readList[psTCPConnection](&b, "tcp_connections.json") {
+		details.OpenPorts = append(details.OpenPorts, newPort("tcp", c.LocalAddress, c.LocalPort, c.OwningProcess, c.LocalService, processNames, func(p *models.Port) {
+			p.RemoteIP = c.RemoteAddress
+			p.RemotePort = c.RemotePort
+			state := c.State.String(tcpStateNames)
+			if mapped, ok := portStates[strings.ToLower(state)]; ok {
+				state = mapped
+			}
+			p.State = state
+		}))
+	}
+	for _, e := range readList[psUDPEndpoint](&b, "udp_endpoints.json") {
+		details.OpenPorts = append(details.OpenPorts, newPort("udp", e.LocalAddress, e.LocalPort, e.OwningProcess, e.LocalService, processNames, nil))
+	}
+
+	// Services and software
+	for _, s := range readList[psService](&b, "service_details.json") {
+		details.Services = append(details.Services, models.Service{
+			Name:        s.Name,
+			DisplayName: s.DisplayName,
+			Description: s.Description,
+			Status:      s.Status.String(serviceStatusNames),
+			StartMode:   s.StartType.String(serviceStartTypeNames),
+		})
+	}
+	for _, s := range readList[psSoftware](&b, "installed_software.json") {
+		details.InstalledSoftware = append(details.InstalledSoftware, models.Software{
+			Name:        s.DisplayName,
+			Version:     string(s.DisplayVersion),
+			InstallDate: string(s.InstallDate),
+		})
+	}
+	for _, u := range readList[psUpdate](&b, "windows_updates.json") {
+		details.Updates = append(details.Updates, models.WindowsUpdate{
+			HotFixID:    u.HotFixID,
+			Description: u.Description,
+			InstalledOn: u.InstalledOn.ptr(),
+			InstalledBy: u.InstalledBy,
+		})
+	}
+
+	// Network configuration
+	for _, r := range readList[psFirewallRule](&b, "firewall_rules.json") {
+		details.FirewallRules = append(details.FirewallRules, models.FirewallRule{
+			Name:        r.Name,
+			DisplayName: r.DisplayName,
+			Description: r.Description,
+			Enabled:     strings.EqualFold(r.Enabled.String(firewallEnabledNames), "True"),
+			Direction:   r.Direction.String(firewallDirectionNames),
+			Action:      r.Action.String(firewallActionNames),
+			Profile:     firewallProfile(r.Profile),
+		})
+	}
+	for _, r := range readList[psRoute](&b, "routing_table.json") {
+		details.Routes = append(details.Routes, models.Route{
+			DestinationPrefix: r.DestinationPrefix,
+			NextHop:           r.NextHop,
+			InterfaceAlias:    r.InterfaceAlias,
+			Metric:            r.RouteMetric,
+			AddressFamily:     r.AddressFamily.String(addressFamilyNames),
+		})
+	}
+	for _, d := range readList[psDNSSetting](&b, "dns_settings.json") {
+		details.DNSSettings = append(details.DNSSettings, models.DNSSetting{
+			InterfaceAlias:  d.InterfaceAlias,
+			AddressFamily:   d.AddressFamily.String(addressFamilyNames),
+			ServerAddresses: d.ServerAddresses,
+		})
+	}
+
+	if b.err != nil {
+		return models.ServerDetails{}, b.err
+	}
+	if b.found == 0 {
+		return models.ServerDetails{}, fmt.Errorf("no Windows discovery output found in %s", dir)
+	}
+	return details, nil
+}
+
+// bundleReader reads files from a discovery bundle, remembering the first
+// error so that parsing can proceed without checking every read
+type bundleReader struct {
+	dir   string
+	found int
+	err   error
+}
+
+// read returns the UTF-8 contents of a bundle file, or nil if it is missing
+func (b *bundleReader) read(name string) []byte {
+	if b.err != nil {
+		return nil
+	}
+	raw, err := os.ReadFile(filepath.Join(b.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		b.err = fmt.Errorf("failed to read %s: %w", name, err)
+		return nil
+	}
+	data, err := decodePSText(raw)
+	if err != nil {
+		b.err = fmt.Errorf("failed to decode %s: %w", name, err)
+		return nil
+	}
+	b.found++
+	return data
+}
+
+// readObject decodes a bundle file holding a single object into v
+func (b *bundleReader) readObject(name string, v interface{}) {
+	data := b.read(name)
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		b.err = fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+}
+
+// readList decodes a bundle file holding a list of records
+func readList[T any](b *bundleReader, name string) []T {
+	data := b.read(name)
+	if data == nil {
+		return nil
+	}
+	items, err := unmarshalPSList[T](data)
+	if err != nil {
+		b.err = fmt.Errorf("failed to parse %s: %w", name, err)
+		return nil
+	}
+	return items
+}
+
+// newPort builds an open port record, naming the owning process and the
+// well-known service on the local port
+func newPort(protocol, localIP string, localPort, pid int, service string, processNames map[int]string, fill func(*models.Port)) models.Port {
+	port := models.Port{
+		Protocol:    protocol,
+		LocalIP:     localIP,
+		LocalPort:   localPort,
+		ProcessName: processNames[pid],
+	}
+	if service != "Unknown" {
+		port.Description = service
+	}
+	if pid > 0 {
+		p := pid
+		port.ProcessID = &p
+	}
+	if fill != nil {
+		fill(&port)
+	}
+	return port
+}
+
+// firewallProfile converts the firewall profile flags into a readable list
+func firewallProfile(e psEnum) string {
+	if !e.isNum {
+		return e.name
+	}
+	if e.number == 0 {
+		return "Any"
+	}
+	var names []string
+	for bit, name := range map[int]string{1: "Domain", 2: "Private", 4: "Public"} {
+		if e.number&bit != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// roundGB converts bytes to gigabytes rounded to two decimals
+func roundGB(b int64) float64 {
+	return math.Round(float64(b)/bytesPerGB*100) / 100
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
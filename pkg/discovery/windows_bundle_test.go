@@ -0,0 +1,143 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// writeUTF16 writes s the way Windows PowerShell's Out-File does by default
+func writeUTF16(t *testing.T, path, s string) {
+	t.Helper()
+	units := utf16.Encode([]rune(s))
+	data := make([]byte, 2+2*len(units))
+	data[0], data[1] = 0xFF, 0xFE
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(data[2+2*i:], u)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseWindowsBundle(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"system_info.json": `{"CsName": "WIN-APP01", "CsDNSHostName": "win-app01", "OsName": "Microsoft Windows Server 2019 Standard",
+			"CsNumberOfLogicalProcessors": 4, "CsTotalPhysicalMemory": 17179869184, "OsLastBootUpTime": "\/Date(1700000000000)\/"}`,
+		"os_info.json": `{"Caption": "Microsoft Windows Server 2019 Standard", "Version": "10.0.17763",
+			"LastBootUpTime": {"value": "\/Date(1700000000000+0100)\/", "DisplayHint": 2, "DateTime": "Tuesday, November 14, 2023 10:13:20 PM"}}`,
+		"hardware_info.json": `{"Processor": {"Name": "Intel(R) Xeon(R) Gold 6230 CPU @ 2.10GHz ", "NumberOfLogicalProcessors": 4},
+			"PhysicalMemory": [{"Capacity": 8589934592}, {"Capacity": 8589934592}],
+			"LogicalDisks": [{"DeviceID": "C:", "DriveType": 3, "FileSystem": "NTFS", "Size": 107374182400, "FreeSpace": 53687091200},
+				{"DeviceID": "D:", "DriveType": 5, "FileSystem": null, "Size": null, "FreeSpace": null}]}`,
+		"ip_addresses.json": `[{"IPAddress": "fe80::1", "InterfaceAlias": "Ethernet", "AddressFamily": 23},
+			{"IPAddress": "127.0.0.1", "InterfaceAlias": "Loopback Pseudo-Interface 1", "AddressFamily": 2},
+			{"IPAddress": "10.1.2.3", "InterfaceAlias": "Ethernet", "AddressFamily": 2}]`,
+		"process_details.json": `{"ProcessId": 1044, "ProcessName": "svchost", "StartTime": {"value": "\/Date(1700000100000)\/"}, "CPU": 1.5, "Threads": 12}`,
+		"tcp_connections.json": `[{"LocalAddress": "0.0.0.0", "LocalPort": 135, "RemoteAddress": "0.0.0.0", "RemotePort": 0, "State": 2, "OwningProcess": 1044, "LocalService": "RPC"},
+			{"LocalAddress": "10.1.2.3", "LocalPort": 50123, "RemoteAddress": "10.1.2.9", "RemotePort": 443, "State": "Established", "OwningProcess": 0, "LocalService": "Unknown"}]`,
+		"udp_endpoints.json":      `{"LocalAddress": "0.0.0.0", "LocalPort": 123, "OwningProcess": 1044, "LocalService": "NTP"}`,
+		"service_details.json":    `[{"Name": "W32Time", "DisplayName": "Windows Time", "Status": 4, "StartType": 3}]`,
+		"installed_software.json": `[{"DisplayName": "7-Zip 19.00", "DisplayVersion": "19.00", "InstallDate": 20230115}]`,
+		"firewall_rules.json":     `{"Name": "RDP-In", "DisplayName": "Remote Desktop", "Enabled": 1, "Direction": 1, "Action": 2, "Profile": 6}`,
+		"dns_settings.json":       `{"InterfaceAlias": "Ethernet", "AddressFamily": 2, "ServerAddresses": "10.1.0.1"}`,
+		"windows_updates.json":    `[{"HotFixID": "KB5005568", "InstalledOn": {"value": "\/Date(1631577600000)\/"}}]`,
+	}
+	for name, content := range files {
+		writeUTF16(t, filepath.Join(dir, name), content)
+	}
+
+	details, err := ParseWindowsBundle(dir)
+	if err != nil {
+		t.Fatalf("ParseWindowsBundle returned error: %v", err)
+	}
+
+	if details.Hostname != "win-app01" || details.OSType != "windows" || details.OSVersion != "10.0.17763" {
+		t.Errorf("unexpected system fields: hostname=%q os_type=%q os_version=%q", details.Hostname, details.OSType, details.OSVersion)
+	}
+	if !details.LastBootTime.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("LastBootTime = %s", details.LastBootTime)
+	}
+	if details.CPUModel != "Intel(R) Xeon(R) Gold 6230 CPU @ 2.10GHz" || details.CPUCount != 4 || details.MemoryTotalGB != 16 {
+		t.Errorf("unexpected hardware: cpu=%q count=%d memory=%.2f", details.CPUModel, details.CPUCount, details.MemoryTotalGB)
+	}
+	if len(details.Filesystems) != 1 || details.Filesystems[0].UsedPercent != 50 || details.DiskTotalGB != 100 {
+		t.Errorf("unexpected filesystems: %+v", details.Filesystems)
+	}
+	if details.IP != "10.1.2.3" || len(details.IPAddresses) != 3 {
+		t.Errorf("unexpected addresses: ip=%q %+v", details.IP, details.IPAddresses)
+	}
+
+	if len(details.OpenPorts) != 3 {
+		t.Fatalf("got %d open ports, want 3", len(details.OpenPorts))
+	}
+	listen := details.OpenPorts[0]
+	if listen.State != "LISTENING" || listen.ProcessName != "svchost" || listen.Description != "RPC" || listen.Protocol != "tcp" {
+		t.Errorf("unexpected listening port: %+v", listen)
+	}
+	if established := details.OpenPorts[1]; established.State != "ESTABLISHED" || established.ProcessID != nil || established.Description != "" {
+		t.Errorf("unexpected established port: %+v", established)
+	}
+	if udp := details.OpenPorts[2]; udp.Protocol != "udp" || udp.LocalPort != 123 {
+		t.Errorf("unexpected UDP port: %+v", udp)
+	}
+
+	if len(details.Services) != 1 || details.Services[0].Status != "Running" || details.Services[0].StartMode != "Manual" {
+		t.Errorf("unexpected services: %+v", details.Services)
+	}
+	if len(details.InstalledSoftware) != 1 || details.InstalledSoftware[0].InstallDate != "20230115" {
+		t.Errorf("unexpected software: %+v", details.InstalledSoftware)
+	}
+	if len(details.Processes) != 1 || details.Processes[0].StartTime == nil {
+		t.Errorf("unexpected processes: %+v", details.Processes)
+	}
+	if len(details.FirewallRules) != 1 {
+		t.Fatalf("got %d firewall rules, want 1", len(details.FirewallRules))
+	}
+	if rule := details.FirewallRules[0]; !rule.Enabled || rule.Direction != "Inbound" || rule.Action != "Allow" || rule.Profile != "Private, Public" {
+		t.Errorf("unexpected firewall rule: %+v", rule)
+	}
+	if len(details.DNSSettings) != 1 || len(details.DNSSettings[0].ServerAddresses) != 1 {
+		t.Errorf("unexpected DNS settings: %+v", details.DNSSettings)
+	}
+	if len(details.Updates) != 1 || details.Updates[0].InstalledOn == nil {
+		t.Errorf("unexpected updates: %+v", details.Updates)
+	}
+}
+
+func TestParseWindowsBundleEmpty(t *testing.T) {
+	if _, err := ParseWindowsBundle(t.TempDir()); err == nil {
+		t.Error("expected an error for a directory without discovery output")
+	}
+}
+
+func TestParsePSDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"/Date(1589294613000)/", time.UnixMilli(1589294613000)},
+		{"/Date(1589294613000-0500)/", time.UnixMilli(1589294613000)},
+		{"/Date(-62135596800000)/", time.Time{}},
+		{"2020-05-12T14:43:33.0000000Z", time.Date(2020, 5, 12, 14, 43, 33, 0, time.UTC)},
+		{"", time.Time{}},
+	}
+	for _, tt := range tests {
+		got, err := parsePSDate(tt.in)
+		if err != nil {
+			t.Errorf("parsePSDate(%q) returned error: %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parsePSDate(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := parsePSDate("yesterday"); err == nil {
+		t.Error("expected an error for an invalid date")
+	}
+}
@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCollectWindowsBundle(t *testing.T) {
+	stdout := "[2024-05-01 10:00:00] [INFO] Creating ZIP archive of discovery results...\r\n" +
+		"[2024-05-01 10:00:01] [INFO] ZIP archive: C:\\Users\\svc discovery\\Documents\\ServerDiscovery-20240501-100000.zip\r\n"
+	remoteZip, err := bundlePath(stdout)
+	if err != nil {
+		t.Fatalf("bundlePath returned error: %v", err)
+	}
+	if want := `C:\Users\svc discovery\Documents\ServerDiscovery-20240501-100000.zip`; remoteZip != want {
+		t.Errorf("bundlePath = %q, want %q", remoteZip, want)
+	}
+	if _, err := bundlePath("Discovery process complete"); err == nil {
+		t.Error("expected an error when no archive is reported")
+	}
+
+	archive := buildZip(t, map[string]string{
+		"system_info.json":   `{"CsName": "WIN-APP01"}`,
+		`logs\discovery.txt`: "done",
+	})
+	encoded := base64.StdEncoding.EncodeToString(archive)
+	// Console output may be wrapped, so whitespace inside the bundle is ignored
+	wrapped := encoded[:10] + "\r\n" + encoded[10:]
+	bundle, err := decodeBundle("noise" + bundleBeginMarker + wrapped + bundleEndMarker + "\r\n")
+	if err != nil {
+		t.Fatalf("decodeBundle returned error: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := extractZip(bundle, dir); err != nil {
+		t.Fatalf("extractZip returned error: %v", err)
+	}
+	for name, want := range map[string]string{"system_info.json": `{"CsName": "WIN-APP01"}`, "logs/discovery.txt": "done"} {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("missing %s: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	if _, err := decodeBundle("no bundle here"); err == nil {
+		t.Error("expected an error when the bundle markers are missing")
+	}
+}
+
+func TestExtractZipRejectsTraversal(t *testing.T) {
+	for _, name := range []string{"../evil.txt", `..\evil.txt`, "/etc/evil.txt"} {
+		archive := buildZip(t, map[string]string{name: "x"})
+		if err := extractZip(archive, t.TempDir()); err == nil {
+			t.Errorf("extractZip accepted entry %q", name)
+		}
+	}
+}
+
+func TestPowerShellCommand(t *testing.T) {
+	cmd := PowerShellCommand("Write-Output 'héllo'")
+	encoded := cmd[strings.LastIndex(cmd, " ")+1:]
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("invalid base64 in %q: %v", cmd, err)
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	if got := string(utf16.Decode(units)); got != "Write-Output 'héllo'" {
+		t.Errorf("decoded command = %q", got)
+	}
+
+	if got := psQuote("C:\\it's"); got != `'C:\it''s'` {
+		t.Errorf("psQuote = %s", got)
+	}
+}
+
+func TestAppendScriptFitsCommandLine(t *testing.T) {
+	remotePath := `C:\Users\` + strings.Repeat("x", 64) + `\AppData\Local\Temp\server-discovery-0f8fad5b-d9cb-469f-a165-70867728950e.ps1`
+	chunk := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xFF}, uploadChunkSize))
+	if n := len(PowerShellCommand(appendScript(remotePath, chunk))); n > maxCommandLength {
+		t.Errorf("append command is %d characters, limit is %d", n, maxCommandLength)
+	}
+}
+
+func TestRunDiscoveryScriptUnknownTransfer(t *testing.T) {
+	if _, err := runDiscoveryScript(context.Background(), nil, "win-app01", "Get-Date", "ftp"); err == nil {
+		t.Error("expected an error for an unknown transfer mode")
+	}
+}
@@ -0,0 +1,134 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/masterzen/winrm"
+)
+
+// WinRM script transfer modes, see models.Config.WinRMTransfer
+const (
+	WinRMTransferAuto    = "auto"
+	WinRMTransferEncoded = "encoded"
+	WinRMTransferFile    = "file"
+)
+
+// maxCommandLength is the cmd.exe command line limit that WinRM commands are subject to
+const maxCommandLength = 8191
+
+// uploadChunkSize is the number of script bytes appended per command. Once
+// base64 encoded, wrapped in the append script and encoded again as UTF-16LE
+// for -EncodedCommand, a chunk stays well below maxCommandLength.
+const uploadChunkSize = 1536
+
+// utf8BOM makes Windows PowerShell read an uploaded script as UTF-8 rather than the ANSI code page
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// runDiscoveryScript runs script on the Windows host and returns its stdout.
+// In file mode, or in auto mode when the script does not fit on a single
+// -EncodedCommand line, the script is uploaded to a temporary file first.
+func runDiscoveryScript(ctx context.Context, client *winrm.Client, host, script, transfer string) (string, error) {
+	command := PowerShellCommand(script)
+	switch transfer {
+	case "", WinRMTransferAuto:
+		if len(command) <= maxCommandLength {
+			return runCommand(ctx, client, command)
+		}
+	case WinRMTransferEncoded:
+		return runCommand(ctx, client, command)
+	case WinRMTransferFile:
+	default:
+		return "", fmt.Errorf("unknown WinRM transfer mode %q", transfer)
+	}
+
+	remotePath, err := UploadScript(ctx, client, []byte(script))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		if _, err := RunPowerShell(cleanupCtx, client, "Remove-Item -LiteralPath "+psQuote(remotePath)+" -Force"); err != nil {
+			log.Printf("Warning: failed to clean up %s on %s: %v", remotePath, host, err)
+		}
+	}()
+
+	return runCommand(ctx, client, fmt.Sprintf(`powershell.exe -NoProfile -NonInteractive -ExecutionPolicy Bypass -File "%s"`, remotePath))
+}
+
+// UploadScript copies a PowerShell script to a new file in the remote user's
+// temporary directory by appending it in chunks, then verifies the file's
+// SHA-256 hash. It returns the remote path.
+func UploadScript(ctx context.Context, client *winrm.Client, script []byte) (string, error) {
+	if !bytes.HasPrefix(script, utf8BOM) {
+		script = append(append([]byte{}, utf8BOM...), script...)
+	}
+
+	out, err := RunPowerShell(ctx, client, "$path = Join-Path $env:TEMP ('server-discovery-' + [guid]::NewGuid() + '.ps1')\n"+
+		"New-Item -ItemType File -Path $path -Force | Out-Null\n"+
+		"[Console]::Out.Write($path)\n")
+	if err != nil {
+		return "", fmt.Errorf("failed to create remote script file: %w", err)
+	}
+	remotePath := strings.TrimSpace(out)
+	if remotePath == "" {
+		return "", fmt.Errorf("failed to create remote script file: no path returned")
+	}
+
+	for offset := 0; offset < len(script); offset += uploadChunkSize {
+		end := offset + uploadChunkSize
+		if end > len(script) {
+			end = len(script)
+		}
+		chunk := base64.StdEncoding.EncodeToString(script[offset:end])
+		if _, err := RunPowerShell(ctx, client, appendScript(remotePath, chunk)); err != nil {
+			return "", fmt.Errorf("failed to upload script chunk at offset %d: %w", offset, err)
+		}
+	}
+
+	sum := sha256.Sum256(script)
+	out, err = RunPowerShell(ctx, client, fmt.Sprintf("[Console]::Out.Write((Get-FileHash -LiteralPath %s -Algorithm SHA256).Hash)", psQuote(remotePath)))
+	if err != nil {
+		return "", fmt.Errorf("failed to hash uploaded script: %w", err)
+	}
+	if want := hex.EncodeToString(sum[:]); !strings.EqualFold(strings.TrimSpace(out), want) {
+		return "", fmt.Errorf("uploaded script hash mismatch: got %s, want %s", strings.TrimSpace(out), want)
+	}
+
+	return remotePath, nil
+}
+
+// appendScript returns a script appending base64-encoded data to remotePath
+func appendScript(remotePath, data string) string {
+	return fmt.Sprintf("$ErrorActionPreference = 'Stop'\n"+
+		"$bytes = [Convert]::FromBase64String('%s')\n"+
+		"$file = [IO.File]::Open(%s, [IO.FileMode]::Append)\n"+
+		"try { $file.Write($bytes, 0, $bytes.Length) } finally { $file.Close() }\n",
+		data, psQuote(remotePath))
+}
+
+// RunPowerShell runs a short PowerShell script and returns its stdout. A
+// non-zero exit code is reported as an error carrying stderr.
+func RunPowerShell(ctx context.Context, client *winrm.Client, script string) (string, error) {
+	return runCommand(ctx, client, PowerShellCommand(script))
+}
+
+// runCommand runs a command line, aborting the WinRM shell if ctx is done
+func runCommand(ctx context.Context, client *winrm.Client, command string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	exitCode, err := client.RunWithContext(ctx, command, &stdout, &stderr)
+	if err != nil {
+		return "", err
+	}
+	if exitCode != 0 {
+		return stdout.String(), fmt.Errorf("exit code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
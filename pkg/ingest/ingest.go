@@ -0,0 +1,135 @@
+// Package ingest signs and verifies the inventory that discovery agents push
+// to POST /api/ingest from networks the controller cannot reach.
+//
+// An agent authenticates with its server's token by sending, alongside the
+// server_details.json payload, the HMAC-SHA256 of "<timestamp>.<body>" keyed
+// by the token. Requests whose timestamp is further than MaxClockSkew from
+// the controller's clock are rejected, which bounds how long a captured
+// request can be replayed.
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/discovery"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// Request headers of a pushed inventory
+const (
+	HeaderServerID  = "X-Discovery-Server-ID"
+	HeaderTimestamp = "X-Discovery-Timestamp"
+	HeaderSignature = "X-Discovery-Signature"
+)
+
+// MaxClockSkew is how far a request's timestamp may be from the controller's clock
+const MaxClockSkew = 5 * time.Minute
+
+// signaturePrefix names the signature algorithm in HeaderSignature
+const signaturePrefix = "sha256="
+
+var (
+	// ErrInvalidSignature is returned when a signature does not match the payload
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrStaleTimestamp is returned when a timestamp is outside MaxClockSkew
+	ErrStaleTimestamp = errors.New("timestamp outside the allowed clock skew")
+)
+
+// GenerateToken returns a new random agent token
+func GenerateToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// Sign returns the HeaderSignature value for body sent at timestamp (in Unix seconds)
+func Sign(token string, timestamp int64, body []byte) string {
+	return signaturePrefix + hex.EncodeToString(mac(token, strconv.FormatInt(timestamp, 10), body))
+}
+
+// Verify checks that signature was made with token over timestamp and body,
+// and that timestamp is within MaxClockSkew of now
+func Verify(token, timestamp, signature string, body []byte, now time.Time) error {
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if skew := now.Sub(time.Unix(sent, 0)); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return ErrStaleTimestamp
+	}
+
+	hexSig, ok := strings.CutPrefix(signature, signaturePrefix)
+	if !ok {
+		return ErrInvalidSignature
+	}
+	got, err := hex.DecodeString(hexSig)
+	if err != nil || !hmac.Equal(got, mac(token, timestamp, body)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// NewRequest builds a signed POST of details to the ingest endpoint at url
+func NewRequest(ctx context.Context, url string, serverID int, token string, details models.ServerDetails) (*http.Request, error) {
+	body, err := json.Marshal(details)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode inventory: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderServerID, strconv.Itoa(serverID))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(token, timestamp, body))
+	return req, nil
+}
+
+// Result builds the discovery result of an inventory pushed for a server.
+// body is a server_details.json, either as written by
+// Enhanced-ServerDiscovery.sh or by cmd/agent.
+func Result(serverID int, body []byte, now time.Time) (models.DiscoveryResult, error) {
+	details, err := discovery.ParseServerDetailsJSON(body)
+	if err != nil {
+		return models.DiscoveryResult{}, fmt.Errorf("invalid inventory: %w", err)
+	}
+	return models.DiscoveryResult{
+		ServerID:    serverID,
+		Server:      details.Hostname,
+		Success:     true,
+		Message:     "Inventory pushed by agent",
+		Status:      "completed",
+		StartTime:   now,
+		EndTime:     now,
+		LastChecked: now,
+		Source:      models.DiscoverySourcePush,
+		Details:     &details,
+	}, nil
+}
+
+// mac computes the HMAC-SHA256 of "<timestamp>.<body>" keyed by token
+func mac(token, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(token))
+	h.Write([]byte(timestamp))
+	h.Write([]byte{'.'})
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,110 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"hostname":"web01"}`)
+	signature := Sign("secret", now.Unix(), body)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	if err := Verify("secret", timestamp, signature, body, now.Add(time.Minute)); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		timestamp string
+		signature string
+		body      []byte
+		want      error
+	}{
+		{"wrong token", "other", timestamp, signature, body, ErrInvalidSignature},
+		{"tampered body", "secret", timestamp, signature, []byte(`{"hostname":"web02"}`), ErrInvalidSignature},
+		{"moved timestamp", "secret", strconv.FormatInt(now.Unix()+1, 10), signature, body, ErrInvalidSignature},
+		{"missing prefix", "secret", timestamp, signature[len(signaturePrefix):], body, ErrInvalidSignature},
+		{"stale timestamp", "secret", strconv.FormatInt(now.Add(-time.Hour).Unix(), 10), signature, body, ErrStaleTimestamp},
+	}
+	for _, tt := range tests {
+		if err := Verify(tt.token, tt.timestamp, tt.signature, tt.body, now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if err := Verify("secret", "yesterday", signature, body, now); err == nil {
+		t.Error("expected an error for a malformed timestamp")
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	token, err := GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := NewRequest(context.Background(), "http://controller/api/ingest", 42, token, models.ServerDetails{Hostname: "web01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get(HeaderServerID) != "42" {
+		t.Errorf("server ID header = %q", req.Header.Get(HeaderServerID))
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(token, req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderSignature), body, time.Now()); err != nil {
+		t.Errorf("signed request rejected: %v", err)
+	}
+}
+
+func TestResultFromScriptOutput(t *testing.T) {
+	// The server_details.json written by Enhanced-ServerDiscovery.sh
+	body := []byte(`{
+		"hostname": "web01",
+		"os_type": "linux",
+		"network_interfaces": [
+			{"name": "lo", "ip_addresses": ["127.0.0.1"]},
+			{"name": "eth0", "ip_addresses": ["10.0.0.15", "fe80::1"]}
+		],
+		"mounted_filesystems": [
+			{"device": "/dev/sda1", "mount_point": "/", "fs_type": "ext4", "total_gb": 100, "used_gb": 25, "free_gb": 75}
+		]
+	}`)
+	now := time.Unix(1700000000, 0)
+	result, err := Result(7, body, now)
+	if err != nil {
+		t.Fatalf("Result returned error: %v", err)
+	}
+	if result.ServerID != 7 || result.Source != models.DiscoverySourcePush || !result.Success || !result.EndTime.Equal(now) {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	details := result.Details
+	if details.Hostname != "web01" || details.IP != "10.0.0.15" || len(details.IPAddresses) != 3 {
+		t.Errorf("addresses lost: %s %+v", details.IP, details.IPAddresses)
+	}
+	if len(details.Filesystems) != 1 || details.Filesystems[0].MountPoint != "/" || details.Filesystems[0].UsedPercent != 25 || details.DiskTotalGB != 100 {
+		t.Errorf("filesystems lost: %+v", details.Filesystems)
+	}
+
+	// cmd/agent pushes models.ServerDetails as is
+	result, err = Result(7, []byte(`{"hostname": "web01", "ip_addresses": [{"ip_address": "10.0.0.15", "interface_name": "eth0"}]}`), now)
+	if err != nil || len(result.Details.IPAddresses) != 1 {
+		t.Errorf("agent payload: %+v, %v", result.Details, err)
+	}
+	if _, err := Result(7, []byte("not json"), now); err == nil {
+		t.Error("expected an error for an invalid body")
+	}
+}
@@ -7,17 +7,46 @@ import (
 
 // This file is deprecated. All types have been moved to models.go
 
+// legacyServerConfig holds server keys that are no longer part of ServerConfig
+type legacyServerConfig struct {
+	UseWinRM bool `json:"use_winrm"`
+}
+
+// legacyConfig holds the legacy keys of the server and servers sections
+type legacyConfig struct {
+	Server  legacyServerConfig   `json:"server"`
+	Servers []legacyServerConfig `json:"servers"`
+}
+
 func ReadConfig(path string) (*Config, error) {
-	file, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
 	var config Config
-	if err := json.NewDecoder(file).Decode(&config); err != nil {
+	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}
 
+	var legacy legacyConfig
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+	applyLegacyServerConfig(&config.Server, legacy.Server)
+	for i := range config.Servers {
+		if i < len(legacy.Servers) {
+			applyLegacyServerConfig(&config.Servers[i], legacy.Servers[i])
+		}
+	}
+
 	return &config, nil
 }
+
+// applyLegacyServerConfig maps use_winrm, replaced by method, onto the windows
+// method unless a method is set
+func applyLegacyServerConfig(server *ServerConfig, legacy legacyServerConfig) {
+	if legacy.UseWinRM && server.Method == "" {
+		server.Method = "windows"
+	}
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadConfigUseWinRM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+		"server": {"use_winrm": true},
+		"servers": [
+			{"host": "win01", "use_winrm": true},
+			{"host": "lin01"},
+			{"host": "snmp01", "use_winrm": true, "method": "snmp"}
+		]
+	}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Server.Method != "windows" {
+		t.Errorf("server method %q, want windows", config.Server.Method)
+	}
+	for i, want := range []string{"windows", "", "snmp"} {
+		if got := config.Servers[i].Method; got != want {
+			t.Errorf("%s: method %q, want %q", config.Servers[i].Host, got, want)
+		}
+	}
+}
@@ -10,7 +10,9 @@ type Service struct {
 	Name        string    `json:"name" db:"service_name"`
 	Status      string    `json:"status" db:"service_status"`
 	Description string    `json:"description" db:"service_description"`
+	DisplayName string    `json:"display_name,omitempty"`
 	Port        int       `json:"port" db:"port"`
+	StartMode   string    `json:"start_mode,omitempty"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -32,6 +34,13 @@ type ServerDetails struct {
 	DiskTotalGB       float64        `json:"disk_total_gb" db:"disk_total_gb"`
 	DiskFreeGB        float64        `json:"disk_free_gb" db:"disk_free_gb"`
 	LastBootTime      time.Time      `json:"last_boot_time" db:"last_boot_time"`
+	KernelVersion     string         `json:"kernel_version,omitempty" db:"kernel_version"`
+	PackageManager    string         `json:"package_manager,omitempty" db:"package_manager"`
+	InitSystem        string         `json:"init_system,omitempty" db:"init_system"`
+	SELinuxStatus     string         `json:"selinux_status,omitempty" db:"selinux_status"`
+	FirewallStatus    string         `json:"firewall_status,omitempty" db:"firewall_status"`
+	DiscoveryMethod   string         `json:"discovery_method,omitempty" db:"discovery_method"`
+	CredentialRef     string         `json:"credential_ref,omitempty" db:"credential_ref"`
 	Metrics           *ServerMetrics `json:"metrics,omitempty"`
 	Services          []Service      `json:"services,omitempty"`
 	IPAddresses       []IPAddress    `json:"ip_addresses,omitempty"`
@@ -39,6 +48,15 @@ type ServerDetails struct {
 	Filesystems       []Filesystem   `json:"filesystems,omitempty"`
 	InstalledSoftware []Software     `json:"installed_software,omitempty" db:"installed_software"`
 	Tags              []Tag          `json:"tags,omitempty"`
+
+	// Collected by Windows and local discovery only
+	Processes []Process `json:"processes,omitempty"`
+
+	// Collected by Windows discovery only
+	FirewallRules []FirewallRule  `json:"firewall_rules,omitempty"`
+	Routes        []Route         `json:"routes,omitempty"`
+	DNSSettings   []DNSSetting    `json:"dns_settings,omitempty"`
+	Updates       []WindowsUpdate `json:"updates,omitempty"`
 }
 
 // ServerMetrics represents server performance metrics
@@ -64,15 +82,17 @@ type Tag struct {
 
 // ServerWithDetails represents a server with its details
 type ServerWithDetails struct {
-	ID          int            `json:"id" db:"id"`
-	Hostname    string         `json:"hostname" db:"hostname"`
-	IP          string         `json:"ip" db:"ip"`
-	OSType      string         `json:"os_type" db:"os_type"`
-	Region      string         `json:"region" db:"region"`
-	Status      string         `json:"status" db:"status"`
-	LastChecked time.Time      `json:"last_checked" db:"last_checked"`
-	Metrics     *ServerMetrics `json:"metrics,omitempty"`
-	Tags        []Tag          `json:"tags,omitempty"`
+	ID              int            `json:"id" db:"id"`
+	Hostname        string         `json:"hostname" db:"hostname"`
+	IP              string         `json:"ip" db:"ip"`
+	OSType          string         `json:"os_type" db:"os_type"`
+	Region          string         `json:"region" db:"region"`
+	Status          string         `json:"status" db:"status"`
+	LastChecked     time.Time      `json:"last_checked" db:"last_checked"`
+	DiscoveryMethod string         `json:"discovery_method,omitempty" db:"discovery_method"`
+	CredentialRef   string         `json:"credential_ref,omitempty" db:"credential_ref"`
+	Metrics         *ServerMetrics `json:"metrics,omitempty"`
+	Tags            []Tag          `json:"tags,omitempty"`
 }
 
 // IPAddress represents an IP address and its interface
@@ -111,6 +131,9 @@ type Port struct {
 
 	// ProcessName is the name of the process that has this port open
 	ProcessName string `json:"process_name" db:"process_name"`
+
+	// Protocol is "tcp" or "udp"
+	Protocol string `json:"protocol,omitempty" db:"protocol"`
 }
 
 // Software represents installed software
@@ -120,6 +143,55 @@ type Software struct {
 	InstallDate string `json:"install_date"`
 }
 
+// Process represents a process running on a server at discovery time
+type Process struct {
+	ProcessID       int        `json:"process_id"`
+	ParentProcessID int        `json:"parent_process_id,omitempty"`
+	Name            string     `json:"name"`
+	Path            string     `json:"path,omitempty"`
+	CommandLine     string     `json:"command_line,omitempty"`
+	StartTime       *time.Time `json:"start_time,omitempty"`
+	CPUSeconds      float64    `json:"cpu_seconds"`
+	WorkingSetMB    float64    `json:"working_set_mb"`
+	Threads         int        `json:"threads"`
+	Handles         int        `json:"handles"`
+}
+
+// FirewallRule represents a host firewall rule
+type FirewallRule struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Description string `json:"description,omitempty"`
+	Enabled     bool   `json:"enabled"`
+	Direction   string `json:"direction"`
+	Action      string `json:"action"`
+	Profile     string `json:"profile"`
+}
+
+// Route represents an entry in a server's routing table
+type Route struct {
+	DestinationPrefix string `json:"destination_prefix"`
+	NextHop           string `json:"next_hop"`
+	InterfaceAlias    string `json:"interface_alias"`
+	Metric            int    `json:"metric"`
+	AddressFamily     string `json:"address_family"`
+}
+
+// DNSSetting represents the DNS servers configured on an interface
+type DNSSetting struct {
+	InterfaceAlias  string   `json:"interface_alias"`
+	AddressFamily   string   `json:"address_family"`
+	ServerAddresses []string `json:"server_addresses"`
+}
+
+// WindowsUpdate represents an installed Windows hotfix
+type WindowsUpdate struct {
+	HotFixID    string     `json:"hotfix_id"`
+	Description string     `json:"description"`
+	InstalledOn *time.Time `json:"installed_on,omitempty"`
+	InstalledBy string     `json:"installed_by,omitempty"`
+}
+
 // Filesystem represents a mounted filesystem
 type Filesystem struct {
 	MountPoint  string  `json:"mount_point"`
@@ -136,21 +208,79 @@ type Filesystem struct {
 
 // Config represents the main configuration for the application
 type Config struct {
-	Database         DatabaseConfig `json:"database"`
-	Server           ServerConfig   `json:"server"`
-	SSH              SSHConfig      `json:"ssh"`
-	API              APIConfig      `json:"api"`
-	PowerShellScript string         `json:"powershell_script"`
-	OutputDir        string         `json:"output_dir"`
-	Concurrency      int            `json:"concurrency"`
-	Servers          []ServerConfig `json:"servers"`
-	DatabaseConfig   DatabaseConfig `json:"database_config"`
-	SkipCertVerify   bool           `json:"skip_cert_verify"`
-	Timeout          int            `json:"timeout"`
-	CacheTTL         int            `json:"cache_ttl"`
-	BatchSize        int            `json:"batch_size"`
-	MetricsPort      int            `json:"metrics_port"`
-	TracingEndpoint  string         `json:"tracing_endpoint"`
+	Database         DatabaseConfig    `json:"database"`
+	Discovery        DiscoveryConfig   `json:"discovery"`
+	Server           ServerConfig      `json:"server"`
+	SSH              SSHConfig         `json:"ssh"`
+	Credentials      CredentialsConfig `json:"credentials"`
+	Sweep            SweepConfig       `json:"sweep"`
+	Resources        ResourceConfig    `json:"resources"`
+	Limits           LimitsConfig      `json:"limits"`
+	Distributed      DistributedConfig `json:"distributed"`
+	API              APIConfig         `json:"api"`
+	PowerShellScript string            `json:"powershell_script"`
+	LinuxScript      string            `json:"linux_script"`
+	LinuxCollector   string            `json:"linux_collector"` // script (default) or commands
+	WinRMTransfer    string            `json:"winrm_transfer"`  // auto (default), encoded or file
+	OutputDir        string            `json:"output_dir"`
+	Concurrency      int               `json:"concurrency"`
+	Servers          []ServerConfig    `json:"servers"`
+	DatabaseConfig   DatabaseConfig    `json:"database_config"`
+	SkipCertVerify   bool              `json:"skip_cert_verify"`
+	Timeout          int               `json:"timeout"`
+	CacheTTL         int               `json:"cache_ttl"`
+	BatchSize        int               `json:"batch_size"`
+	MetricsPort      int               `json:"metrics_port"`
+	TracingEndpoint  string            `json:"tracing_endpoint"`
+}
+
+// DiscoveryConfig represents discovery execution settings
+type DiscoveryConfig struct {
+	Concurrency   int           `json:"concurrency"`
+	Timeout       time.Duration `json:"timeout"`
+	RetryCount    int           `json:"retryCount"`
+	RetryDelay    time.Duration `json:"retryDelay"`
+	MaxRetryDelay time.Duration `json:"maxRetryDelay"`
+	Schedule      string        `json:"schedule"` // Cron expression seeding the global schedule
+}
+
+// SweepConfig represents network sweep settings
+type SweepConfig struct {
+	Ports          []int `json:"ports"`           // Ports to probe, defaults to 22, 5985, 5986 and 3389
+	Concurrency    int   `json:"concurrency"`     // Hosts probed at once, defaults to 64
+	TimeoutSeconds int   `json:"timeout_seconds"` // Connect and banner timeout per port, defaults to 2
+	MaxHosts       int   `json:"max_hosts"`       // Largest number of addresses in one sweep, defaults to 65536
+}
+
+// ResourceConfig sets the local resource limits above which no new discovery
+// jobs are started. A zero limit is not checked.
+type ResourceConfig struct {
+	MaxCPUPercent        float64 `json:"max_cpu_percent"`
+	MaxMemoryPercent     float64 `json:"max_memory_percent"`
+	MaxOpenFiles         int     `json:"max_open_files"`         // File descriptors open in the controller process
+	CheckIntervalSeconds int     `json:"check_interval_seconds"` // Defaults to 5
+}
+
+// LimitsConfig caps how many discoveries run at once overall, per region and
+// per /24 subnet, and how quickly new connections are opened. A zero limit is
+// not enforced.
+type LimitsConfig struct {
+	MaxConcurrent        int            `json:"max_concurrent"`         // Across all servers
+	MaxPerRegion         int            `json:"max_per_region"`         // Servers without a region are not counted
+	RegionLimits         map[string]int `json:"region_limits"`          // Overrides MaxPerRegion for single regions
+	MaxPerSubnet         int            `json:"max_per_subnet"`         // Per IPv4 /24 of the server's address
+	ConnectionsPerSecond float64        `json:"connections_per_second"` // Token bucket rate for new connections
+	ConnectionBurst      int            `json:"connection_burst"`       // Token bucket size; defaults to 1
+}
+
+// DistributedConfig controls running discovery jobs on cmd/worker processes
+// instead of in the API server
+type DistributedConfig struct {
+	Enabled                bool `json:"enabled"`                  // Lease jobs to workers instead of running them locally
+	LeaseSeconds           int  `json:"lease_seconds"`            // Lease length, renewed by heartbeats; defaults to 60
+	HeartbeatSeconds       int  `json:"heartbeat_seconds"`        // Defaults to 10
+	WorkerTimeoutSeconds   int  `json:"worker_timeout_seconds"`   // Workers silent this long are dead; defaults to 30
+	DispatchIntervalMillis int  `json:"dispatch_interval_millis"` // How often queued jobs are leased and workers poll; defaults to 1000
 }
 
 // APIConfig represents API server configuration
@@ -164,38 +294,94 @@ type APIConfig struct {
 
 // DatabaseConfig represents database connection configuration
 type DatabaseConfig struct {
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	User     string `json:"user"`
-	Password string `json:"password"`
-	DBName   string `json:"dbname"`
-	SSLMode  string `json:"sslmode"`
-	Enabled  bool   `json:"enabled"`
+	Host          string `json:"host"`
+	Port          int    `json:"port"`
+	User          string `json:"user"`
+	Password      string `json:"password"`
+	DBName        string `json:"dbname"`
+	CredentialRef string `json:"credential_ref"` // Resolves User and Password from a credential provider
+	SSLMode       string `json:"sslmode"`
+	Enabled       bool   `json:"enabled"`
 }
 
 // ServerConfig represents server configuration
 type ServerConfig struct {
-	ID             int    `json:"id"`
-	Host           string `json:"host"`
-	Username       string `json:"username"`
-	Password       string `json:"password"`
-	PrivateKeyPath string `json:"private_key_path"`
-	UseWinRM       bool   `json:"use_winrm"`
-	WinRMPort      int    `json:"winrm_port"`
-	WinRMHTTPS     bool   `json:"winrm_https"`
-	WinRMInsecure  bool   `json:"winrm_insecure"`
-	TimeoutSeconds int    `json:"timeout_seconds"`
-	Region         string `json:"region"`
+	ID               int               `json:"id"`
+	Host             string            `json:"host"`
+	Username         string            `json:"username"`
+	Password         string            `json:"password"`
+	CredentialRef    string            `json:"credential_ref"` // Resolves Username and Password from a credential provider
+	PrivateKeyPath   string            `json:"private_key_path"`
+	SSHPort          int               `json:"ssh_port"`
+	Method           string            `json:"method"` // Discovery method; for Config.Server, the fallback for unknown OS types
+	WinRMPort        int               `json:"winrm_port"`
+	WinRMHTTPS       bool              `json:"winrm_https"`
+	WinRMInsecure    bool              `json:"winrm_insecure"`
+	WinRMAuth        string            `json:"winrm_auth"`         // basic (default), ntlm, kerberos or certificate
+	WinRMCACert      string            `json:"winrm_ca_cert"`      // PEM bundle used to verify the HTTPS listener
+	WinRMCert        string            `json:"winrm_cert"`         // Client certificate for certificate auth
+	WinRMKey         string            `json:"winrm_key"`          // Client certificate key for certificate auth
+	KrbRealm         string            `json:"krb_realm"`          // Defaults to the realm in Username (user@REALM)
+	KrbConfig        string            `json:"krb_config"`         // krb5.conf path, defaults to /etc/krb5.conf
+	KrbKeytab        string            `json:"krb_keytab"`         // Authenticate with a keytab instead of Password
+	KrbSPN           string            `json:"krb_spn"`            // Defaults to HTTP/<host>
+	SNMPVersion      string            `json:"snmp_version"`       // 2c (default) or 3
+	SNMPPort         int               `json:"snmp_port"`          // Defaults to 161
+	SNMPCommunity    string            `json:"snmp_community"`     // SNMPv2c community, defaults to Password
+	SNMPAuthProtocol string            `json:"snmp_auth_protocol"` // SNMPv3 md5, sha (default) or sha256; Password is the auth password
+	SNMPPrivProtocol string            `json:"snmp_priv_protocol"` // SNMPv3 des, aes (default) or none
+	SNMPPrivPassword string            `json:"snmp_priv_password"` // SNMPv3 privacy password
+	TimeoutSeconds   int               `json:"timeout_seconds"`
+	Region           string            `json:"region"`
+	RetryCount       int               `json:"retry_count"`     // Overrides discovery.retryCount; negative disables retries
+	SSHProxyJump     []string          `json:"ssh_proxy_jump"`  // Overrides the region and global SSH jump hosts
+	Tags             map[string]string `json:"tags,omitempty"`  // Inventory tags; changing them invalidates cached results
+	Force            bool              `json:"force,omitempty"` // Bypass the discovery cache
 }
 
 // SSHConfig represents SSH connection configuration
 type SSHConfig struct {
-	Host           string `json:"host"`
-	Port           int    `json:"port"`
-	Username       string `json:"username"`
-	Password       string `json:"password"`
-	PrivateKeyPath string `json:"private_key_path"`
-	TimeoutSeconds int    `json:"timeout_seconds"`
+	Host            string              `json:"host"`
+	Port            int                 `json:"port"`
+	Username        string              `json:"username"`
+	Password        string              `json:"password"`
+	CredentialRef   string              `json:"credential_ref"` // Resolves Username, Password and Passphrase from a credential provider
+	PrivateKeyPath  string              `json:"private_key_path"`
+	Passphrase      string              `json:"passphrase"`       // Decrypts PrivateKeyPath
+	CertificatePath string              `json:"certificate_path"` // OpenSSH user certificate, defaults to <private_key_path>-cert.pub
+	UseAgent        bool                `json:"use_agent"`        // Authenticate with the keys held by the ssh-agent at SSH_AUTH_SOCK
+	TimeoutSeconds  int                 `json:"timeout_seconds"`
+	HostKeyMode     string              `json:"host_key_mode"`     // tofu (default), strict or insecure
+	KnownHostsPath  string              `json:"known_hosts_path"`  // Used in strict mode, defaults to ~/.ssh/known_hosts
+	ProxyJump       []string            `json:"proxy_jump"`        // Jump hosts to connect through, as [user@]host[:port]
+	RegionProxyJump map[string][]string `json:"region_proxy_jump"` // Jump hosts for servers in a region
+	ServerID        int                 `json:"-"`                 // Inventory ID that trusted host keys are stored under
+}
+
+// CredentialsConfig configures the providers credential_ref values are
+// resolved against. A reference has the form [provider:]name, where the
+// provider is env, file, local or vault.
+type CredentialsConfig struct {
+	Provider       string `json:"provider"`         // Provider for references without a prefix, defaults to env
+	EnvPrefix      string `json:"env_prefix"`       // Defaults to DISCOVERY_CREDENTIAL_
+	SecretsDir     string `json:"secrets_dir"`      // Enables the file provider, one directory per credential
+	VaultFile      string `json:"vault_file"`       // Enables the encrypted local vault provider
+	VaultKeyEnv    string `json:"vault_key_env"`    // Variable holding the local vault passphrase, defaults to DISCOVERY_VAULT_KEY
+	VaultAddress   string `json:"vault_address"`    // Enables the HashiCorp Vault provider
+	VaultMount     string `json:"vault_mount"`      // KV version 2 mount, defaults to secret
+	VaultNamespace string `json:"vault_namespace"`  // Vault Enterprise namespace
+	VaultTokenFile string `json:"vault_token_file"` // Defaults to the VAULT_TOKEN environment variable
+}
+
+// SSHHostKey is a server host key trusted on first use
+type SSHHostKey struct {
+	ID          int       `json:"id" db:"id"`
+	ServerID    int       `json:"server_id" db:"server_id"`
+	KeyType     string    `json:"key_type" db:"key_type"`
+	PublicKey   string    `json:"public_key" db:"public_key"`
+	Fingerprint string    `json:"fingerprint" db:"fingerprint"`
+	Comment     string    `json:"comment,omitempty" db:"comment"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 }
 
 // DiscoveryResult represents the result of a server discovery operation
@@ -212,6 +398,209 @@ type DiscoveryResult struct {
 	OutputPath  string    `json:"output_path,omitempty"`
 	Error       string    `json:"error,omitempty"`
 	Region      string    `json:"region,omitempty"`
+	JobID       string    `json:"job_id,omitempty"`
+	Attempt     int       `json:"attempt,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Method      string    `json:"method,omitempty"`
+
+	// Cached marks a result reused from the discovery cache. Its ID is the
+	// discovery it was stored as when it was collected, so it is not stored again.
+	Cached bool `json:"cached,omitempty"`
+
+	// Details holds the inventory parsed from OutputPath, persisted with the result
+	Details *ServerDetails `json:"details,omitempty"`
+}
+
+// Discovery result sources
+const (
+	DiscoverySourcePull = "pull" // collected by the controller
+	DiscoverySourcePush = "push" // pushed by an agent to /api/ingest
+)
+
+// Discovery job states
+const (
+	JobStatusQueued     = "queued"
+	JobStatusLeased     = "leased" // assigned to a worker that has not started it yet
+	JobStatusRunning    = "running"
+	JobStatusCancelling = "cancelling" // cancel requested while running on a worker
+	JobStatusSucceeded  = "succeeded"
+	JobStatusFailed     = "failed"
+	JobStatusCancelled  = "cancelled"
+	JobStatusTimeout    = "timeout"
+)
+
+// DiscoveryJob represents a discovery run queued on the controller
+type DiscoveryJob struct {
+	ID          string     `json:"id" db:"id"`
+	ServerID    int        `json:"server_id" db:"server_id"`
+	Host        string     `json:"host" db:"host"`
+	Region      string     `json:"region,omitempty" db:"region"`
+	Status      string     `json:"status" db:"status"`
+	Attempts    int        `json:"attempts" db:"attempts"`
+	DiscoveryID *int       `json:"discovery_id,omitempty" db:"discovery_id"`
+	Error       string     `json:"error,omitempty" db:"error"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+	WorkerID    string     `json:"worker_id,omitempty" db:"worker_id"`
+	LeaseExpiry *time.Time `json:"lease_expires_at,omitempty" db:"lease_expires_at"`
+	Force       bool       `json:"force,omitempty" db:"force"`
+}
+
+// Worker node states
+const (
+	WorkerStatusActive    = "active"
+	WorkerStatusThrottled = "throttled" // resource limits exceeded, takes no new jobs
+	WorkerStatusStopped   = "stopped"
+	WorkerStatusDead      = "dead" // missed its heartbeats
+)
+
+// WorkerNode is a cmd/worker process executing discovery jobs leased to it
+// by the coordinator
+type WorkerNode struct {
+	ID           string    `json:"id" db:"id"`
+	Hostname     string    `json:"hostname" db:"hostname"`
+	IPAddress    string    `json:"ip_address" db:"ip_address"`
+	Region       string    `json:"region,omitempty" db:"region"`
+	Status       string    `json:"status" db:"status"`
+	Capacity     int       `json:"capacity" db:"capacity"`
+	CurrentJobs  int       `json:"current_jobs" db:"current_jobs"` // Jobs leased or running
+	JobsHandled  int       `json:"jobs_handled" db:"jobs_handled"`
+	RegisteredAt time.Time `json:"registered_at" db:"registered_at"`
+	LastSeen     time.Time `json:"last_seen" db:"last_seen"`
+}
+
+// Discovery schedule scopes, from least to most specific
+const (
+	ScheduleScopeGlobal = "global"
+	ScheduleScopeRegion = "region"
+	ScheduleScopeTag    = "tag"
+)
+
+// DiscoverySchedule represents a cron schedule for re-discovering servers.
+// Region schedules override the global one for servers in that region, and
+// tag schedules override both for servers carrying the tag.
+type DiscoverySchedule struct {
+	ID             int        `json:"id" db:"id"`
+	Name           string     `json:"name" db:"name"`
+	CronExpression string     `json:"cron_expression" db:"cron_expression"`
+	Scope          string     `json:"scope" db:"scope"`
+	Region         string     `json:"region,omitempty" db:"region"`
+	TagName        string     `json:"tag_name,omitempty" db:"tag_name"`
+	TagValue       string     `json:"tag_value,omitempty" db:"tag_value"`
+	Enabled        bool       `json:"enabled" db:"enabled"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty" db:"last_run_at"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty" db:"next_run_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Network sweep states
+const (
+	SweepStatusRunning   = "running"
+	SweepStatusCompleted = "completed"
+	SweepStatusFailed    = "failed"
+	SweepStatusCancelled = "cancelled"
+)
+
+// NetworkSweep represents a probe of CIDR ranges for servers that are not in
+// the inventory yet
+type NetworkSweep struct {
+	ID          int        `json:"id" db:"id"`
+	CIDRs       []string   `json:"cidrs" db:"-"`
+	Ports       []int      `json:"ports" db:"-"`
+	Status      string     `json:"status" db:"status"`
+	TotalHosts  int        `json:"total_hosts" db:"total_hosts"`
+	ProbedHosts int        `json:"probed_hosts" db:"probed_hosts"`
+	FoundHosts  int        `json:"found_hosts" db:"found_hosts"`
+	Error       string     `json:"error,omitempty" db:"error"`
+	StartedAt   time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// Server candidate states
+const (
+	CandidateStatusPending  = "pending"
+	CandidateStatusApproved = "approved"
+	CandidateStatusRejected = "rejected"
+)
+
+// CandidatePort is an open port found by a sweep, with the banner the
+// service answered with
+type CandidatePort struct {
+	Port   int    `json:"port"`
+	Banner string `json:"banner,omitempty"`
+}
+
+// ServerCandidate is a host found by a network sweep that an operator can
+// approve into the inventory
+type ServerCandidate struct {
+	ID        int             `json:"id" db:"id"`
+	SweepID   *int            `json:"sweep_id,omitempty" db:"sweep_id"`
+	IP        string          `json:"ip" db:"ip"`
+	Hostname  string          `json:"hostname,omitempty" db:"hostname"`
+	OSType    string          `json:"os_type,omitempty" db:"os_type"`
+	Ports     []CandidatePort `json:"ports" db:"-"`
+	Status    string          `json:"status" db:"status"`
+	ServerID  *int            `json:"server_id,omitempty" db:"server_id"`
+	FirstSeen time.Time       `json:"first_seen" db:"first_seen"`
+	LastSeen  time.Time       `json:"last_seen" db:"last_seen"`
+}
+
+// JobProgress summarizes the state of the controller's discovery job queue
+type JobProgress struct {
+	TotalJobs     int `json:"total_jobs"`
+	CompletedJobs int `json:"completed_jobs"`
+	QueuedJobs    int `json:"queued_jobs"`
+	RunningJobs   int `json:"running_jobs"`
+	Workers       int `json:"workers"`
+
+	// Set when resource limits are configured
+	Throttle *ThrottleStatus `json:"throttle,omitempty"`
+
+	// Set on the coordinator of distributed discovery
+	WorkerNodes int `json:"worker_nodes,omitempty"`
+
+	// Set when concurrency or connection limits are configured
+	Limits *LimitStatus `json:"limits,omitempty"`
+}
+
+// LimitStatus reports the configured dispatch limits along with the running
+// jobs counted against them and the jobs held back by them
+type LimitStatus struct {
+	MaxConcurrent        int            `json:"max_concurrent,omitempty"`
+	MaxPerRegion         int            `json:"max_per_region,omitempty"`
+	RegionLimits         map[string]int `json:"region_limits,omitempty"`
+	MaxPerSubnet         int            `json:"max_per_subnet,omitempty"`
+	ConnectionsPerSecond float64        `json:"connections_per_second,omitempty"`
+	Running              int            `json:"running"`
+	Regions              map[string]int `json:"regions,omitempty"`          // Running jobs by region
+	Subnets              map[string]int `json:"subnets,omitempty"`          // Running jobs by /24
+	Deferred             int            `json:"deferred"`                   // Queued jobs held back by a limit
+	TokensAvailable      *float64       `json:"tokens_available,omitempty"` // Set with ConnectionsPerSecond
+}
+
+// ThrottleStatus reports whether the job dispatcher is paused because local
+// resource usage exceeds the configured limits
+type ThrottleStatus struct {
+	Throttled     bool       `json:"throttled"`
+	Reasons       []string   `json:"reasons,omitempty"`
+	Since         *time.Time `json:"since,omitempty"`
+	CPUPercent    float64    `json:"cpu_percent"`
+	MemoryPercent float64    `json:"memory_percent"`
+	OpenFiles     int        `json:"open_files"`
+	CheckedAt     time.Time  `json:"checked_at"`
+}
+
+// ConnectionPoolStats reports the usage of the WinRM connection pool
+type ConnectionPoolStats struct {
+	Hits         int64 `json:"hits"`
+	Misses       int64 `json:"misses"`
+	Evictions    int64 `json:"evictions"`
+	Reaped       int64 `json:"reaped"`
+	OpenClients  int   `json:"open_clients"`
+	InUseClients int   `json:"in_use_clients"`
+	MaxSize      int   `json:"max_size"`
 }
 
 // DiscoveryRequest represents a request to discover a server
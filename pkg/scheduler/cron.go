@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed five-field cron expression
+// (minute hour day-of-month month day-of-week)
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+}
+
+// cronField describes the valid range of a cron field
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cronMacros maps the supported @ shortcuts onto their expressions
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a standard five-field cron expression. Fields accept
+// "*", single values, ranges ("1-5"), lists ("1,15") and steps ("*/10").
+func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %q: expected %d fields, got %d", expr, len(cronFields), len(fields))
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+		bits[i] = b
+	}
+
+	// Sunday may be written as 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+		bits[4] &^= 1 << 7
+	}
+
+	return &CronSchedule{
+		minute:        bits[0],
+		hour:          bits[1],
+		dom:           bits[2],
+		month:         bits[3],
+		dow:           bits[4],
+		domRestricted: !strings.HasPrefix(fields[2], "*"),
+		dowRestricted: !strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField converts a single cron field into a bit set
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", spec.name, part)
+			}
+			rangePart, step = part[:idx], s
+		}
+
+		start, end := spec.min, spec.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			start, err1 = strconv.Atoi(bounds[0])
+			end, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range in %s field %q", spec.name, part)
+			}
+		default:
+			v, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %s field %q", spec.name, part)
+			}
+			start, end = v, v
+			if step > 1 {
+				end = spec.max
+			}
+		}
+
+		if start < spec.min || end > spec.max || start > end {
+			return 0, fmt.Errorf("%s field %q out of range %d-%d", spec.name, part, spec.min, spec.max)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Matches reports whether the schedule fires in the minute containing t
+func (s *CronSchedule) Matches(t time.Time) bool {
+	return s.minute&(1<<uint(t.Minute())) != 0 &&
+		s.hour&(1<<uint(t.Hour())) != 0 &&
+		s.month&(1<<uint(t.Month())) != 0 &&
+		s.dayMatches(t)
+}
+
+// dayMatches applies the cron rule that when both day fields are restricted
+// a day matches if either of them does
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// Next returns the first time after t at which the schedule fires, or the
+// zero time if it never fires within the next five years
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
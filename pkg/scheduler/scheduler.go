@@ -0,0 +1,258 @@
+// Package scheduler re-discovers the server inventory on cron schedules
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/controller"
+	"github.com/vobbilis/codegen/server-discovery/pkg/database"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// Scheduler queues discovery jobs whenever a stored schedule fires
+type Scheduler struct {
+	config *models.Config
+	db     *database.Database
+	ctrl   *controller.DiscoveryController
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a new discovery scheduler
+func NewScheduler(config *models.Config, db *database.Database, ctrl *controller.DiscoveryController) *Scheduler {
+	return &Scheduler{
+		config: config,
+		db:     db,
+		ctrl:   ctrl,
+		done:   make(chan struct{}),
+	}
+}
+
+// Start seeds the global schedule from the configuration if the database has
+// none yet, then evaluates the schedules at the start of every minute
+func (s *Scheduler) Start() {
+	if err := s.seedGlobalSchedule(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	log.Println("Discovery scheduler started")
+}
+
+// Stop stops the scheduler and waits for an in-progress tick to finish
+func (s *Scheduler) Stop() {
+	close(s.done)
+	s.wg.Wait()
+	log.Println("Discovery scheduler stopped")
+}
+
+// ValidateSchedule checks that a schedule has a valid cron expression and the
+// fields its scope requires, and returns the parsed expression
+func ValidateSchedule(schedule models.DiscoverySchedule) (*CronSchedule, error) {
+	if schedule.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	switch schedule.Scope {
+	case models.ScheduleScopeGlobal:
+	case models.ScheduleScopeRegion:
+		if schedule.Region == "" {
+			return nil, fmt.Errorf("region is required for region schedules")
+		}
+	case models.ScheduleScopeTag:
+		if schedule.TagName == "" {
+			return nil, fmt.Errorf("tag_name is required for tag schedules")
+		}
+	default:
+		return nil, fmt.Errorf("invalid scope %q: must be one of global, region, tag", schedule.Scope)
+	}
+
+	return ParseCron(schedule.CronExpression)
+}
+
+// seedGlobalSchedule creates the global schedule from discovery.schedule
+func (s *Scheduler) seedGlobalSchedule() error {
+	expr := s.config.Discovery.Schedule
+	if expr == "" {
+		return nil
+	}
+
+	schedules, err := s.db.GetSchedules()
+	if err != nil {
+		return err
+	}
+	for _, schedule := range schedules {
+		if schedule.Scope == models.ScheduleScopeGlobal {
+			return nil
+		}
+	}
+
+	schedule := models.DiscoverySchedule{
+		Name:           "default",
+		CronExpression: expr,
+		Scope:          models.ScheduleScopeGlobal,
+		Enabled:        true,
+	}
+	cron, err := ValidateSchedule(schedule)
+	if err != nil {
+		return fmt.Errorf("invalid discovery.schedule: %w", err)
+	}
+	if next := cron.Next(time.Now()); !next.IsZero() {
+		schedule.NextRunAt = &next
+	}
+
+	if _, err := s.db.CreateSchedule(schedule); err != nil {
+		return err
+	}
+	log.Printf("Created global discovery schedule %q from configuration", expr)
+	return nil
+}
+
+// run calls tick at the start of every minute until Stop is called
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		select {
+		case t := <-timer.C:
+			s.tick(t.Truncate(time.Minute))
+		case <-s.done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// tick queues discovery for every server whose governing schedule fires at now
+func (s *Scheduler) tick(now time.Time) {
+	schedules, err := s.db.GetSchedules()
+	if err != nil {
+		log.Printf("Warning: failed to load discovery schedules: %v", err)
+		return
+	}
+
+	var enabled []models.DiscoverySchedule
+	due := make(map[int]*CronSchedule)
+	for _, schedule := range schedules {
+		if !schedule.Enabled {
+			continue
+		}
+		cron, err := ParseCron(schedule.CronExpression)
+		if err != nil {
+			log.Printf("Warning: skipping discovery schedule %d: %v", schedule.ID, err)
+			continue
+		}
+		enabled = append(enabled, schedule)
+		if cron.Matches(now) {
+			due[schedule.ID] = cron
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	servers, err := s.db.GetAllServers()
+	if err != nil {
+		log.Printf("Warning: failed to load servers for scheduled discovery: %v", err)
+		return
+	}
+
+	queued, skipped := 0, 0
+	for _, server := range servers {
+		if !anyDue(schedulesForServer(server, enabled), due) {
+			continue
+		}
+		if s.ctrl.HasActiveJob(server.ID) {
+			skipped++
+			continue
+		}
+
+		details := &models.ServerDetails{
+			ID:              server.ID,
+			Hostname:        server.Hostname,
+			IP:              server.IP,
+			OSType:          server.OSType,
+			Region:          server.Region,
+			DiscoveryMethod: server.DiscoveryMethod,
+			CredentialRef:   server.CredentialRef,
+			Tags:            server.Tags,
+		}
+		if _, err := s.ctrl.EnqueueDiscovery(s.ctrl.ServerConfigFor(details)); err != nil {
+			log.Printf("Warning: failed to queue scheduled discovery for %s: %v", server.Hostname, err)
+			if err == controller.ErrControllerStopped {
+				break
+			}
+			continue
+		}
+		queued++
+	}
+
+	for id, cron := range due {
+		var nextRun *time.Time
+		if next := cron.Next(now); !next.IsZero() {
+			nextRun = &next
+		}
+		if err := s.db.MarkScheduleRun(id, now, nextRun); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	log.Printf("Scheduled discovery queued %d jobs (%d servers skipped with a job in flight)", queued, skipped)
+}
+
+// schedulesForServer returns the schedules that govern a server. Tag
+// schedules take precedence over region schedules, which take precedence
+// over global ones; a server follows only the most specific scope that has
+// a matching schedule.
+func schedulesForServer(server models.ServerWithDetails, schedules []models.DiscoverySchedule) []models.DiscoverySchedule {
+	var byTag, byRegion, global []models.DiscoverySchedule
+	for _, schedule := range schedules {
+		switch schedule.Scope {
+		case models.ScheduleScopeTag:
+			if hasTag(server.Tags, schedule.TagName, schedule.TagValue) {
+				byTag = append(byTag, schedule)
+			}
+		case models.ScheduleScopeRegion:
+			if schedule.Region == server.Region {
+				byRegion = append(byRegion, schedule)
+			}
+		case models.ScheduleScopeGlobal:
+			global = append(global, schedule)
+		}
+	}
+
+	switch {
+	case len(byTag) > 0:
+		return byTag
+	case len(byRegion) > 0:
+		return byRegion
+	default:
+		return global
+	}
+}
+
+// hasTag reports whether the tags include name, and value if one is given
+func hasTag(tags []models.Tag, name, value string) bool {
+	for _, tag := range tags {
+		if tag.TagName == name && (value == "" || tag.TagValue == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyDue reports whether any of the schedules is due
+func anyDue(schedules []models.DiscoverySchedule, due map[int]*CronSchedule) bool {
+	for _, schedule := range schedules {
+		if _, ok := due[schedule.ID]; ok {
+			return true
+		}
+	}
+	return false
+}
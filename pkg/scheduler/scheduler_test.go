@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestParseCron(t *testing.T) {
+	valid := []string{"* * * * *", "*/15 2-4 1,15 * 1-5", "0 0 * * 7", "@daily", "@hourly"}
+	for _, expr := range valid {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("ParseCron(%q) returned error: %v", expr, err)
+		}
+	}
+
+	invalid := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"}
+	for _, expr := range invalid {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2024, 1, 31, 22, 47, 30, 0, time.UTC) // a Wednesday
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 22, 48, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 23, 0, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 2, 1, 2, 0, 0, 0, time.UTC)},
+		{"30 1 29 2 *", time.Date(2024, 2, 29, 1, 30, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matching is enough
+		{"0 0 15 * 5", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		cron, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) returned error: %v", tt.expr, err)
+		}
+		if got := cron.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+		if !cron.Matches(tt.want) {
+			t.Errorf("Matches(%q) = false at %s", tt.expr, tt.want)
+		}
+	}
+}
+
+func TestSchedulesForServer(t *testing.T) {
+	schedules := []models.DiscoverySchedule{
+		{ID: 1, Scope: models.ScheduleScopeGlobal},
+		{ID: 2, Scope: models.ScheduleScopeRegion, Region: "eu-west"},
+		{ID: 3, Scope: models.ScheduleScopeTag, TagName: "env", TagValue: "prod"},
+		{ID: 4, Scope: models.ScheduleScopeTag, TagName: "critical"},
+	}
+
+	tests := []struct {
+		name   string
+		server models.ServerWithDetails
+		want   []int
+	}{
+		{"global", models.ServerWithDetails{Region: "us-east"}, []int{1}},
+		{"region", models.ServerWithDetails{Region: "eu-west"}, []int{2}},
+		{"tag value", models.ServerWithDetails{Region: "eu-west", Tags: []models.Tag{{TagName: "env", TagValue: "prod"}}}, []int{3}},
+		{"tag value mismatch", models.ServerWithDetails{Region: "eu-west", Tags: []models.Tag{{TagName: "env", TagValue: "dev"}}}, []int{2}},
+		{"any tag value", models.ServerWithDetails{Tags: []models.Tag{{TagName: "critical", TagValue: "yes"}, {TagName: "env", TagValue: "prod"}}}, []int{3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := schedulesForServer(tt.server, schedules)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d schedules, want %v", len(got), tt.want)
+			}
+			for i, schedule := range got {
+				if schedule.ID != tt.want[i] {
+					t.Errorf("schedule %d = %d, want %d", i, schedule.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -4,30 +4,40 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 	"github.com/vobbilis/codegen/server-discovery/pkg/controller"
 	"github.com/vobbilis/codegen/server-discovery/pkg/database"
+	"github.com/vobbilis/codegen/server-discovery/pkg/ingest"
 	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+	"github.com/vobbilis/codegen/server-discovery/pkg/scheduler"
+	"github.com/vobbilis/codegen/server-discovery/pkg/sweep"
 )
 
+// maxIngestBytes bounds the size of an inventory pushed to /api/ingest
+const maxIngestBytes = 32 << 20
+
 type APIServer struct {
 	config        *models.Config
 	db            *database.Database
 	router        *mux.Router
 	discoveryCtrl *controller.DiscoveryController
+	sweeper       *sweep.Sweeper
 }
 
-func NewAPIServer(config *models.Config, db *database.Database, discoveryCtrl *controller.DiscoveryController) *APIServer {
+func NewAPIServer(config *models.Config, db *database.Database, discoveryCtrl *controller.DiscoveryController, sweeper *sweep.Sweeper) *APIServer {
 	server := &APIServer{
 		config:        config,
 		db:            db,
 		router:        mux.NewRouter(),
 		discoveryCtrl: discoveryCtrl,
+		sweeper:       sweeper,
 	}
 
 	server.setupRoutes()
@@ -36,16 +46,45 @@ func NewAPIServer(config *models.Config, db *database.Database, discoveryCtrl *c
 
 func (s *APIServer) setupRoutes() {
 	s.router.HandleFunc("/api/stats", s.handleGetStats).Methods("GET")
+	s.router.HandleFunc("/api/stats/connection-pool", s.handleGetConnectionPoolStats).Methods("GET")
 	s.router.HandleFunc("/api/servers", s.handleGetServers).Methods("GET")
 	s.router.HandleFunc("/api/servers/{id}", s.handleGetServerByID).Methods("GET")
 	s.router.HandleFunc("/api/servers/{id}/discoveries", s.handleGetServerDiscoveries).Methods("GET")
+	s.router.HandleFunc("/api/servers/{id}/discover", s.handleDiscoverServer).Methods("POST")
+	s.router.HandleFunc("/api/servers/{id}/cache", s.handleInvalidateServerCache).Methods("DELETE")
+	s.router.HandleFunc("/api/cache", s.handleClearCache).Methods("DELETE")
+	s.router.HandleFunc("/api/discovery-methods", s.handleGetDiscoveryMethods).Methods("GET")
 	s.router.HandleFunc("/api/discoveries", s.handleGetAllDiscoveries).Methods("GET")
 	s.router.HandleFunc("/api/discoveries/{id}", s.handleGetDiscoveryByID).Methods("GET")
 	s.router.HandleFunc("/api/servers/{id}/open-ports", s.handleGetServerOpenPorts).Methods("GET")
 	s.router.HandleFunc("/api/servers/{id}/ip-addresses", s.handleGetServerIPAddresses).Methods("GET")
 	s.router.HandleFunc("/api/servers/{id}/installed-software", s.handleGetServerInstalledSoftware).Methods("GET")
 	s.router.HandleFunc("/api/servers/{id}/filesystems", s.handleGetServerFilesystems).Methods("GET")
+	s.router.HandleFunc("/api/servers/{id}/ssh-keys", s.handleGetServerSSHKeys).Methods("GET")
+	s.router.HandleFunc("/api/servers/{id}/ssh-keys", s.handleDeleteServerSSHKeys).Methods("DELETE")
+	s.router.HandleFunc("/api/servers/{id}/discovery-method", s.handleSetServerDiscoveryMethod).Methods("PUT")
+	s.router.HandleFunc("/api/servers/{id}/credential-ref", s.handleSetServerCredentialRef).Methods("PUT")
+	s.router.HandleFunc("/api/servers/{id}/agent-token", s.handleCreateAgentToken).Methods("POST")
+	s.router.HandleFunc("/api/servers/{id}/agent-token", s.handleDeleteAgentToken).Methods("DELETE")
+	s.router.HandleFunc("/api/ingest", s.handleIngest).Methods("POST")
 	s.router.HandleFunc("/api/server-tags", s.handleGetServerTags).Methods("GET")
+	s.router.HandleFunc("/api/jobs", s.handleGetJobs).Methods("GET")
+	s.router.HandleFunc("/api/jobs", s.handleCreateJobs).Methods("POST")
+	s.router.HandleFunc("/api/jobs/{id}", s.handleGetJobByID).Methods("GET")
+	s.router.HandleFunc("/api/jobs/{id}", s.handleCancelJob).Methods("DELETE")
+	s.router.HandleFunc("/api/workers", s.handleGetWorkers).Methods("GET")
+	s.router.HandleFunc("/api/schedules", s.handleGetSchedules).Methods("GET")
+	s.router.HandleFunc("/api/schedules", s.handleCreateSchedule).Methods("POST")
+	s.router.HandleFunc("/api/schedules/{id}", s.handleGetScheduleByID).Methods("GET")
+	s.router.HandleFunc("/api/schedules/{id}", s.handleUpdateSchedule).Methods("PUT")
+	s.router.HandleFunc("/api/schedules/{id}", s.handleDeleteSchedule).Methods("DELETE")
+	s.router.HandleFunc("/api/sweeps", s.handleGetSweeps).Methods("GET")
+	s.router.HandleFunc("/api/sweeps", s.handleCreateSweep).Methods("POST")
+	s.router.HandleFunc("/api/sweeps/{id}", s.handleGetSweepByID).Methods("GET")
+	s.router.HandleFunc("/api/sweeps/{id}", s.handleCancelSweep).Methods("DELETE")
+	s.router.HandleFunc("/api/candidates", s.handleGetCandidates).Methods("GET")
+	s.router.HandleFunc("/api/candidates/{id}/approve", s.handleApproveCandidate).Methods("POST")
+	s.router.HandleFunc("/api/candidates/{id}/reject", s.handleRejectCandidate).Methods("POST")
 	s.router.HandleFunc("/api/query", s.handleSQLQuery).Methods("POST")
 
 	// Print registered routes for debugging
@@ -98,6 +137,7 @@ func (s *APIServer) handleGetStats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	stats["discovery_count"] = len(discoveries)
+	stats["jobs"] = s.discoveryCtrl.JobProgress()
 
 	// Calculate success rate
 	successCount := 0
@@ -126,6 +166,10 @@ func (s *APIServer) handleGetStats(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, stats)
 }
 
+func (s *APIServer) handleGetConnectionPoolStats(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, s.discoveryCtrl.ConnectionPoolStats())
+}
+
 func (s *APIServer) handleGetServers(w http.ResponseWriter, r *http.Request) {
 	servers, err := s.db.GetAllServers()
 	if err != nil {
@@ -153,6 +197,74 @@ func (s *APIServer) handleGetServerDiscoveries(w http.ResponseWriter, r *http.Re
 	respondWithJSON(w, http.StatusOK, discoveries)
 }
 
+func (s *APIServer) handleDiscoverServer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid server ID"})
+		return
+	}
+
+	server, err := s.db.GetServerDetails(strconv.Itoa(serverID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Server not found"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	serverConfig := s.discoveryCtrl.ServerConfigFor(server)
+	serverConfig.Force = r.URL.Query().Get("force") == "true"
+	job, err := s.discoveryCtrl.EnqueueDiscovery(serverConfig)
+	if err != nil {
+		respondWithJSON(w, enqueueErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"job_id":    job.ID,
+		"server_id": serverID,
+		"status":    job.Status,
+		"force":     serverConfig.Force,
+	})
+}
+
+// handleInvalidateServerCache drops a server's cached discovery results
+func (s *APIServer) handleInvalidateServerCache(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid server ID"})
+		return
+	}
+
+	dropped, err := s.discoveryCtrl.InvalidateCache(serverID)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"server_id":   serverID,
+		"invalidated": dropped,
+	})
+}
+
+// handleClearCache drops every cached discovery result
+func (s *APIServer) handleClearCache(w http.ResponseWriter, r *http.Request) {
+	dropped, err := s.discoveryCtrl.ClearCache()
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"invalidated": dropped,
+	})
+}
+
 func (s *APIServer) handleGetServerTags(w http.ResponseWriter, r *http.Request) {
 	// Get all unique tags from the database
 	tags, err := s.db.GetAllServerTags()
@@ -260,6 +372,224 @@ func (s *APIServer) handleGetServerFilesystems(w http.ResponseWriter, r *http.Re
 	respondWithJSON(w, http.StatusOK, filesystems)
 }
 
+func (s *APIServer) handleGetServerSSHKeys(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid server ID"})
+		return
+	}
+
+	keys, err := s.db.GetSSHHostKeys(serverID)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+// handleDeleteServerSSHKeys forgets a server's trusted host keys after it has
+// been legitimately rekeyed; the next discovery trusts the new key
+func (s *APIServer) handleDeleteServerSSHKeys(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid server ID"})
+		return
+	}
+
+	if _, err := s.db.DeleteSSHHostKeys(serverID); err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if _, err := s.discoveryCtrl.InvalidateCache(serverID); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetDiscoveryMethods lists the registered discovery methods and their capabilities
+func (s *APIServer) handleGetDiscoveryMethods(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, s.discoveryCtrl.DiscoveryMethods().Methods())
+}
+
+// handleSetServerDiscoveryMethod pins the discovery method of a server, or
+// with an empty method goes back to picking it from the server's OS type
+func (s *APIServer) handleSetServerDiscoveryMethod(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid server ID"})
+		return
+	}
+
+	var request struct {
+		Method string `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if _, ok := s.discoveryCtrl.DiscoveryMethods().Lookup(request.Method); request.Method != "" && !ok {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Unknown discovery method %q", request.Method)})
+		return
+	}
+
+	if err := s.db.SetServerDiscoveryMethod(serverID, request.Method); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Server not found"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"server_id":        serverID,
+		"discovery_method": request.Method,
+	})
+}
+
+// handleSetServerCredentialRef sets the credential a server is discovered
+// with, or with an empty reference goes back to server.credential_ref
+func (s *APIServer) handleSetServerCredentialRef(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid server ID"})
+		return
+	}
+
+	var request struct {
+		CredentialRef string `json:"credential_ref"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if err := s.db.SetServerCredentialRef(serverID, request.CredentialRef); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Server not found"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"server_id":      serverID,
+		"credential_ref": request.CredentialRef,
+	})
+}
+
+// handleCreateAgentToken issues a new token for the server's push agent,
+// replacing any previous one. The token is only ever returned here.
+func (s *APIServer) handleCreateAgentToken(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid server ID"})
+		return
+	}
+
+	if _, err := s.db.GetServerDetails(strconv.Itoa(serverID)); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Server not found"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	token, err := ingest.GenerateToken()
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := s.db.SetAgentToken(serverID, token); err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"server_id": serverID,
+		"token":     token,
+	})
+}
+
+// handleDeleteAgentToken revokes the server's push agent token
+func (s *APIServer) handleDeleteAgentToken(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid server ID"})
+		return
+	}
+
+	deleted, err := s.db.DeleteAgentToken(serverID)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if deleted == 0 {
+		respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Agent token not found"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleIngest accepts a server_details.json pushed by an agent that the
+// controller cannot reach, signed with the server's agent token, and stores
+// it like a pulled discovery
+func (s *APIServer) handleIngest(w http.ResponseWriter, r *http.Request) {
+	serverID, err := strconv.Atoi(r.Header.Get(ingest.HeaderServerID))
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid server ID"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBytes))
+	if err != nil {
+		respondWithJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "Request body too large"})
+		return
+	}
+
+	token, err := s.db.GetAgentToken(serverID)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if err == sql.ErrNoRows || ingest.Verify(token, r.Header.Get(ingest.HeaderTimestamp),
+		r.Header.Get(ingest.HeaderSignature), body, time.Now()) != nil {
+		log.Printf("Warning: rejected pushed inventory for server %d", serverID)
+		respondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid agent signature"})
+		return
+	}
+
+	result, err := ingest.Result(serverID, body, time.Now())
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	discoveryID, err := s.discoveryCtrl.StoreResultInDatabase(result)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := s.db.TouchAgentToken(serverID); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"discovery_id": discoveryID,
+		"server_id":    serverID,
+	})
+}
+
 func (s *APIServer) handleGetAllDiscoveries(w http.ResponseWriter, r *http.Request) {
 	discoveries, err := s.db.GetAllDiscoveries()
 	if err != nil {
@@ -354,6 +684,449 @@ func (s *APIServer) handleSQLQuery(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, results)
 }
 
+func (s *APIServer) handleGetJobs(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+
+	jobs, err := s.db.GetDiscoveryJobs(status, limit)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, jobs)
+}
+
+func (s *APIServer) handleGetJobByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	job, err := s.db.GetDiscoveryJobByID(vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Job not found"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+func (s *APIServer) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobID := vars["id"]
+
+	if err := s.discoveryCtrl.CancelJob(jobID); err != nil {
+		if err != controller.ErrJobNotActive {
+			respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		// Distinguish unknown jobs from jobs that already finished
+		job, dbErr := s.db.GetDiscoveryJobByID(jobID)
+		if dbErr == sql.ErrNoRows {
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Job not found"})
+			return
+		}
+		if dbErr != nil {
+			respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": dbErr.Error()})
+			return
+		}
+		respondWithJSON(w, http.StatusConflict, map[string]string{
+			"error":  err.Error(),
+			"status": job.Status,
+		})
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, map[string]string{
+		"job_id": jobID,
+		"status": "cancelling",
+	})
+}
+
+// handleGetWorkers lists the worker processes registered for distributed discovery
+func (s *APIServer) handleGetWorkers(w http.ResponseWriter, r *http.Request) {
+	workers, err := s.db.GetWorkerNodes()
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, workers)
+}
+
+// handleCreateJobs queues discovery jobs for a batch of servers
+func (s *APIServer) handleCreateJobs(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ServerIDs []int `json:"server_ids"`
+		Force     bool  `json:"force"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if len(request.ServerIDs) == 0 {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "server_ids is required"})
+		return
+	}
+
+	jobs := make([]models.DiscoveryJob, 0, len(request.ServerIDs))
+	failures := make(map[int]string)
+	for _, serverID := range request.ServerIDs {
+		server, err := s.db.GetServerDetails(strconv.Itoa(serverID))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				failures[serverID] = "Server not found"
+			} else {
+				failures[serverID] = err.Error()
+			}
+			continue
+		}
+
+		serverConfig := s.discoveryCtrl.ServerConfigFor(server)
+		serverConfig.Force = request.Force
+		job, err := s.discoveryCtrl.EnqueueDiscovery(serverConfig)
+		if err != nil {
+			failures[serverID] = err.Error()
+			continue
+		}
+		jobs = append(jobs, *job)
+	}
+
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"jobs":   jobs,
+		"errors": failures,
+	})
+}
+
+func (s *APIServer) handleGetSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := s.db.GetSchedules()
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, schedules)
+}
+
+func (s *APIServer) handleGetScheduleByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid schedule ID"})
+		return
+	}
+
+	schedule, err := s.db.GetScheduleByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Schedule not found"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, schedule)
+}
+
+// handleCreateSchedule stores a new discovery schedule. Scope defaults to
+// global and new schedules are enabled unless "enabled" is false.
+func (s *APIServer) handleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule := models.DiscoverySchedule{
+		Scope:   models.ScheduleScopeGlobal,
+		Enabled: true,
+	}
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if err := prepareSchedule(&schedule); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	id, err := s.db.CreateSchedule(schedule)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	created, err := s.db.GetScheduleByID(id)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+// handleUpdateSchedule applies the fields present in the request body to an
+// existing schedule
+func (s *APIServer) handleUpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid schedule ID"})
+		return
+	}
+
+	schedule, err := s.db.GetScheduleByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Schedule not found"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(schedule); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	schedule.ID = id
+
+	if err := prepareSchedule(schedule); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.UpdateSchedule(*schedule); err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	updated, err := s.db.GetScheduleByID(id)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+func (s *APIServer) handleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid schedule ID"})
+		return
+	}
+
+	if err := s.db.DeleteSchedule(id); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Schedule not found"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetSweeps lists the most recent sweeps, up to ?limit= (default 100)
+func (s *APIServer) handleGetSweeps(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid limit"})
+			return
+		}
+		limit = n
+	}
+
+	sweeps, err := s.db.GetNetworkSweeps(limit)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, sweeps)
+}
+
+func (s *APIServer) handleGetSweepByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sweepID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid sweep ID"})
+		return
+	}
+
+	networkSweep, err := s.db.GetNetworkSweepByID(sweepID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Sweep not found"})
+			return
+		}
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, networkSweep)
+}
+
+// handleCreateSweep starts probing the given CIDR ranges in the background;
+// progress is read back from GET /api/sweeps/{id}
+func (s *APIServer) handleCreateSweep(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		CIDRs []string `json:"cidrs"`
+		Ports []int    `json:"ports"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	networkSweep, err := s.sweeper.Sweep(request.CIDRs, request.Ports)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, networkSweep)
+}
+
+func (s *APIServer) handleCancelSweep(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sweepID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid sweep ID"})
+		return
+	}
+
+	if err := s.sweeper.Cancel(sweepID); err != nil {
+		respondWithJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"sweep_id": sweepID,
+		"status":   "cancelling",
+	})
+}
+
+func (s *APIServer) handleGetCandidates(w http.ResponseWriter, r *http.Request) {
+	candidates, err := s.db.GetServerCandidates(r.URL.Query().Get("status"))
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, candidates)
+}
+
+// handleApproveCandidate adds a sweep candidate to the inventory. The body
+// may override the hostname and OS type the sweep found and set a region.
+func (s *APIServer) handleApproveCandidate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	candidateID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid candidate ID"})
+		return
+	}
+
+	var request struct {
+		Hostname string `json:"hostname"`
+		Region   string `json:"region"`
+		OSType   string `json:"os_type"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	serverID, err := s.db.ApproveServerCandidate(candidateID, request.Hostname, request.Region, request.OSType)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Candidate not found"})
+		case database.ErrCandidateResolved, database.ErrServerExists:
+			respondWithJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		default:
+			respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"candidate_id": candidateID,
+		"server_id":    serverID,
+	})
+}
+
+func (s *APIServer) handleRejectCandidate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	candidateID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid candidate ID"})
+		return
+	}
+
+	if err := s.db.RejectServerCandidate(candidateID); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			respondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Candidate not found"})
+		case database.ErrCandidateResolved:
+			respondWithJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		default:
+			respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// prepareSchedule validates a schedule, clears fields that do not apply to
+// its scope and computes its next run time
+func prepareSchedule(schedule *models.DiscoverySchedule) error {
+	cron, err := scheduler.ValidateSchedule(*schedule)
+	if err != nil {
+		return err
+	}
+
+	if schedule.Scope != models.ScheduleScopeRegion {
+		schedule.Region = ""
+	}
+	if schedule.Scope != models.ScheduleScopeTag {
+		schedule.TagName = ""
+		schedule.TagValue = ""
+	}
+
+	schedule.NextRunAt = nil
+	if next := cron.Next(time.Now()); !next.IsZero() && schedule.Enabled {
+		schedule.NextRunAt = &next
+	}
+	return nil
+}
+
+// enqueueErrorStatus maps a job queue error onto an HTTP status code
+func enqueueErrorStatus(err error) int {
+	if err == controller.ErrJobQueueFull || err == controller.ErrControllerStopped {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, err := json.Marshal(payload)
 	if err != nil {
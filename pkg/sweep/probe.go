@@ -0,0 +1,167 @@
+package sweep
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// Well-known ports of the management services a sweep looks for
+const (
+	PortSSH       = 22
+	PortWinRMHTTP = 5985
+	PortWinRMTLS  = 5986
+	PortRDP       = 3389
+)
+
+// DefaultPorts are probed when neither the sweep nor the configuration names any
+var DefaultPorts = []int{PortSSH, PortWinRMHTTP, PortWinRMTLS, PortRDP}
+
+// maxBannerBytes bounds how much of a service's greeting is kept
+const maxBannerBytes = 256
+
+// Prober checks a single host for open management ports
+type Prober struct {
+	ports   []int
+	timeout time.Duration
+	dialer  net.Dialer
+
+	// lookupAddr resolves an address to host names, net.DefaultResolver in production
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+}
+
+// NewProber creates a prober for ports, with timeout bounding each connection
+// attempt and banner read
+func NewProber(ports []int, timeout time.Duration) *Prober {
+	return &Prober{
+		ports:      ports,
+		timeout:    timeout,
+		dialer:     net.Dialer{Timeout: timeout},
+		lookupAddr: net.DefaultResolver.LookupAddr,
+	}
+}
+
+// Probe connects to each port of addr and, if any is open, returns the host
+// as a candidate with its reverse DNS name, the banners of its open ports and
+// a guess at its OS type
+func (p *Prober) Probe(ctx context.Context, addr netip.Addr) (models.ServerCandidate, bool) {
+	candidate := models.ServerCandidate{IP: addr.String()}
+	for _, port := range p.ports {
+		if ctx.Err() != nil {
+			return candidate, false
+		}
+		conn, err := p.dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr.String(), strconv.Itoa(port)))
+		if err != nil {
+			continue
+		}
+		banner := p.grabBanner(conn, addr, port)
+		conn.Close()
+		candidate.Ports = append(candidate.Ports, models.CandidatePort{Port: port, Banner: banner})
+	}
+	if len(candidate.Ports) == 0 {
+		return candidate, false
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	if names, err := p.lookupAddr(lookupCtx, addr.String()); err == nil && len(names) > 0 {
+		candidate.Hostname = strings.TrimSuffix(names[0], ".")
+	}
+	candidate.OSType = GuessOSType(candidate.Ports)
+	return candidate, true
+}
+
+// grabBanner reads what identifies the service on an open port: the SSH
+// version line, the HTTP Server header of WinRM, or the subject of the WinRM
+// TLS certificate. RDP sends nothing before the client speaks, so its banner
+// stays empty; services on other ports are read for a greeting.
+func (p *Prober) grabBanner(conn net.Conn, addr netip.Addr, port int) string {
+	conn.SetDeadline(time.Now().Add(p.timeout))
+
+	switch port {
+	case PortRDP:
+		return ""
+	case PortWinRMHTTP:
+		return httpServerHeader(conn, addr, port)
+	case PortWinRMTLS:
+		tlsConn := tls.Client(conn, &tls.Config{
+			// Only the certificate's subject is read; nothing is trusted
+			InsecureSkipVerify: true,
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return ""
+		}
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			return "CN=" + certs[0].Subject.CommonName
+		}
+		return ""
+	default:
+		line, _ := bufio.NewReaderSize(conn, maxBannerBytes).ReadString('\n')
+		return truncate(strings.TrimSpace(line))
+	}
+}
+
+// httpServerHeader sends a WS-Management request and returns the response's
+// Server header, e.g. "Microsoft-HTTPAPI/2.0"
+func httpServerHeader(conn net.Conn, addr netip.Addr, port int) string {
+	host := net.JoinHostPort(addr.String(), strconv.Itoa(port))
+	if _, err := fmt.Fprintf(conn, "GET /wsman HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", host); err != nil {
+		return ""
+	}
+
+	reader := bufio.NewReader(conn)
+	for i := 0; i < 50; i++ {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Server") {
+			return truncate(strings.TrimSpace(value))
+		}
+		if err != nil || (line == "" && i > 0) {
+			break
+		}
+	}
+	return ""
+}
+
+// GuessOSType guesses a host's OS type from its open ports and banners.
+// WinRM and RDP only run on Windows, and OpenSSH names the distribution in
+// its version line; a host with only SSH open is assumed to run Linux.
+func GuessOSType(ports []models.CandidatePort) string {
+	var ssh bool
+	for _, p := range ports {
+		switch p.Port {
+		case PortWinRMHTTP, PortWinRMTLS, PortRDP:
+			return "windows"
+		}
+		banner := strings.ToLower(p.Banner)
+		if strings.HasPrefix(banner, "ssh-") {
+			if strings.Contains(banner, "windows") {
+				return "windows"
+			}
+			ssh = true
+		}
+		if p.Port == PortSSH {
+			ssh = true
+		}
+	}
+	if ssh {
+		return "linux"
+	}
+	return ""
+}
+
+// truncate bounds a banner to maxBannerBytes
+func truncate(banner string) string {
+	if len(banner) > maxBannerBytes {
+		return banner[:maxBannerBytes]
+	}
+	return banner
+}
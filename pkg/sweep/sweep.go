@@ -0,0 +1,267 @@
+// Package sweep finds servers that are not in the inventory yet by probing
+// CIDR ranges for SSH, WinRM and RDP. Hosts that answer are recorded as
+// candidates, which an operator approves into the inventory through the API.
+package sweep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/database"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+const (
+	defaultConcurrency = 64
+	defaultTimeout     = 2 * time.Second
+	defaultMaxHosts    = 65536
+
+	// progressEvery is how many probed hosts pass between progress updates
+	progressEvery = 256
+)
+
+// ErrSweepNotRunning is returned when cancelling a sweep that is not running
+var ErrSweepNotRunning = errors.New("network sweep is not running")
+
+// Sweeper runs network sweeps in the background and records what they find
+type Sweeper struct {
+	config *models.Config
+	db     *database.Database
+
+	mu      sync.Mutex
+	running map[int]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewSweeper creates a new network sweeper
+func NewSweeper(config *models.Config, db *database.Database) *Sweeper {
+	return &Sweeper{
+		config:  config,
+		db:      db,
+		running: make(map[int]context.CancelFunc),
+	}
+}
+
+// Start marks sweeps left running by a previous process as failed
+func (s *Sweeper) Start() {
+	if n, err := s.db.FailInterruptedNetworkSweeps(); err != nil {
+		log.Printf("Warning: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted network sweeps as failed", n)
+	}
+}
+
+// Stop cancels the running sweeps and waits for them to finish
+func (s *Sweeper) Stop() {
+	s.mu.Lock()
+	for _, cancel := range s.running {
+		cancel()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	log.Println("Network sweeper stopped")
+}
+
+// Sweep starts probing cidrs on ports, or on the configured ports when none
+// are given, and returns the new sweep. Addresses already in the inventory
+// are skipped.
+func (s *Sweeper) Sweep(cidrs []string, ports []int) (*models.NetworkSweep, error) {
+	if len(ports) == 0 {
+		ports = s.config.Sweep.Ports
+	}
+	if len(ports) == 0 {
+		ports = DefaultPorts
+	}
+	for _, port := range ports {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %d", port)
+		}
+	}
+
+	maxHosts := s.config.Sweep.MaxHosts
+	if maxHosts <= 0 {
+		maxHosts = defaultMaxHosts
+	}
+	addrs, err := ExpandCIDRs(cidrs, maxHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	known, err := s.db.GetInventoryIPs()
+	if err != nil {
+		return nil, err
+	}
+	targets := addrs[:0]
+	for _, addr := range addrs {
+		if !known[addr.String()] {
+			targets = append(targets, addr)
+		}
+	}
+
+	sweep := models.NetworkSweep{
+		CIDRs:      cidrs,
+		Ports:      ports,
+		Status:     models.SweepStatusRunning,
+		TotalHosts: len(targets),
+		StartedAt:  time.Now(),
+	}
+	if sweep.ID, err = s.db.CreateNetworkSweep(sweep); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.running[sweep.ID] = cancel
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.run(ctx, sweep, targets)
+	log.Printf("Started network sweep %d of %d hosts in %v", sweep.ID, len(targets), cidrs)
+	return &sweep, nil
+}
+
+// Cancel stops a running sweep. Candidates found so far are kept.
+func (s *Sweeper) Cancel(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cancel, ok := s.running[id]
+	if !ok {
+		return ErrSweepNotRunning
+	}
+	cancel()
+	return nil
+}
+
+// run probes targets with bounded concurrency, storing each host that answers
+// as a candidate and the sweep's progress as it goes
+func (s *Sweeper) run(ctx context.Context, sweep models.NetworkSweep, targets []netip.Addr) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		s.running[sweep.ID]()
+		delete(s.running, sweep.ID)
+		s.mu.Unlock()
+	}()
+
+	timeout := defaultTimeout
+	if s.config.Sweep.TimeoutSeconds > 0 {
+		timeout = time.Duration(s.config.Sweep.TimeoutSeconds) * time.Second
+	}
+	concurrency := s.config.Sweep.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	prober := NewProber(sweep.Ports, timeout)
+
+	addrs := make(chan netip.Addr)
+	found := make(chan *models.ServerCandidate)
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for addr := range addrs {
+				if candidate, ok := prober.Probe(ctx, addr); ok {
+					found <- &candidate
+				} else {
+					found <- nil
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(addrs)
+		for _, addr := range targets {
+			select {
+			case addrs <- addr:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		workers.Wait()
+		close(found)
+	}()
+
+	sweepID := sweep.ID
+	for candidate := range found {
+		sweep.ProbedHosts++
+		if candidate != nil && ctx.Err() == nil {
+			candidate.SweepID = &sweepID
+			candidate.LastSeen = time.Now()
+			if err := s.db.UpsertServerCandidate(*candidate); err != nil {
+				log.Printf("Warning: %v", err)
+			} else {
+				sweep.FoundHosts++
+			}
+		}
+		if sweep.ProbedHosts%progressEvery == 0 {
+			if err := s.db.UpdateNetworkSweep(sweep); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+	}
+
+	sweep.Status = models.SweepStatusCompleted
+	if ctx.Err() != nil {
+		sweep.Status = models.SweepStatusCancelled
+	}
+	finished := time.Now()
+	sweep.FinishedAt = &finished
+	if err := s.db.UpdateNetworkSweep(sweep); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	log.Printf("Network sweep %d %s: probed %d hosts, found %d", sweep.ID, sweep.Status, sweep.ProbedHosts, sweep.FoundHosts)
+}
+
+// ExpandCIDRs returns the host addresses of cidrs, failing if there are more
+// than maxHosts. The network and broadcast addresses of IPv4 ranges larger
+// than /31 are left out, and a plain address is taken as a single host.
+func ExpandCIDRs(cidrs []string, maxHosts int) ([]netip.Addr, error) {
+	if len(cidrs) == 0 {
+		return nil, fmt.Errorf("at least one CIDR range is required")
+	}
+
+	seen := make(map[netip.Addr]bool)
+	var addrs []netip.Addr
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid CIDR range %q: %w", cidr, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefix = prefix.Masked()
+
+		hostBits := prefix.Addr().BitLen() - prefix.Bits()
+		if hostBits >= 31 || len(addrs)+(1<<hostBits) > maxHosts+2 {
+			return nil, fmt.Errorf("sweep of %v exceeds the limit of %d hosts", cidrs, maxHosts)
+		}
+		skipEnds := prefix.Addr().Is4() && hostBits > 1
+
+		for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+			if skipEnds && (addr == prefix.Addr() || !prefix.Contains(addr.Next())) {
+				continue
+			}
+			if !seen[addr] {
+				seen[addr] = true
+				addrs = append(addrs, addr)
+			}
+			if len(addrs) > maxHosts {
+				return nil, fmt.Errorf("sweep of %v exceeds the limit of %d hosts", cidrs, maxHosts)
+			}
+			if !addr.Next().IsValid() {
+				break
+			}
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,100 @@
+package sweep
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestExpandCIDRs(t *testing.T) {
+	addrs, err := ExpandCIDRs([]string{"10.0.0.0/30", "10.0.0.2", "10.0.1.8/31"}, 16)
+	if err != nil {
+		t.Fatalf("ExpandCIDRs returned error: %v", err)
+	}
+	want := []string{"10.0.0.1", "10.0.0.2", "10.0.1.8", "10.0.1.9"}
+	if len(addrs) != len(want) {
+		t.Fatalf("got %v, want %v", addrs, want)
+	}
+	for i, addr := range addrs {
+		if addr.String() != want[i] {
+			t.Errorf("address %d = %s, want %s", i, addr, want[i])
+		}
+	}
+
+	for _, cidrs := range [][]string{nil, {"10.0.0.0/33"}, {"not-a-range"}, {"10.0.0.0/24"}, {"fd00::/64"}} {
+		if _, err := ExpandCIDRs(cidrs, 16); err == nil {
+			t.Errorf("expected an error for %v", cidrs)
+		}
+	}
+}
+
+func TestGuessOSType(t *testing.T) {
+	tests := []struct {
+		ports []models.CandidatePort
+		want  string
+	}{
+		{[]models.CandidatePort{{Port: 22, Banner: "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.7"}}, "linux"},
+		{[]models.CandidatePort{{Port: 22, Banner: "SSH-2.0-OpenSSH_for_Windows_8.1"}}, "windows"},
+		{[]models.CandidatePort{{Port: 22}, {Port: 3389}}, "windows"},
+		{[]models.CandidatePort{{Port: 5985, Banner: "Microsoft-HTTPAPI/2.0"}}, "windows"},
+		{[]models.CandidatePort{{Port: 2222, Banner: "SSH-2.0-OpenSSH_9.6"}}, "linux"},
+		{[]models.CandidatePort{{Port: 8080}}, ""},
+	}
+	for _, tt := range tests {
+		if got := GuessOSType(tt.ports); got != tt.want {
+			t.Errorf("GuessOSType(%+v) = %q, want %q", tt.ports, got, tt.want)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.7\r\n"))
+			conn.Close()
+		}
+	}()
+
+	// A port that was just closed refuses connections
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	openPort := listener.Addr().(*net.TCPAddr).Port
+	prober := NewProber([]int{closedPort, openPort}, time.Second)
+	prober.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		return []string{"web01.example.com."}, nil
+	}
+
+	candidate, ok := prober.Probe(context.Background(), netip.MustParseAddr("127.0.0.1"))
+	if !ok {
+		t.Fatal("expected the host to be found")
+	}
+	if len(candidate.Ports) != 1 || candidate.Ports[0].Port != openPort ||
+		candidate.Ports[0].Banner != "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.7" {
+		t.Errorf("unexpected ports: %+v", candidate.Ports)
+	}
+	if candidate.Hostname != "web01.example.com" || candidate.OSType != "linux" || candidate.IP != "127.0.0.1" {
+		t.Errorf("unexpected candidate: %+v", candidate)
+	}
+
+	if _, ok := NewProber([]int{closedPort}, time.Second).Probe(context.Background(), netip.MustParseAddr("127.0.0.1")); ok {
+		t.Error("expected a host without open ports not to be found")
+	}
+}
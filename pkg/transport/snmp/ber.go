@@ -0,0 +1,231 @@
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER tags of the ASN.1 types and PDUs used by SNMP
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagOID         = 0x06
+	tagSequence    = 0x30
+
+	pduGet      = 0xa0
+	pduGetNext  = 0xa1
+	pduResponse = 0xa2
+	pduGetBulk  = 0xa5
+	pduReport   = 0xa8
+)
+
+var errTruncated = errors.New("truncated BER encoding")
+
+// appendTLV appends a BER tag-length-value with a definite length
+func appendTLV(b []byte, tag byte, content []byte) []byte {
+	b = append(b, tag)
+	n := len(content)
+	switch {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xff:
+		b = append(b, 0x81, byte(n))
+	case n <= 0xffff:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, content...)
+}
+
+// sequence concatenates already encoded elements into a SEQUENCE
+func sequence(tag byte, elements ...[]byte) []byte {
+	var content []byte
+	for _, e := range elements {
+		content = append(content, e...)
+	}
+	return appendTLV(nil, tag, content)
+}
+
+// encodeInt encodes v as a minimal two's complement INTEGER of type tag
+func encodeInt(tag byte, v int64) []byte {
+	content := []byte{byte(v)}
+	for v > 0x7f || v < -0x80 {
+		v >>= 8
+		content = append([]byte{byte(v)}, content...)
+	}
+	return appendTLV(nil, tag, content)
+}
+
+// encodeUint encodes an unsigned value such as a Counter32 or Counter64
+func encodeUint(tag byte, v uint64) []byte {
+	content := []byte{byte(v)}
+	for v > 0xff {
+		v >>= 8
+		content = append([]byte{byte(v)}, content...)
+	}
+	if content[0]&0x80 != 0 {
+		content = append([]byte{0}, content...)
+	}
+	return appendTLV(nil, tag, content)
+}
+
+// encodeOID encodes a dotted object identifier such as "1.3.6.1.2.1.1.5.0"
+func encodeOID(oid string) ([]byte, error) {
+	arcs, err := parseOID(oid)
+	if err != nil {
+		return nil, err
+	}
+	if len(arcs) < 2 || arcs[0] > 2 || (arcs[0] < 2 && arcs[1] >= 40) {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+
+	content := appendBase128(nil, arcs[0]*40+arcs[1])
+	for _, arc := range arcs[2:] {
+		content = appendBase128(content, arc)
+	}
+	return appendTLV(nil, tagOID, content), nil
+}
+
+// appendBase128 appends an OID arc in base 128 with continuation bits
+func appendBase128(b []byte, v uint32) []byte {
+	var digits []byte
+	for {
+		digits = append([]byte{byte(v & 0x7f)}, digits...)
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := 0; i < len(digits)-1; i++ {
+		digits[i] |= 0x80
+	}
+	return append(b, digits...)
+}
+
+// readTLV splits the first tag-length-value off b. The returned content is
+// a subslice of b, which the v3 authentication relies on to find the
+// position of the authentication parameters in a received message.
+func readTLV(b []byte) (tag byte, content, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errTruncated
+	}
+	tag = b[0]
+	n := int(b[1])
+	offset := 2
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 4 || len(b) < 2+size {
+			return 0, nil, nil, fmt.Errorf("unsupported BER length encoding")
+		}
+		n = 0
+		for _, c := range b[2 : 2+size] {
+			n = n<<8 | int(c)
+		}
+		offset += size
+	}
+	if n < 0 || len(b)-offset < n {
+		return 0, nil, nil, errTruncated
+	}
+	return tag, b[offset : offset+n], b[offset+n:], nil
+}
+
+// readExpected reads a TLV and checks its tag
+func readExpected(b []byte, want byte) (content, rest []byte, err error) {
+	tag, content, rest, err := readTLV(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tag != want {
+		return nil, nil, fmt.Errorf("unexpected BER tag 0x%02x, want 0x%02x", tag, want)
+	}
+	return content, rest, nil
+}
+
+// readInt reads an INTEGER
+func readInt(b []byte) (int64, []byte, error) {
+	content, rest, err := readExpected(b, tagInteger)
+	if err != nil {
+		return 0, nil, err
+	}
+	return decodeInt(content), rest, nil
+}
+
+// readOctets reads an OCTET STRING
+func readOctets(b []byte) ([]byte, []byte, error) {
+	return readExpected(b, tagOctetString)
+}
+
+// decodeInt decodes a two's complement integer
+func decodeInt(content []byte) int64 {
+	var v int64
+	for i, c := range content {
+		if i == 0 && c&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// decodeUint decodes an unsigned integer
+func decodeUint(content []byte) uint64 {
+	var v uint64
+	for _, c := range content {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// decodeOID decodes object identifier content into dotted form
+func decodeOID(content []byte) (string, error) {
+	if len(content) == 0 {
+		return "", fmt.Errorf("empty OID")
+	}
+
+	var arcs []string
+	var v uint64
+	first := true
+	for i, c := range content {
+		v = v<<7 | uint64(c&0x7f)
+		if v > 1<<32 {
+			return "", fmt.Errorf("OID arc out of range")
+		}
+		if c&0x80 != 0 {
+			if i == len(content)-1 {
+				return "", errTruncated
+			}
+			continue
+		}
+		if first {
+			x := v / 40
+			if x > 2 {
+				x = 2
+			}
+			arcs = append(arcs, strconv.FormatUint(x, 10), strconv.FormatUint(v-40*x, 10))
+			first = false
+		} else {
+			arcs = append(arcs, strconv.FormatUint(v, 10))
+		}
+		v = 0
+	}
+	return strings.Join(arcs, "."), nil
+}
+
+// parseOID splits a dotted object identifier into its arcs. A leading dot,
+// as printed by net-snmp, is allowed.
+func parseOID(oid string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	arcs := make([]uint32, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		arcs[i] = uint32(v)
+	}
+	return arcs, nil
+}
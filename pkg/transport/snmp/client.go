@@ -0,0 +1,441 @@
+// Package snmp provides a minimal SNMPv2c and SNMPv3 (USM) client for
+// discovering network appliances that offer neither a shell nor WinRM, and
+// a simulated agent to test it against
+package snmp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPort           = 161
+	defaultTimeout        = 5 * time.Second
+	defaultRetries        = 2
+	defaultMaxRepetitions = 25
+
+	// maxMessageSize is the largest message this client accepts
+	maxMessageSize = 65507
+)
+
+// Config describes how to reach and authenticate to an SNMP agent
+type Config struct {
+	Host           string
+	Port           int           // Defaults to 161
+	Version        string        // "2c" (default) or "3"
+	Community      string        // v2c community
+	Username       string        // v3 security name
+	AuthProtocol   string        // v3: MD5, SHA (default) or SHA256
+	AuthPassword   string        // v3: empty for noAuthNoPriv
+	PrivProtocol   string        // v3: AES (default), DES or none
+	PrivPassword   string        // v3: empty for authNoPriv
+	Timeout        time.Duration // Per request attempt, defaults to 5 seconds
+	Retries        int           // Extra attempts after a timeout, defaults to 2
+	MaxRepetitions int           // Rows per GetBulk request, defaults to 25
+}
+
+// ErrTimeout is returned when an agent does not answer a request, which is
+// also how agents react to a wrong v2c community
+var ErrTimeout = errors.New("SNMP request timed out")
+
+// Client is a connection to a single SNMP agent. Requests on a client are
+// serialized.
+type Client struct {
+	config Config
+	conn   net.Conn
+
+	mu        sync.Mutex
+	requestID int32
+
+	// SNMPv3 state, learned from the agent by engine discovery
+	user       *usmUser
+	engineID   []byte
+	boots      int32
+	engineTime int32
+	timeSynced time.Time
+	salt       uint64
+}
+
+// Dial connects to the agent described by config. For SNMPv3 it also
+// discovers the agent's engine ID and clock, which the user's keys and
+// messages are bound to.
+func Dial(ctx context.Context, config Config) (*Client, error) {
+	if config.Port == 0 {
+		config.Port = defaultPort
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.Retries < 0 {
+		config.Retries = 0
+	} else if config.Retries == 0 {
+		config.Retries = defaultRetries
+	}
+	if config.MaxRepetitions <= 0 {
+		config.MaxRepetitions = defaultMaxRepetitions
+	}
+	switch config.Version {
+	case "", "2c", "v2c":
+		config.Version = "2c"
+	case "3", "v3":
+		config.Version = "3"
+		if config.Username == "" {
+			return nil, fmt.Errorf("a username is required for SNMPv3")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SNMP version %q", config.Version)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(config.Host, strconv.Itoa(config.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", config.Host, err)
+	}
+
+	c := &Client{config: config, conn: conn}
+	seed := make([]byte, 12)
+	if _, err := rand.Read(seed); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.requestID = int32(binary.BigEndian.Uint32(seed) & 0x3fffffff)
+	c.salt = binary.BigEndian.Uint64(seed[4:])
+
+	if config.Version == "3" {
+		if err := c.discoverEngine(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Get retrieves the given object instances
+func (c *Client) Get(ctx context.Context, oids ...string) ([]Variable, error) {
+	request := pdu{typ: pduGet}
+	for _, oid := range oids {
+		request.vars = append(request.vars, Variable{OID: oid, Type: Null})
+	}
+	response, err := c.request(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.vars, nil
+}
+
+// Walk calls fn for every object instance under root in lexicographic order,
+// fetching them with GetBulk. A subtree the agent does not implement is
+// walked without error and without calls.
+func (c *Client) Walk(ctx context.Context, root string, fn func(Variable) error) error {
+	rootArcs, err := parseOID(root)
+	if err != nil {
+		return err
+	}
+
+	next := strings.TrimPrefix(root, ".")
+	for {
+		response, err := c.request(ctx, pdu{
+			typ:        pduGetBulk,
+			errorIndex: c.config.MaxRepetitions,
+			vars:       []Variable{{OID: next, Type: Null}},
+		})
+		if err != nil {
+			return err
+		}
+		if len(response.vars) == 0 {
+			return nil
+		}
+
+		for _, v := range response.vars {
+			arcs, err := parseOID(v.OID)
+			if err != nil {
+				return err
+			}
+			if v.Type == EndOfMibView || !hasPrefix(arcs, rootArcs) {
+				return nil
+			}
+			if compareOIDs(arcs, mustParseOID(next)) <= 0 {
+				return fmt.Errorf("agent returned %s out of order after %s", v.OID, next)
+			}
+			if v.Type != NoSuchObject && v.Type != NoSuchInstance {
+				if err := fn(v); err != nil {
+					return err
+				}
+			}
+			next = v.OID
+		}
+	}
+}
+
+// request sends a PDU and waits for the response, retrying on timeouts
+func (c *Client) request(ctx context.Context, p pdu) (pdu, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		c.requestID = (c.requestID + 1) & 0x7fffffff
+		p.requestID = c.requestID
+
+		response, err := c.exchange(ctx, p, c.config.Version == "3")
+		if errors.Is(err, ErrTimeout) && attempt < c.config.Retries && ctx.Err() == nil {
+			continue
+		}
+		if err != nil {
+			return pdu{}, err
+		}
+		if response.errorStatus != 0 {
+			name := errorStatusNames[response.errorStatus]
+			if name == "" {
+				name = strconv.Itoa(response.errorStatus)
+			}
+			return pdu{}, fmt.Errorf("agent returned error %s at index %d", name, response.errorIndex)
+		}
+		return response, nil
+	}
+}
+
+// exchange sends one request message and reads its response. For SNMPv3 an
+// out-of-time-window report resynchronizes the clock and resends once.
+func (c *Client) exchange(ctx context.Context, p pdu, v3 bool) (pdu, error) {
+	encoded, err := p.encode()
+	if err != nil {
+		return pdu{}, err
+	}
+
+	for resync := 0; ; resync++ {
+		var msg []byte
+		var msgID int32
+		if v3 {
+			msgID = p.requestID
+			if msg, err = c.encodeV3Request(msgID, encoded, c.user.flags()|flagReportable); err != nil {
+				return pdu{}, err
+			}
+		} else {
+			msg = sequence(tagSequence,
+				encodeInt(tagInteger, 1),
+				appendTLV(nil, tagOctetString, []byte(c.config.Community)),
+				encoded,
+			)
+		}
+
+		response, err := c.roundTrip(ctx, msg, func(reply []byte) (pdu, bool, error) {
+			if v3 {
+				return c.decodeV3Response(reply, msgID)
+			}
+			return decodeV2cResponse(reply, p.requestID)
+		})
+		if err != nil {
+			return pdu{}, err
+		}
+		if response.typ == pduReport && len(response.vars) > 0 {
+			oid := response.vars[0].OID
+			if oid == usmStatsNotInTimeWindows && resync == 0 {
+				continue
+			}
+			if reason, ok := reportErrors[oid]; ok {
+				return pdu{}, fmt.Errorf("SNMPv3 request rejected: %s", reason)
+			}
+			return pdu{}, fmt.Errorf("SNMPv3 request rejected with report %s", oid)
+		}
+		return response, nil
+	}
+}
+
+// roundTrip writes msg and reads replies until decode accepts one or the
+// attempt times out. Replies to earlier requests are skipped.
+func (c *Client) roundTrip(ctx context.Context, msg []byte, decode func([]byte) (pdu, bool, error)) (pdu, error) {
+	deadline := time.Now().Add(c.config.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+
+	// Unblock the read when the context is cancelled
+	stop := context.AfterFunc(ctx, func() { c.conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := c.conn.Write(msg); err != nil {
+		return pdu{}, fmt.Errorf("failed to send SNMP request: %w", err)
+	}
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return pdu{}, ctxErr
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return pdu{}, ErrTimeout
+			}
+			return pdu{}, fmt.Errorf("failed to read SNMP response: %w", err)
+		}
+		response, ok, err := decode(buf[:n])
+		if err != nil {
+			return pdu{}, err
+		}
+		if ok {
+			return response, nil
+		}
+	}
+}
+
+// decodeV2cResponse decodes an SNMPv2c response, reporting whether it
+// answers requestID
+func decodeV2cResponse(msg []byte, requestID int32) (pdu, bool, error) {
+	content, _, err := readExpected(msg, tagSequence)
+	if err != nil {
+		return pdu{}, false, nil
+	}
+	if _, content, err = readInt(content); err != nil {
+		return pdu{}, false, nil
+	}
+	if _, content, err = readOctets(content); err != nil {
+		return pdu{}, false, nil
+	}
+	response, err := decodePDU(content)
+	if err != nil || response.requestID != requestID {
+		return pdu{}, false, nil
+	}
+	return response, true, nil
+}
+
+// discoverEngine learns the agent's engine ID, boots and time from the
+// report to an unauthenticated empty request, then localizes the user's keys
+func (c *Client) discoverEngine(ctx context.Context) error {
+	c.user = &usmUser{name: ""}
+	probe := pdu{typ: pduGet}
+
+	c.requestID++
+	probe.requestID = c.requestID
+	encoded, err := probe.encode()
+	if err != nil {
+		return err
+	}
+	var response pdu
+	for attempt := 0; ; attempt++ {
+		msg, err := encodeV3(v3Header{msgID: probe.requestID, flags: flagReportable}, c.user, encodeScopedPDU(nil, encoded), 0)
+		if err != nil {
+			return err
+		}
+		response, err = c.roundTrip(ctx, msg, func(reply []byte) (pdu, bool, error) {
+			h, data, _, err := decodeV3(reply)
+			if err != nil || h.msgID != probe.requestID {
+				return pdu{}, false, nil
+			}
+			scoped, err := scopedPDUContent(data)
+			if err != nil {
+				return pdu{}, false, nil
+			}
+			c.engineID, c.boots, c.engineTime, c.timeSynced = h.engineID, h.boots, h.engineTime, time.Now()
+			p, err := decodePDU(scoped)
+			return p, err == nil, nil
+		})
+		if errors.Is(err, ErrTimeout) && attempt < c.config.Retries {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("SNMPv3 engine discovery failed: %w", err)
+		}
+		break
+	}
+	if response.typ != pduReport || len(c.engineID) == 0 {
+		return fmt.Errorf("SNMPv3 engine discovery failed: agent sent no engine ID")
+	}
+
+	c.user, err = newUSMUser(c.config.Username, c.config.AuthProtocol, c.config.AuthPassword,
+		c.config.PrivProtocol, c.config.PrivPassword, c.engineID)
+	return err
+}
+
+// encodeV3Request encodes an SNMPv3 request with the agent's current clock
+func (c *Client) encodeV3Request(msgID int32, encodedPDU []byte, flags byte) ([]byte, error) {
+	c.salt++
+	return encodeV3(v3Header{
+		msgID:      msgID,
+		flags:      flags,
+		engineID:   c.engineID,
+		boots:      c.boots,
+		engineTime: c.engineTime + int32(time.Since(c.timeSynced)/time.Second),
+		userName:   c.user.name,
+	}, c.user, encodeScopedPDU(c.engineID, encodedPDU), c.salt)
+}
+
+// decodeV3Response authenticates and decrypts an SNMPv3 response, reporting
+// whether it answers msgID. Reports update the agent's clock.
+func (c *Client) decodeV3Response(msg []byte, msgID int32) (pdu, bool, error) {
+	h, data, authOffset, err := decodeV3(msg)
+	if err != nil || h.msgID != msgID {
+		return pdu{}, false, nil
+	}
+	if h.flags&flagAuth != 0 {
+		if !c.user.verify(msg, h, authOffset) {
+			return pdu{}, false, fmt.Errorf("SNMPv3 response failed authentication")
+		}
+		c.boots, c.engineTime, c.timeSynced = h.boots, h.engineTime, time.Now()
+	}
+
+	var scoped []byte
+	if h.flags&flagPriv != 0 {
+		scoped, err = c.user.openScopedPDU(h, data)
+	} else {
+		scoped, err = scopedPDUContent(data)
+	}
+	if err != nil {
+		return pdu{}, false, fmt.Errorf("failed to decode SNMPv3 response: %w", err)
+	}
+	response, err := decodePDU(scoped)
+	if err != nil {
+		return pdu{}, false, fmt.Errorf("failed to decode SNMPv3 response: %w", err)
+	}
+
+	// Only reports may come at a lower security level than requested, or an
+	// unauthenticated or unencrypted response could pass for the agent's
+	if required := c.user.flags(); response.typ != pduReport && h.flags&required != required {
+		return pdu{}, false, fmt.Errorf("SNMPv3 response is below the requested security level")
+	}
+
+	// Unauthenticated reports may only move the clock forward
+	if response.typ == pduReport && h.flags&flagAuth == 0 && (h.boots > c.boots || h.boots == c.boots && h.engineTime > c.engineTime) {
+		c.boots, c.engineTime, c.timeSynced = h.boots, h.engineTime, time.Now()
+	}
+	return response, true, nil
+}
+
+// compareOIDs compares two OIDs in lexicographic order
+func compareOIDs(a, b []uint32) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+// hasPrefix reports whether oid lies in the subtree root
+func hasPrefix(oid, root []uint32) bool {
+	return len(oid) >= len(root) && compareOIDs(oid[:len(root)], root) == 0
+}
+
+// mustParseOID parses an OID already known to be valid
+func mustParseOID(oid string) []uint32 {
+	arcs, _ := parseOID(oid)
+	return arcs
+}
@@ -0,0 +1,57 @@
+package snmp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/discovery"
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+	"github.com/vobbilis/codegen/server-discovery/pkg/transport/snmp"
+)
+
+// TestSNMPDiscoverer runs the SNMP collector against the simulator, which
+// is only built into this package's tests
+func TestSNMPDiscoverer(t *testing.T) {
+	mib := []snmp.Variable{
+		{OID: "1.3.6.1.2.1.1.1.0", Type: snmp.OctetString, Value: []byte("NAS OS 7.1\r\nBuild 2291")},
+		{OID: "1.3.6.1.2.1.1.5.0", Type: snmp.OctetString, Value: []byte("nas01")},
+		{OID: "1.3.6.1.2.1.2.2.1.2.1", Type: snmp.OctetString, Value: []byte("lo")},
+		{OID: "1.3.6.1.2.1.2.2.1.2.2", Type: snmp.OctetString, Value: []byte("eth0")},
+		{OID: "1.3.6.1.2.1.4.20.1.1.10.0.0.20", Type: snmp.IPAddress, Value: "10.0.0.20"},
+		{OID: "1.3.6.1.2.1.4.20.1.1.127.0.0.1", Type: snmp.IPAddress, Value: "127.0.0.1"},
+		{OID: "1.3.6.1.2.1.4.20.1.2.10.0.0.20", Type: snmp.Integer, Value: int64(2)},
+		{OID: "1.3.6.1.2.1.4.20.1.2.127.0.0.1", Type: snmp.Integer, Value: int64(1)},
+		{OID: "1.3.6.1.2.1.31.1.1.1.1.2", Type: snmp.OctetString, Value: []byte("outside the walked subtrees")},
+	}
+	users := []snmp.SimulatorUser{{Username: "discovery", AuthPassword: "authpass", PrivPassword: "privpass"}}
+	sim, err := snmp.NewSimulator("127.0.0.1:0", "public", users, mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	host, port := sim.Addr()
+
+	for _, config := range []snmp.Config{
+		{Community: "public"},
+		{Version: "3", Username: "discovery", AuthPassword: "authpass", PrivPassword: "privpass"},
+	} {
+		config.Host, config.Port = host, port
+		d := discovery.NewSNMPDiscoverer(config)
+		result, err := d.ExecuteDiscovery(context.Background(), models.ServerConfig{Host: host}, t.TempDir())
+		if err != nil {
+			t.Fatalf("v%s: ExecuteDiscovery returned error: %v", config.Version, err)
+		}
+		details, err := d.ParseDiscoveryOutput(result.OutputPath)
+		if err != nil {
+			t.Fatalf("v%s: ParseDiscoveryOutput returned error: %v", config.Version, err)
+		}
+
+		if details.Hostname != "nas01" || details.OSType != discovery.OSTypeNetwork || details.OSName != "NAS OS 7.1" {
+			t.Errorf("v%s: unexpected system fields: %+v", config.Version, details)
+		}
+		// The simulator listens on loopback, which is preferred as the polled address
+		if details.IP != "127.0.0.1" || len(details.IPAddresses) != 2 || details.IPAddresses[0].InterfaceName != "eth0" {
+			t.Errorf("v%s: unexpected addresses: %s %+v", config.Version, details.IP, details.IPAddresses)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package snmp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Type is the ASN.1 type of a variable's value
+type Type byte
+
+// Value types of SNMPv2-SMI
+const (
+	Integer          Type = 0x02
+	OctetString      Type = 0x04
+	Null             Type = 0x05
+	ObjectIdentifier Type = 0x06
+	IPAddress        Type = 0x40
+	Counter32        Type = 0x41
+	Gauge32          Type = 0x42
+	TimeTicks        Type = 0x43
+	Opaque           Type = 0x44
+	Counter64        Type = 0x46
+	NoSuchObject     Type = 0x80
+	NoSuchInstance   Type = 0x81
+	EndOfMibView     Type = 0x82
+)
+
+// Variable is an object identifier bound to a value. Value holds an int64
+// for Integer, a uint64 for the counters, gauges and TimeTicks, a []byte for
+// OctetString and Opaque, a dotted string for IPAddress and
+// ObjectIdentifier, and nil otherwise.
+type Variable struct {
+	OID   string
+	Type  Type
+	Value interface{}
+}
+
+// Int returns a numeric value as an int64, or 0
+func (v Variable) Int() int64 {
+	switch value := v.Value.(type) {
+	case int64:
+		return value
+	case uint64:
+		return int64(value)
+	}
+	return 0
+}
+
+// String returns the value as text: octet strings as is, and numbers in decimal
+func (v Variable) String() string {
+	switch value := v.Value.(type) {
+	case []byte:
+		return string(value)
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case uint64:
+		return strconv.FormatUint(value, 10)
+	}
+	return ""
+}
+
+// Bytes returns an octet string value, or nil
+func (v Variable) Bytes() []byte {
+	value, _ := v.Value.([]byte)
+	return value
+}
+
+// pdu is a protocol data unit. For GetBulk requests errorStatus and
+// errorIndex carry non-repeaters and max-repetitions.
+type pdu struct {
+	typ         byte
+	requestID   int32
+	errorStatus int
+	errorIndex  int
+	vars        []Variable
+}
+
+// encode encodes the PDU with its variable bindings
+func (p pdu) encode() ([]byte, error) {
+	var bindings []byte
+	for _, v := range p.vars {
+		oid, err := encodeOID(v.OID)
+		if err != nil {
+			return nil, err
+		}
+		value, err := encodeValue(v)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, sequence(tagSequence, oid, value)...)
+	}
+
+	return sequence(p.typ,
+		encodeInt(tagInteger, int64(p.requestID)),
+		encodeInt(tagInteger, int64(p.errorStatus)),
+		encodeInt(tagInteger, int64(p.errorIndex)),
+		appendTLV(nil, tagSequence, bindings),
+	), nil
+}
+
+// encodeValue encodes a variable's value; requests bind every OID to Null
+func encodeValue(v Variable) ([]byte, error) {
+	switch v.Type {
+	case Integer:
+		return encodeInt(tagInteger, v.Int()), nil
+	case Counter32, Gauge32, TimeTicks, Counter64:
+		return encodeUint(byte(v.Type), uint64(v.Int())), nil
+	case OctetString, Opaque:
+		return appendTLV(nil, byte(v.Type), v.Bytes()), nil
+	case ObjectIdentifier:
+		return encodeOID(v.String())
+	case IPAddress:
+		ip := net.ParseIP(v.String()).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IpAddress %q", v.String())
+		}
+		return appendTLV(nil, byte(IPAddress), ip), nil
+	default:
+		return appendTLV(nil, byte(v.Type), nil), nil
+	}
+}
+
+// decodePDU decodes a PDU of any type
+func decodePDU(b []byte) (pdu, error) {
+	tag, content, _, err := readTLV(b)
+	if err != nil {
+		return pdu{}, err
+	}
+	p := pdu{typ: tag}
+
+	var v int64
+	if v, content, err = readInt(content); err != nil {
+		return p, err
+	}
+	p.requestID = int32(v)
+	if v, content, err = readInt(content); err != nil {
+		return p, err
+	}
+	p.errorStatus = int(v)
+	if v, content, err = readInt(content); err != nil {
+		return p, err
+	}
+	p.errorIndex = int(v)
+
+	bindings, _, err := readExpected(content, tagSequence)
+	if err != nil {
+		return p, err
+	}
+	for len(bindings) > 0 {
+		var binding []byte
+		if binding, bindings, err = readExpected(bindings, tagSequence); err != nil {
+			return p, err
+		}
+		oidContent, rest, err := readExpected(binding, tagOID)
+		if err != nil {
+			return p, err
+		}
+		oid, err := decodeOID(oidContent)
+		if err != nil {
+			return p, err
+		}
+		valueTag, value, _, err := readTLV(rest)
+		if err != nil {
+			return p, err
+		}
+		variable, err := decodeValue(oid, Type(valueTag), value)
+		if err != nil {
+			return p, err
+		}
+		p.vars = append(p.vars, variable)
+	}
+	return p, nil
+}
+
+// decodeValue decodes the value of a variable binding
+func decodeValue(oid string, typ Type, content []byte) (Variable, error) {
+	v := Variable{OID: oid, Type: typ}
+	switch typ {
+	case Integer:
+		v.Value = decodeInt(content)
+	case Counter32, Gauge32, TimeTicks, Counter64:
+		v.Value = decodeUint(content)
+	case OctetString, Opaque:
+		v.Value = append([]byte(nil), content...)
+	case ObjectIdentifier:
+		oid, err := decodeOID(content)
+		if err != nil {
+			return v, err
+		}
+		v.Value = oid
+	case IPAddress:
+		if len(content) != 4 {
+			return v, fmt.Errorf("invalid IpAddress length %d", len(content))
+		}
+		v.Value = net.IP(content).String()
+	case Null, NoSuchObject, NoSuchInstance, EndOfMibView:
+	default:
+		return v, fmt.Errorf("unsupported value type 0x%02x for %s", byte(typ), oid)
+	}
+	return v, nil
+}
+
+// errorStatusNames names the PDU error-status values of RFC 3416
+var errorStatusNames = map[int]string{
+	1: "tooBig", 2: "noSuchName", 3: "badValue", 4: "readOnly", 5: "genErr",
+	6: "noAccess", 7: "wrongType", 8: "wrongLength", 9: "wrongEncoding",
+	10: "wrongValue", 11: "noCreation", 12: "inconsistentValue",
+	13: "resourceUnavailable", 14: "commitFailed", 15: "undoFailed",
+	16: "authorizationError", 17: "notWritable", 18: "inconsistentName",
+}
@@ -0,0 +1,237 @@
+package snmp
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"time"
+)
+
+// SimulatorUser is an SNMPv3 user accepted by a Simulator
+type SimulatorUser struct {
+	Username     string
+	AuthProtocol string
+	AuthPassword string
+	PrivProtocol string
+	PrivPassword string
+}
+
+// Simulator is an SNMP agent serving a fixed set of variables over UDP, for
+// testing discovery without a real appliance. It answers Get, GetNext and
+// GetBulk requests over SNMPv2c and SNMPv3.
+type Simulator struct {
+	conn      net.PacketConn
+	community string
+	engineID  []byte
+	started   time.Time
+	users     map[string]*usmUser
+	vars      []Variable
+	arcs      [][]uint32
+}
+
+// NewSimulator starts an agent listening on addr (such as "127.0.0.1:0")
+// that accepts community over SNMPv2c and users over SNMPv3
+func NewSimulator(addr, community string, users []SimulatorUser, vars []Variable) (*Simulator, error) {
+	s := &Simulator{
+		community: community,
+		engineID:  []byte{0x80, 0x00, 0x1f, 0x88, 0x04, 's', 'i', 'm'},
+		started:   time.Now(),
+		users:     make(map[string]*usmUser),
+		vars:      append([]Variable(nil), vars...),
+	}
+	for _, u := range users {
+		user, err := newUSMUser(u.Username, u.AuthProtocol, u.AuthPassword, u.PrivProtocol, u.PrivPassword, s.engineID)
+		if err != nil {
+			return nil, err
+		}
+		s.users[u.Username] = user
+	}
+
+	for _, v := range s.vars {
+		arcs, err := parseOID(v.OID)
+		if err != nil {
+			return nil, err
+		}
+		s.arcs = append(s.arcs, arcs)
+	}
+	sort.Sort(byOID{s})
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host and port the simulator listens on
+func (s *Simulator) Addr() (string, int) {
+	addr := s.conn.LocalAddr().(*net.UDPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// Close stops the simulator
+func (s *Simulator) Close() error {
+	return s.conn.Close()
+}
+
+// serve answers requests until the simulator is closed
+func (s *Simulator) serve() {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		reply, err := s.handle(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			log.Printf("Warning: SNMP simulator dropped a request: %v", err)
+			continue
+		}
+		if reply != nil {
+			s.conn.WriteTo(reply, from)
+		}
+	}
+}
+
+// handle decodes a request message and encodes the reply. Requests with a
+// wrong community are dropped, like real agents do.
+func (s *Simulator) handle(msg []byte) ([]byte, error) {
+	content, _, err := readExpected(msg, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	version, rest, err := readInt(content)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case 1:
+		community, data, err := readOctets(rest)
+		if err != nil {
+			return nil, err
+		}
+		if string(community) != s.community {
+			return nil, nil
+		}
+		request, err := decodePDU(data)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := s.respond(request).encode()
+		if err != nil {
+			return nil, err
+		}
+		return sequence(tagSequence, encodeInt(tagInteger, 1), appendTLV(nil, tagOctetString, community), encoded), nil
+	case 3:
+		return s.handleV3(msg)
+	}
+	return nil, fmt.Errorf("unsupported SNMP version %d", version)
+}
+
+// handleV3 answers an SNMPv3 request, reporting unknown engines, users and
+// digests the way RFC 3414 describes
+func (s *Simulator) handleV3(msg []byte) ([]byte, error) {
+	h, data, authOffset, err := decodeV3(msg)
+	if err != nil {
+		return nil, err
+	}
+	boots, engineTime := int32(1), int32(time.Since(s.started)/time.Second)
+	report := func(oid string, user *usmUser, flags byte) ([]byte, error) {
+		encoded, err := pdu{typ: pduReport, vars: []Variable{{OID: oid, Type: Counter32, Value: uint64(1)}}}.encode()
+		if err != nil {
+			return nil, err
+		}
+		return encodeV3(v3Header{msgID: h.msgID, flags: flags, engineID: s.engineID, boots: boots,
+			engineTime: engineTime, userName: user.name}, user, encodeScopedPDU(s.engineID, encoded), 0)
+	}
+
+	anonymous := &usmUser{}
+	if len(h.engineID) == 0 {
+		return report(usmStatsUnknownEngineIDs, anonymous, 0)
+	}
+	user, ok := s.users[h.userName]
+	if !ok {
+		return report(usmStatsUnknownUserNames, anonymous, 0)
+	}
+	if h.flags&(flagAuth|flagPriv) != user.flags() {
+		return report(usmStatsUnsupportedSecLevels, anonymous, 0)
+	}
+	if h.flags&flagAuth != 0 && !user.verify(msg, h, authOffset) {
+		return report(usmStatsWrongDigests, anonymous, 0)
+	}
+
+	scoped, err := user.openScopedPDU(h, data)
+	if err != nil {
+		return report(usmStatsDecryptionErrors, anonymous, 0)
+	}
+	request, err := decodePDU(scoped)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := s.respond(request).encode()
+	if err != nil {
+		return nil, err
+	}
+	return encodeV3(v3Header{msgID: h.msgID, flags: user.flags(), engineID: s.engineID, boots: boots,
+		engineTime: engineTime, userName: user.name}, user, encodeScopedPDU(s.engineID, encoded), uint64(time.Now().UnixNano()))
+}
+
+// respond builds the response PDU for a request
+func (s *Simulator) respond(request pdu) pdu {
+	response := pdu{typ: pduResponse, requestID: request.requestID}
+	for _, v := range request.vars {
+		arcs, err := parseOID(v.OID)
+		if err != nil {
+			response.errorStatus, response.errorIndex = 5, 1
+			return response
+		}
+		switch request.typ {
+		case pduGet:
+			response.vars = append(response.vars, s.get(v.OID, arcs))
+		case pduGetNext:
+			response.vars = append(response.vars, s.next(v.OID, arcs))
+		case pduGetBulk:
+			for i := 0; i < request.errorIndex; i++ {
+				next := s.next(v.OID, arcs)
+				response.vars = append(response.vars, next)
+				if next.Type == EndOfMibView {
+					break
+				}
+				v, arcs = next, mustParseOID(next.OID)
+			}
+		}
+	}
+	return response
+}
+
+// get returns the variable at oid, or NoSuchObject
+func (s *Simulator) get(oid string, arcs []uint32) Variable {
+	i := sort.Search(len(s.arcs), func(i int) bool { return compareOIDs(s.arcs[i], arcs) >= 0 })
+	if i < len(s.arcs) && compareOIDs(s.arcs[i], arcs) == 0 {
+		return s.vars[i]
+	}
+	return Variable{OID: oid, Type: NoSuchObject}
+}
+
+// next returns the first variable after oid, or EndOfMibView
+func (s *Simulator) next(oid string, arcs []uint32) Variable {
+	i := sort.Search(len(s.arcs), func(i int) bool { return compareOIDs(s.arcs[i], arcs) > 0 })
+	if i < len(s.arcs) {
+		return s.vars[i]
+	}
+	return Variable{OID: oid, Type: EndOfMibView}
+}
+
+// byOID sorts a simulator's variables in lexicographic OID order
+type byOID struct{ s *Simulator }
+
+func (b byOID) Len() int           { return len(b.s.vars) }
+func (b byOID) Less(i, j int) bool { return compareOIDs(b.s.arcs[i], b.s.arcs[j]) < 0 }
+func (b byOID) Swap(i, j int) {
+	b.s.vars[i], b.s.vars[j] = b.s.vars[j], b.s.vars[i]
+	b.s.arcs[i], b.s.arcs[j] = b.s.arcs[j], b.s.arcs[i]
+}
@@ -0,0 +1,253 @@
+package snmp
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEncoding(t *testing.T) {
+	for _, oid := range []string{"1.3.6.1.2.1.1.5.0", "1.3.6.1.4.1.2021.4294967295", "2.999.3"} {
+		encoded, err := encodeOID(oid)
+		if err != nil {
+			t.Fatalf("encodeOID(%s) returned error: %v", oid, err)
+		}
+		_, content, _, err := readTLV(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := decodeOID(content); err != nil || got != oid {
+			t.Errorf("OID %s round-tripped to %s (%v)", oid, got, err)
+		}
+	}
+
+	for _, v := range []int64{0, 127, 128, 255, 256, -1, -128, -129, 1 << 40} {
+		_, content, _, _ := readTLV(encodeInt(tagInteger, v))
+		if got := decodeInt(content); got != v {
+			t.Errorf("integer %d round-tripped to %d", v, got)
+		}
+	}
+	_, content, _, _ := readTLV(encodeUint(byte(Counter64), 1<<63))
+	if got := decodeUint(content); got != 1<<63 {
+		t.Errorf("counter round-tripped to %d", got)
+	}
+}
+
+// TestLocalizeKey checks the key localization examples of RFC 3414 A.3
+func TestLocalizeKey(t *testing.T) {
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	if got := hex.EncodeToString(localizeKey(md5.New, "maplesyrup", engineID)); got != "526f5eed9fcce26f8964c2930787d82b" {
+		t.Errorf("MD5 key = %s", got)
+	}
+	if got := hex.EncodeToString(localizeKey(sha1.New, "maplesyrup", engineID)); got != "6695febc9288e36282235fc7151f128497b38f3f" {
+		t.Errorf("SHA key = %s", got)
+	}
+}
+
+// TestPrivacyVectors encrypts known answer vectors through the USM privacy
+// protocols. The salts are picked so that the RFC 3826 AES IV (boots, time
+// and salt) and the RFC 3414 DES IV (pre-IV xor salt) equal the IVs of NIST
+// SP 800-38A F.3.13 and FIPS 81 appendix C.
+func TestPrivacyVectors(t *testing.T) {
+	for _, tt := range []struct {
+		priv                      string
+		key                       string
+		boots, engineTime         int32
+		salt                      uint64
+		plain, cipher, privParams string
+	}{
+		{
+			priv: PrivAES, key: "2b7e151628aed2a6abf7158809cf4f3c",
+			boots: 0x00010203, engineTime: 0x04050607, salt: 0x08090a0b0c0d0e0f,
+			plain: "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51" +
+				"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710",
+			cipher: "3b3fd92eb72dad20333449f8e83cfb4ac8a64537a0b3a93fcde3cdad9f1ce58b" +
+				"26751f67a3cbb140b1808cf187a4f4dfc04b05357c5d1c0eeac4c66f9ff7f2e6",
+			privParams: "08090a0b0c0d0e0f",
+		},
+		{
+			priv: PrivDES, key: "0123456789abcdef0000000000000000",
+			boots: 0x12345678, salt: 0x90abcdef,
+			plain:      hex.EncodeToString([]byte("Now is the time for all ")),
+			cipher:     "e5c7cdde872bf27c43e934008c389c0f683788499a7c05f6",
+			privParams: "1234567890abcdef",
+		},
+	} {
+		privKey, _ := hex.DecodeString(tt.key)
+		plain, _ := hex.DecodeString(tt.plain)
+		user := &usmUser{priv: tt.priv, privKey: privKey}
+
+		encrypted, privParams, err := user.encrypt(plain, tt.boots, tt.engineTime, tt.salt)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.priv, err)
+		}
+		if got := hex.EncodeToString(encrypted); got != tt.cipher {
+			t.Errorf("%s: ciphertext = %s, want %s", tt.priv, got, tt.cipher)
+		}
+		if got := hex.EncodeToString(privParams); got != tt.privParams {
+			t.Errorf("%s: privacy parameters = %s, want %s", tt.priv, got, tt.privParams)
+		}
+		decrypted, err := user.decrypt(encrypted, privParams, tt.boots, tt.engineTime)
+		if err != nil || !bytes.Equal(decrypted, plain) {
+			t.Errorf("%s: decrypted to %x (%v)", tt.priv, decrypted, err)
+		}
+	}
+}
+
+// testVariables is a small MIB served by the simulator
+var testVariables = []Variable{
+	{OID: "1.3.6.1.2.1.1.1.0", Type: OctetString, Value: []byte("Test switch")},
+	{OID: "1.3.6.1.2.1.1.3.0", Type: TimeTicks, Value: uint64(123456)},
+	{OID: "1.3.6.1.2.1.1.5.0", Type: OctetString, Value: []byte("sw01")},
+	{OID: "1.3.6.1.2.1.2.2.1.2.1", Type: OctetString, Value: []byte("Gi0/1")},
+	{OID: "1.3.6.1.2.1.2.2.1.2.2", Type: OctetString, Value: []byte("Gi0/2")},
+	{OID: "1.3.6.1.2.1.4.20.1.1.10.0.0.1", Type: IPAddress, Value: "10.0.0.1"},
+	{OID: "1.3.6.1.2.1.25.2.3.1.2.1", Type: ObjectIdentifier, Value: "1.3.6.1.2.1.25.2.1.4"},
+	{OID: "1.3.6.1.2.1.25.2.3.1.5.1", Type: Integer, Value: int64(-5)},
+}
+
+func TestWalk(t *testing.T) {
+	users := []SimulatorUser{
+		{Username: "noauth"},
+		{Username: "md5des", AuthProtocol: AuthMD5, AuthPassword: "authpass1", PrivProtocol: PrivDES, PrivPassword: "privpass1"},
+		{Username: "shaaes", AuthProtocol: AuthSHA, AuthPassword: "authpass2", PrivProtocol: PrivAES, PrivPassword: "privpass2"},
+		{Username: "sha256", AuthProtocol: AuthSHA256, AuthPassword: "authpass3", PrivProtocol: PrivNone},
+	}
+	sim, err := NewSimulator("127.0.0.1:0", "public", users, testVariables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	host, port := sim.Addr()
+
+	configs := []Config{
+		{Community: "public"},
+		{Version: "3", Username: "noauth"},
+		{Version: "3", Username: "md5des", AuthProtocol: AuthMD5, AuthPassword: "authpass1", PrivProtocol: PrivDES, PrivPassword: "privpass1"},
+		{Version: "3", Username: "shaaes", AuthPassword: "authpass2", PrivPassword: "privpass2"},
+		{Version: "3", Username: "sha256", AuthProtocol: AuthSHA256, AuthPassword: "authpass3"},
+	}
+	for _, config := range configs {
+		name := fmt.Sprintf("v%s/%s", config.Version, config.Username)
+		config.Host, config.Port, config.MaxRepetitions = host, port, 2
+
+		client, err := Dial(context.Background(), config)
+		if err != nil {
+			t.Errorf("%s: Dial returned error: %v", name, err)
+			continue
+		}
+
+		var walked []Variable
+		err = client.Walk(context.Background(), "1.3.6.1.2.1.2", func(v Variable) error {
+			walked = append(walked, v)
+			return nil
+		})
+		if err != nil || len(walked) != 2 || walked[1].String() != "Gi0/2" {
+			t.Errorf("%s: walked %+v (%v)", name, walked, err)
+		}
+
+		vars, err := client.Get(context.Background(), "1.3.6.1.2.1.1.5.0", "1.3.6.1.2.1.1.4.0")
+		if err != nil || len(vars) != 2 || vars[0].String() != "sw01" || vars[1].Type != NoSuchObject {
+			t.Errorf("%s: got %+v (%v)", name, vars, err)
+		}
+		client.Close()
+	}
+
+	// The whole MIB comes back in order and with its value types intact
+	client, err := Dial(context.Background(), Config{Host: host, Port: port, Community: "public"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var walked []Variable
+	if err := client.Walk(context.Background(), "1.3.6.1", func(v Variable) error {
+		walked = append(walked, v)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(walked) != len(testVariables) {
+		t.Fatalf("walked %d variables, want %d", len(walked), len(testVariables))
+	}
+	for i, v := range walked {
+		if v.OID != testVariables[i].OID || v.String() != testVariables[i].String() {
+			t.Errorf("variable %d = %+v, want %+v", i, v, testVariables[i])
+		}
+	}
+}
+
+func TestAuthenticationFailures(t *testing.T) {
+	users := []SimulatorUser{{Username: "shaaes", AuthPassword: "authpass", PrivPassword: "privpass"}}
+	sim, err := NewSimulator("127.0.0.1:0", "public", users, testVariables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	host, port := sim.Addr()
+
+	client, err := Dial(context.Background(), Config{Host: host, Port: port, Community: "private",
+		Timeout: 100 * time.Millisecond, Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(context.Background(), "1.3.6.1.2.1.1.5.0"); !errors.Is(err, ErrTimeout) {
+		t.Errorf("wrong community: got %v, want a timeout", err)
+	}
+	client.Close()
+
+	for _, config := range []Config{
+		{Username: "shaaes", AuthPassword: "wrong", PrivPassword: "privpass"},
+		{Username: "nobody", AuthPassword: "authpass", PrivPassword: "privpass"},
+		{Username: "shaaes", AuthPassword: "authpass", PrivProtocol: PrivNone},
+	} {
+		config.Host, config.Port, config.Version = host, port, "3"
+		client, err := Dial(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Get(context.Background(), "1.3.6.1.2.1.1.5.0"); err == nil {
+			t.Errorf("%+v: expected the request to be rejected", config)
+		}
+		client.Close()
+	}
+}
+
+func TestRejectsResponseBelowSecurityLevel(t *testing.T) {
+	engineID := []byte("test-engine")
+	user, err := newUSMUser("shaaes", AuthSHA, "authpass", PrivAES, "privpass", engineID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{user: user, engineID: engineID, timeSynced: time.Now()}
+
+	encode := func(typ, flags byte) []byte {
+		encoded, err := pdu{typ: typ, requestID: 7, vars: []Variable{{OID: "1.3.6.1.2.1.1.5.0", Type: OctetString, Value: []byte("sw01")}}}.encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := v3Header{msgID: 7, flags: flags, engineID: engineID, userName: user.name}
+		msg, err := encodeV3(h, user, encodeScopedPDU(engineID, encoded), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	if _, ok, err := c.decodeV3Response(encode(pduResponse, flagAuth|flagPriv), 7); !ok || err != nil {
+		t.Fatalf("authPriv response rejected: %v", err)
+	}
+	for _, flags := range []byte{0, flagAuth} {
+		if _, _, err := c.decodeV3Response(encode(pduResponse, flags), 7); err == nil {
+			t.Errorf("response with msgFlags %#x accepted by an authPriv client", flags)
+		}
+	}
+	if _, ok, err := c.decodeV3Response(encode(pduReport, 0), 7); !ok || err != nil {
+		t.Errorf("unauthenticated report rejected: %v", err)
+	}
+}
@@ -0,0 +1,412 @@
+package snmp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Authentication and privacy protocols of the user-based security model
+const (
+	AuthMD5    = "MD5"
+	AuthSHA    = "SHA"
+	AuthSHA256 = "SHA256"
+
+	PrivNone = "none"
+	PrivDES  = "DES"
+	PrivAES  = "AES"
+)
+
+// msgFlags bits of an SNMPv3 message
+const (
+	flagAuth       = 0x01
+	flagPriv       = 0x02
+	flagReportable = 0x04
+)
+
+// usmSecurityModel identifies the user-based security model in msgSecurityModel
+const usmSecurityModel = 3
+
+// USM statistics reported when a request fails security checks (RFC 3414)
+const (
+	usmStatsUnsupportedSecLevels = "1.3.6.1.6.3.15.1.1.1.0"
+	usmStatsNotInTimeWindows     = "1.3.6.1.6.3.15.1.1.2.0"
+	usmStatsUnknownUserNames     = "1.3.6.1.6.3.15.1.1.3.0"
+	usmStatsUnknownEngineIDs     = "1.3.6.1.6.3.15.1.1.4.0"
+	usmStatsWrongDigests         = "1.3.6.1.6.3.15.1.1.5.0"
+	usmStatsDecryptionErrors     = "1.3.6.1.6.3.15.1.1.6.0"
+)
+
+// reportErrors describes the reports that end a request
+var reportErrors = map[string]string{
+	usmStatsUnsupportedSecLevels: "unsupported security level",
+	usmStatsUnknownUserNames:     "unknown user name",
+	usmStatsWrongDigests:         "wrong authentication digest",
+	usmStatsDecryptionErrors:     "decryption error",
+}
+
+// authProtocol describes an HMAC authentication protocol
+type authProtocol struct {
+	hash    func() hash.Hash
+	macSize int
+}
+
+var authProtocols = map[string]authProtocol{
+	AuthMD5:    {md5.New, 12},
+	AuthSHA:    {sha1.New, 12},
+	AuthSHA256: {sha256.New, 24},
+}
+
+// usmUser holds a user's localized keys for one engine
+type usmUser struct {
+	name    string
+	auth    *authProtocol
+	priv    string
+	authKey []byte
+	privKey []byte
+}
+
+// newUSMUser localizes a user's passwords to engineID. An empty auth
+// password means noAuthNoPriv, and an empty privacy password or protocol
+// "none" means authNoPriv.
+func newUSMUser(name, authProto, authPassword, privProto, privPassword string, engineID []byte) (*usmUser, error) {
+	user := &usmUser{name: name}
+	if authPassword == "" {
+		return user, nil
+	}
+
+	if authProto == "" {
+		authProto = AuthSHA
+	}
+	auth, ok := authProtocols[strings.ToUpper(authProto)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported SNMP auth protocol %q", authProto)
+	}
+	user.auth = &auth
+	user.authKey = localizeKey(auth.hash, authPassword, engineID)
+
+	switch strings.ToUpper(privProto) {
+	case "", "AES", "AES128":
+		user.priv = PrivAES
+	case PrivDES:
+		user.priv = PrivDES
+	case "NONE":
+		return user, nil
+	default:
+		return nil, fmt.Errorf("unsupported SNMP privacy protocol %q", privProto)
+	}
+	if privPassword == "" {
+		user.priv = ""
+		return user, nil
+	}
+	user.privKey = localizeKey(auth.hash, privPassword, engineID)
+	return user, nil
+}
+
+// flags returns the msgFlags for the user's security level
+func (u *usmUser) flags() byte {
+	var flags byte
+	if u.auth != nil {
+		flags |= flagAuth
+	}
+	if u.privKey != nil {
+		flags |= flagPriv
+	}
+	return flags
+}
+
+// localizeKey derives the key of a password localized to an engine, as in
+// RFC 3414 section A.2
+func localizeKey(newHash func() hash.Hash, password string, engineID []byte) []byte {
+	h := newHash()
+	buf := make([]byte, 64)
+	for i, n := 0, 0; n < 1<<20; n += 64 {
+		for j := range buf {
+			buf[j] = password[i%len(password)]
+			i++
+		}
+		h.Write(buf)
+	}
+	ku := h.Sum(nil)
+
+	h.Reset()
+	h.Write(ku)
+	h.Write(engineID)
+	h.Write(ku)
+	return h.Sum(nil)
+}
+
+// mac computes the truncated HMAC of a whole message whose authentication
+// parameters are zeroed
+func (u *usmUser) mac(msg []byte) []byte {
+	h := hmac.New(u.auth.hash, u.authKey)
+	h.Write(msg)
+	return h.Sum(nil)[:u.auth.macSize]
+}
+
+// encrypt encrypts a scoped PDU and returns it with the privacy parameters
+// (the salt) the receiver needs to decrypt it
+func (u *usmUser) encrypt(plain []byte, boots, engineTime int32, salt uint64) ([]byte, []byte, error) {
+	switch u.priv {
+	case PrivAES:
+		privParams := binary.BigEndian.AppendUint64(nil, salt)
+		block, err := aes.NewCipher(u.privKey[:16])
+		if err != nil {
+			return nil, nil, err
+		}
+		out := make([]byte, len(plain))
+		cipher.NewCFBEncrypter(block, aesIV(boots, engineTime, privParams)).XORKeyStream(out, plain)
+		return out, privParams, nil
+	case PrivDES:
+		privParams := binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(boots)), uint32(salt))
+		block, err := des.NewCipher(u.privKey[:8])
+		if err != nil {
+			return nil, nil, err
+		}
+		padded := append([]byte(nil), plain...)
+		for len(padded)%des.BlockSize != 0 {
+			padded = append(padded, 0)
+		}
+		out := make([]byte, len(padded))
+		cipher.NewCBCEncrypter(block, u.desIV(privParams)).CryptBlocks(out, padded)
+		return out, privParams, nil
+	}
+	return nil, nil, fmt.Errorf("no privacy protocol configured")
+}
+
+// decrypt decrypts a scoped PDU encrypted by encrypt
+func (u *usmUser) decrypt(data, privParams []byte, boots, engineTime int32) ([]byte, error) {
+	if len(privParams) != 8 {
+		return nil, fmt.Errorf("invalid privacy parameters")
+	}
+	switch u.priv {
+	case PrivAES:
+		block, err := aes.NewCipher(u.privKey[:16])
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		cipher.NewCFBDecrypter(block, aesIV(boots, engineTime, privParams)).XORKeyStream(out, data)
+		return out, nil
+	case PrivDES:
+		if len(data)%des.BlockSize != 0 {
+			return nil, fmt.Errorf("encrypted PDU is not a multiple of the DES block size")
+		}
+		block, err := des.NewCipher(u.privKey[:8])
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, u.desIV(privParams)).CryptBlocks(out, data)
+		return out, nil
+	}
+	return nil, fmt.Errorf("no privacy protocol configured")
+}
+
+// aesIV builds the AES-CFB initialization vector of RFC 3826
+func aesIV(boots, engineTime int32, salt []byte) []byte {
+	iv := binary.BigEndian.AppendUint32(nil, uint32(boots))
+	iv = binary.BigEndian.AppendUint32(iv, uint32(engineTime))
+	return append(iv, salt...)
+}
+
+// desIV builds the DES-CBC initialization vector of RFC 3414 section 8.1.1.1
+func (u *usmUser) desIV(salt []byte) []byte {
+	iv := make([]byte, des.BlockSize)
+	for i := range iv {
+		iv[i] = u.privKey[8+i] ^ salt[i]
+	}
+	return iv
+}
+
+// v3Header is the unencrypted part of an SNMPv3 message
+type v3Header struct {
+	msgID      int32
+	flags      byte
+	engineID   []byte
+	boots      int32
+	engineTime int32
+	userName   string
+	authParams []byte
+	privParams []byte
+}
+
+// encodeV3 encodes an SNMPv3 message, encrypting and authenticating the
+// scoped PDU as the user's security level requires. salt must be unique per
+// message when privacy is used.
+func encodeV3(h v3Header, user *usmUser, scopedPDU []byte, salt uint64) ([]byte, error) {
+	data := scopedPDU
+	if h.flags&flagPriv != 0 {
+		encrypted, privParams, err := user.encrypt(scopedPDU, h.boots, h.engineTime, salt)
+		if err != nil {
+			return nil, err
+		}
+		h.privParams = privParams
+		data = appendTLV(nil, tagOctetString, encrypted)
+	}
+
+	if h.flags&flagAuth == 0 {
+		return h.encode(data), nil
+	}
+	h.authParams = make([]byte, user.auth.macSize)
+	msg := h.encode(data)
+	h.authParams = user.mac(msg)
+	return h.encode(data), nil
+}
+
+// encode encodes the message around the (possibly encrypted) scoped PDU
+func (h v3Header) encode(data []byte) []byte {
+	securityParams := sequence(tagSequence,
+		appendTLV(nil, tagOctetString, h.engineID),
+		encodeInt(tagInteger, int64(h.boots)),
+		encodeInt(tagInteger, int64(h.engineTime)),
+		appendTLV(nil, tagOctetString, []byte(h.userName)),
+		appendTLV(nil, tagOctetString, h.authParams),
+		appendTLV(nil, tagOctetString, h.privParams),
+	)
+	return sequence(tagSequence,
+		encodeInt(tagInteger, 3),
+		sequence(tagSequence,
+			encodeInt(tagInteger, int64(h.msgID)),
+			encodeInt(tagInteger, maxMessageSize),
+			appendTLV(nil, tagOctetString, []byte{h.flags}),
+			encodeInt(tagInteger, usmSecurityModel),
+		),
+		appendTLV(nil, tagOctetString, securityParams),
+		data,
+	)
+}
+
+// decodeV3 decodes the header of an SNMPv3 message. It returns the scoped
+// PDU data, still encrypted if the message is, and the offset of the
+// authentication parameters in msg.
+func decodeV3(msg []byte) (h v3Header, data []byte, authOffset int, err error) {
+	content, _, err := readExpected(msg, tagSequence)
+	if err != nil {
+		return h, nil, 0, err
+	}
+	version, content, err := readInt(content)
+	if err != nil {
+		return h, nil, 0, err
+	}
+	if version != 3 {
+		return h, nil, 0, fmt.Errorf("unexpected SNMP version %d", version)
+	}
+
+	global, content, err := readExpected(content, tagSequence)
+	if err != nil {
+		return h, nil, 0, err
+	}
+	msgID, global, err := readInt(global)
+	if err != nil {
+		return h, nil, 0, err
+	}
+	h.msgID = int32(msgID)
+	if _, global, err = readInt(global); err != nil {
+		return h, nil, 0, err
+	}
+	flags, global, err := readOctets(global)
+	if err != nil || len(flags) != 1 {
+		return h, nil, 0, fmt.Errorf("invalid msgFlags")
+	}
+	h.flags = flags[0]
+	if model, _, err := readInt(global); err != nil || model != usmSecurityModel {
+		return h, nil, 0, fmt.Errorf("unsupported security model")
+	}
+
+	securityParams, data, err := readOctets(content)
+	if err != nil {
+		return h, nil, 0, err
+	}
+	usm, _, err := readExpected(securityParams, tagSequence)
+	if err != nil {
+		return h, nil, 0, err
+	}
+	var v int64
+	var name []byte
+	if h.engineID, usm, err = readOctets(usm); err != nil {
+		return h, nil, 0, err
+	}
+	if v, usm, err = readInt(usm); err != nil {
+		return h, nil, 0, err
+	}
+	h.boots = int32(v)
+	if v, usm, err = readInt(usm); err != nil {
+		return h, nil, 0, err
+	}
+	h.engineTime = int32(v)
+	if name, usm, err = readOctets(usm); err != nil {
+		return h, nil, 0, err
+	}
+	h.userName = string(name)
+	if h.authParams, usm, err = readOctets(usm); err != nil {
+		return h, nil, 0, err
+	}
+	if h.privParams, _, err = readOctets(usm); err != nil {
+		return h, nil, 0, err
+	}
+
+	// authParams is a subslice of msg, so the capacities give its position
+	authOffset = cap(msg) - cap(h.authParams)
+	return h, data, authOffset, nil
+}
+
+// verify checks the authentication parameters of a received message
+func (u *usmUser) verify(msg []byte, h v3Header, authOffset int) bool {
+	if u.auth == nil || len(h.authParams) != u.auth.macSize {
+		return false
+	}
+	zeroed := append([]byte(nil), msg...)
+	for i := range h.authParams {
+		zeroed[authOffset+i] = 0
+	}
+	return hmac.Equal(u.mac(zeroed), h.authParams)
+}
+
+// openScopedPDU decrypts the scoped PDU data if needed and returns the PDU
+// it carries
+func (u *usmUser) openScopedPDU(h v3Header, data []byte) ([]byte, error) {
+	if h.flags&flagPriv != 0 {
+		encrypted, _, err := readOctets(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = u.decrypt(encrypted, h.privParams, h.boots, h.engineTime); err != nil {
+			return nil, err
+		}
+	}
+	return scopedPDUContent(data)
+}
+
+// scopedPDUContent returns the PDU of a scoped PDU, skipping the context
+// engine ID and name
+func scopedPDUContent(data []byte) ([]byte, error) {
+	scoped, _, err := readExpected(data, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	if _, scoped, err = readOctets(scoped); err != nil {
+		return nil, err
+	}
+	if _, scoped, err = readOctets(scoped); err != nil {
+		return nil, err
+	}
+	return scoped, nil
+}
+
+// encodeScopedPDU wraps an encoded PDU with the context engine ID and an empty context name
+func encodeScopedPDU(contextEngineID, encodedPDU []byte) []byte {
+	return sequence(tagSequence,
+		appendTLV(nil, tagOctetString, contextEngineID),
+		appendTLV(nil, tagOctetString, nil),
+		encodedPDU,
+	)
+}
@@ -0,0 +1,278 @@
+// Package ssh provides SSH connections, remote command execution and SCP
+// file transfer for discovering Linux servers
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	cryptossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+const (
+	defaultPort    = 22
+	defaultTimeout = 30 * time.Second
+)
+
+// Dial connects and authenticates to the SSH server described by config,
+// through its jump hosts if it has any. store records host keys in
+// trust-on-first-use mode and may be nil otherwise.
+func Dial(ctx context.Context, config models.SSHConfig, store HostKeyStore) (*cryptossh.Client, error) {
+	var agentClient agent.ExtendedAgent
+	if config.UseAgent {
+		conn, err := dialAgent()
+		if err != nil {
+			return nil, err
+		}
+		// Signing only happens during the handshakes below
+		defer conn.Close()
+		agentClient = agent.NewClient(conn)
+	}
+
+	var hops []*cryptossh.Client
+	for _, hop := range append(jumpHosts(config), config) {
+		clientConfig, err := ClientConfig(hop, store, agentClient)
+		if err != nil {
+			closeAll(hops)
+			return nil, err
+		}
+
+		var client *cryptossh.Client
+		if len(hops) == 0 {
+			client, err = dialContext(ctx, Address(hop), clientConfig)
+		} else {
+			client, err = dialThrough(ctx, hops[len(hops)-1], Address(hop), clientConfig)
+		}
+		if err != nil {
+			closeAll(hops)
+			if len(hops) < len(config.ProxyJump) {
+				return nil, fmt.Errorf("failed to connect to jump host %s: %w", hop.Host, err)
+			}
+			return nil, fmt.Errorf("failed to connect to SSH server: %w", err)
+		}
+		hops = append(hops, client)
+	}
+
+	// The jump host connections live as long as the connection they carry
+	client, jumps := hops[len(hops)-1], hops[:len(hops)-1]
+	if len(jumps) > 0 {
+		go func() {
+			client.Wait()
+			closeAll(jumps)
+		}()
+	}
+	return client, nil
+}
+
+// Address returns the host:port the config connects to
+func Address(config models.SSHConfig) string {
+	port := config.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	return net.JoinHostPort(config.Host, strconv.Itoa(port))
+}
+
+// ClientConfig builds the client configuration for certificate, private key,
+// ssh-agent and password authentication, verifying host keys according to
+// config.HostKeyMode. agentClient may be nil if config.UseAgent is not set.
+func ClientConfig(config models.SSHConfig, store HostKeyStore, agentClient agent.ExtendedAgent) (*cryptossh.ClientConfig, error) {
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	hostKeyCallback, hostKeyAlgorithms, err := hostKeyCallback(config, store)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConfig := &cryptossh.ClientConfig{
+		User:              config.Username,
+		Auth:              []cryptossh.AuthMethod{},
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		Timeout:           timeout,
+	}
+
+	// Offer keys first so that servers limiting auth attempts accept them
+	if config.PrivateKeyPath != "" {
+		signers, err := keySigners(config)
+		if err != nil {
+			return nil, err
+		}
+		clientConfig.Auth = append(clientConfig.Auth, cryptossh.PublicKeys(signers...))
+	}
+
+	if agentClient != nil {
+		clientConfig.Auth = append(clientConfig.Auth, cryptossh.PublicKeysCallback(agentClient.Signers))
+	}
+
+	if config.Password != "" {
+		clientConfig.Auth = append(clientConfig.Auth, cryptossh.Password(config.Password))
+	}
+
+	if len(clientConfig.Auth) == 0 {
+		return nil, fmt.Errorf("no SSH credentials configured for %s", config.Host)
+	}
+
+	return clientConfig, nil
+}
+
+// keySigners loads the private key, decrypting it with the configured
+// passphrase, and pairs it with its user certificate if there is one. The
+// certificate is offered before the bare key.
+func keySigners(config models.SSHConfig) ([]cryptossh.Signer, error) {
+	key, err := os.ReadFile(config.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read private key: %w", err)
+	}
+
+	signer, err := cryptossh.ParsePrivateKey(key)
+	var missing *cryptossh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if config.Passphrase == "" {
+			return nil, fmt.Errorf("private key %s is encrypted and no passphrase is configured", config.PrivateKeyPath)
+		}
+		signer, err = cryptossh.ParsePrivateKeyWithPassphrase(key, []byte(config.Passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key: %w", err)
+	}
+
+	certPath := config.CertificatePath
+	if certPath == "" {
+		certPath = config.PrivateKeyPath + "-cert.pub"
+		if _, err := os.Stat(certPath); err != nil {
+			return []cryptossh.Signer{signer}, nil
+		}
+	}
+
+	certSigner, err := certificateSigner(certPath, signer)
+	if err != nil {
+		return nil, err
+	}
+	return []cryptossh.Signer{certSigner, signer}, nil
+}
+
+// certificateSigner pairs signer with the OpenSSH user certificate at path
+func certificateSigner(path string, signer cryptossh.Signer) (cryptossh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read SSH certificate: %w", err)
+	}
+
+	pub, _, _, _, err := cryptossh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse SSH certificate: %w", err)
+	}
+	cert, ok := pub.(*cryptossh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an SSH certificate", path)
+	}
+	if cert.CertType != cryptossh.UserCert {
+		return nil, fmt.Errorf("%s is not an SSH user certificate", path)
+	}
+	if before := cert.ValidBefore; before != cryptossh.CertTimeInfinity && time.Now().After(time.Unix(int64(before), 0)) {
+		return nil, fmt.Errorf("SSH certificate %s expired at %s", path, time.Unix(int64(before), 0).Format(time.RFC3339))
+	}
+
+	certSigner, err := cryptossh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("SSH certificate does not match private key: %w", err)
+	}
+	return certSigner, nil
+}
+
+// dialAgent connects to the ssh-agent listening on SSH_AUTH_SOCK
+func dialAgent() (net.Conn, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("SSH agent authentication requested but SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+	}
+	return conn, nil
+}
+
+// jumpHosts returns the configs for config's jump hosts in connection order.
+// Jump hosts use the target's credentials unless their spec names a user.
+// They are not in the server inventory, so in trust-on-first-use mode their
+// host keys are checked against known_hosts instead.
+func jumpHosts(config models.SSHConfig) []models.SSHConfig {
+	hops := make([]models.SSHConfig, 0, len(config.ProxyJump))
+	for _, spec := range config.ProxyJump {
+		hop := config
+		hop.ProxyJump = nil
+		hop.ServerID = 0
+		hop.Port = 0
+		if hop.HostKeyMode == "" || hop.HostKeyMode == HostKeyTOFU {
+			hop.HostKeyMode = HostKeyStrict
+		}
+
+		if i := strings.LastIndex(spec, "@"); i >= 0 {
+			hop.Username = spec[:i]
+			spec = spec[i+1:]
+		}
+		hop.Host = strings.Trim(spec, "[]")
+		if host, port, err := net.SplitHostPort(spec); err == nil {
+			hop.Host = host
+			hop.Port, _ = strconv.Atoi(port)
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// closeAll closes a chain of clients, innermost first
+func closeAll(clients []*cryptossh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
+
+// dialContext connects to an SSH server, honouring ctx for the TCP dial and handshake
+func dialContext(ctx context.Context, addr string, config *cryptossh.ClientConfig) (*cryptossh.Client, error) {
+	dialer := net.Dialer{Timeout: config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return handshake(ctx, conn, addr, config)
+}
+
+// dialThrough connects to an SSH server through a TCP tunnel opened on jump
+func dialThrough(ctx context.Context, jump *cryptossh.Client, addr string, config *cryptossh.ClientConfig) (*cryptossh.Client, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+	conn, err := jump.DialContext(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return handshake(ctx, conn, addr, config)
+}
+
+// handshake establishes an SSH connection over conn
+func handshake(ctx context.Context, conn net.Conn, addr string, config *cryptossh.ClientConfig) (*cryptossh.Client, error) {
+	// Abort the handshake if ctx is cancelled while it is in progress
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, chans, reqs, err := cryptossh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return cryptossh.NewClient(c, chans, reqs), nil
+}
@@ -0,0 +1,130 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cryptossh "golang.org/x/crypto/ssh"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestJumpHosts(t *testing.T) {
+	config := models.SSHConfig{
+		Host:      "db01",
+		Port:      2200,
+		Username:  "discovery",
+		ServerID:  7,
+		ProxyJump: []string{"bastion.example.com", "ops@10.1.0.5:2222", "[fd00::1]"},
+	}
+
+	hops := jumpHosts(config)
+	if len(hops) != 3 {
+		t.Fatalf("got %d jump hosts, want 3", len(hops))
+	}
+	want := []struct {
+		addr, user string
+	}{
+		{"bastion.example.com:22", "discovery"},
+		{"10.1.0.5:2222", "ops"},
+		{"[fd00::1]:22", "discovery"},
+	}
+	for i, hop := range hops {
+		if Address(hop) != want[i].addr || hop.Username != want[i].user {
+			t.Errorf("hop %d = %s@%s, want %s@%s", i, hop.Username, Address(hop), want[i].user, want[i].addr)
+		}
+		if hop.ServerID != 0 || hop.HostKeyMode != HostKeyStrict || hop.ProxyJump != nil {
+			t.Errorf("hop %d inherited target-only settings: %+v", i, hop)
+		}
+	}
+}
+
+func TestKeySigners(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := cryptossh.MarshalPrivateKeyWithPassphrase(priv, "discovery", []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := keySigners(models.SSHConfig{PrivateKeyPath: keyPath}); err == nil {
+		t.Error("expected an error for an encrypted key without a passphrase")
+	}
+	signers, err := keySigners(models.SSHConfig{PrivateKeyPath: keyPath, Passphrase: "s3cret"})
+	if err != nil {
+		t.Fatalf("keySigners returned error: %v", err)
+	}
+	if len(signers) != 1 {
+		t.Fatalf("got %d signers without a certificate, want 1", len(signers))
+	}
+
+	// Sign a user certificate with a throwaway CA and place it next to the key
+	userKey, err := cryptossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, caPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := cryptossh.NewSignerFromKey(caPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &cryptossh.Certificate{
+		Key:             userKey,
+		CertType:        cryptossh.UserCert,
+		KeyId:           "discovery",
+		ValidPrincipals: []string{"discovery"},
+		ValidBefore:     uint64(time.Now().Add(time.Hour).Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath+"-cert.pub", cryptossh.MarshalAuthorizedKey(cert), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	signers, err = keySigners(models.SSHConfig{PrivateKeyPath: keyPath, Passphrase: "s3cret"})
+	if err != nil {
+		t.Fatalf("keySigners returned error: %v", err)
+	}
+	if len(signers) != 2 {
+		t.Fatalf("got %d signers with a certificate, want 2", len(signers))
+	}
+	if _, ok := signers[0].PublicKey().(*cryptossh.Certificate); !ok {
+		t.Error("expected the certificate to be offered first")
+	}
+
+	// An expired certificate is reported rather than silently rejected by the server
+	cert.ValidBefore = uint64(time.Now().Add(-time.Hour).Unix())
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, "expired-cert.pub")
+	if err := os.WriteFile(certPath, cryptossh.MarshalAuthorizedKey(cert), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keySigners(models.SSHConfig{PrivateKeyPath: keyPath, Passphrase: "s3cret", CertificatePath: certPath}); err == nil {
+		t.Error("expected an error for an expired certificate")
+	}
+}
+
+func TestDialAgentWithoutSocket(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if _, err := dialAgent(); err == nil {
+		t.Error("expected an error when SSH_AUTH_SOCK is unset")
+	}
+}
@@ -0,0 +1,146 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+// Run runs a command on the server and returns its standard output. When the
+// command fails, the error includes its standard error.
+func Run(ctx context.Context, client *cryptossh.Client, cmd string) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	err = wait(ctx, session, func() error { return session.Run(cmd) })
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" && ctx.Err() == nil {
+			return stdout.Bytes(), fmt.Errorf("%w: %s", err, msg)
+		}
+		return stdout.Bytes(), err
+	}
+	return stdout.Bytes(), nil
+}
+
+// Upload copies content to remotePath on the server using the SCP protocol
+func Upload(ctx context.Context, client *cryptossh.Client, remotePath string, content []byte, mode os.FileMode) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	err = wait(ctx, session, func() error {
+		if err := session.Start("scp -t " + Quote(path.Dir(remotePath))); err != nil {
+			return err
+		}
+
+		acks := bufio.NewReader(stdout)
+		if err := sendSCP(stdin, acks, remotePath, content, mode); err != nil {
+			stdin.Close()
+			session.Wait()
+			return err
+		}
+		stdin.Close()
+		return session.Wait()
+	})
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" && ctx.Err() == nil {
+			return fmt.Errorf("scp upload of %s failed: %w: %s", remotePath, err, msg)
+		}
+		return fmt.Errorf("scp upload of %s failed: %w", remotePath, err)
+	}
+	return nil
+}
+
+// Download reads the contents of remotePath from the server
+func Download(ctx context.Context, client *cryptossh.Client, remotePath string) ([]byte, error) {
+	content, err := Run(ctx, client, "cat "+Quote(remotePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", remotePath, err)
+	}
+	return content, nil
+}
+
+// Quote quotes s for use as a single word in a POSIX shell command
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// sendSCP writes a single file to an "scp -t" sink, checking the
+// acknowledgement that follows each step
+func sendSCP(w io.Writer, acks *bufio.Reader, remotePath string, content []byte, mode os.FileMode) error {
+	if err := readAck(acks); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "C%04o %d %s\n", mode.Perm(), len(content), path.Base(remotePath)); err != nil {
+		return err
+	}
+	if err := readAck(acks); err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+	return readAck(acks)
+}
+
+// readAck reads an SCP acknowledgement: a zero byte on success, otherwise
+// a warning or error code followed by a message line
+func readAck(r *bufio.Reader) error {
+	code, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read scp acknowledgement: %w", err)
+	}
+	if code == 0 {
+		return nil
+	}
+	msg, _ := r.ReadString('\n')
+	return fmt.Errorf("scp: %s", strings.TrimSpace(msg))
+}
+
+// wait runs fn, killing the remote process and closing the session if ctx is
+// done before fn returns
+func wait(ctx context.Context, session *cryptossh.Session, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		session.Signal(cryptossh.SIGKILL)
+		session.Close()
+		return ctx.Err()
+	}
+}
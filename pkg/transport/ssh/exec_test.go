@@ -0,0 +1,65 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+func TestSendSCP(t *testing.T) {
+	var sent bytes.Buffer
+	acks := bufio.NewReader(bytes.NewReader([]byte{0, 0, 0}))
+
+	if err := sendSCP(&sent, acks, "/tmp/run/discover.sh", []byte("echo hi\n"), 0755); err != nil {
+		t.Fatalf("sendSCP returned error: %v", err)
+	}
+
+	want := "C0755 8 discover.sh\necho hi\n\x00"
+	if sent.String() != want {
+		t.Errorf("sent %q, want %q", sent.String(), want)
+	}
+}
+
+func TestSendSCPRejected(t *testing.T) {
+	var sent bytes.Buffer
+	acks := bufio.NewReader(strings.NewReader("\x00\x01scp: /tmp/run/discover.sh: Permission denied\n"))
+
+	err := sendSCP(&sent, acks, "/tmp/run/discover.sh", []byte("echo hi\n"), 0755)
+	if err == nil || !strings.Contains(err.Error(), "Permission denied") {
+		t.Fatalf("sendSCP error = %v, want permission denied", err)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"/tmp/dir":       `'/tmp/dir'`,
+		"it's here":      `'it'\''s here'`,
+		"$(rm -rf /); x": `'$(rm -rf /); x'`,
+	}
+	for in, want := range tests {
+		if got := Quote(in); got != want {
+			t.Errorf("Quote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	if _, err := ClientConfig(models.SSHConfig{Host: "db01", Username: "root", HostKeyMode: HostKeyInsecure}, nil, nil); err == nil {
+		t.Error("expected an error when no credentials are configured")
+	}
+
+	config, err := ClientConfig(models.SSHConfig{Host: "db01", Username: "root", Password: "secret", HostKeyMode: HostKeyInsecure}, nil, nil)
+	if err != nil {
+		t.Fatalf("ClientConfig returned error: %v", err)
+	}
+	if config.User != "root" || len(config.Auth) != 1 || config.Timeout != defaultTimeout {
+		t.Errorf("unexpected client config: user=%s auth=%d timeout=%s", config.User, len(config.Auth), config.Timeout)
+	}
+
+	if got := Address(models.SSHConfig{Host: "db01"}); got != "db01:22" {
+		t.Errorf("Address = %s, want db01:22", got)
+	}
+}
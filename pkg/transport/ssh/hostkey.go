@@ -0,0 +1,153 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cryptossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// Host key verification modes, see models.SSHConfig.HostKeyMode
+const (
+	HostKeyTOFU     = "tofu"
+	HostKeyStrict   = "strict"
+	HostKeyInsecure = "insecure"
+)
+
+// HostKeyStore persists the host keys trusted on first use for each server
+type HostKeyStore interface {
+	GetSSHHostKeys(serverID int) ([]models.SSHHostKey, error)
+	AddSSHHostKey(key models.SSHHostKey) error
+}
+
+// HostKeyMismatchError is returned when a server presents a host key that
+// does not match the one on record, which may mean the connection is being
+// intercepted
+type HostKeyMismatchError struct {
+	Host        string
+	Fingerprint string
+	Known       []string
+}
+
+// Error implements error
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key mismatch for %s: got %s, expected %s",
+		e.Host, e.Fingerprint, strings.Join(e.Known, " or "))
+}
+
+// IsHostKeyMismatch reports whether err was caused by a host key mismatch
+func IsHostKeyMismatch(err error) bool {
+	var mismatch *HostKeyMismatchError
+	return errors.As(err, &mismatch)
+}
+
+// hostKeyCallback builds the host key check for config's HostKeyMode. It
+// also returns the host key algorithms to negotiate, if they are restricted.
+func hostKeyCallback(config models.SSHConfig, store HostKeyStore) (cryptossh.HostKeyCallback, []string, error) {
+	switch config.HostKeyMode {
+	case HostKeyInsecure:
+		return cryptossh.InsecureIgnoreHostKey(), nil, nil
+	case HostKeyStrict:
+		callback, err := knownHostsCallback(config.KnownHostsPath)
+		return callback, nil, err
+	case "", HostKeyTOFU:
+		return tofuCallback(config, store)
+	default:
+		return nil, nil, fmt.Errorf("unknown SSH host key mode %q", config.HostKeyMode)
+	}
+}
+
+// knownHostsCallback checks host keys against an OpenSSH known_hosts file
+func knownHostsCallback(path string) (cryptossh.HostKeyCallback, error) {
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("unable to locate known_hosts: %w", err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load known_hosts: %w", err)
+	}
+
+	return func(hostname string, remote net.Addr, key cryptossh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return fmt.Errorf("host %s is not in %s", hostname, path)
+			}
+			known := make([]string, len(keyErr.Want))
+			for i, want := range keyErr.Want {
+				known[i] = cryptossh.FingerprintSHA256(want.Key)
+			}
+			return &HostKeyMismatchError{Host: hostname, Fingerprint: cryptossh.FingerprintSHA256(key), Known: known}
+		}
+		return err
+	}, nil
+}
+
+// tofuCallback trusts the first host key a server presents and records it in
+// the store; later connections must present a recorded key. Negotiation is
+// restricted to the recorded key types so that a server offering several
+// keys presents one we know.
+func tofuCallback(config models.SSHConfig, store HostKeyStore) (cryptossh.HostKeyCallback, []string, error) {
+	if store == nil {
+		return nil, nil, fmt.Errorf("trust on first use requires a host key store")
+	}
+	if config.ServerID == 0 {
+		return nil, nil, fmt.Errorf("trust on first use requires %s to be in the server inventory", config.Host)
+	}
+
+	known, err := store.GetSSHHostKeys(config.ServerID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	callback := func(hostname string, remote net.Addr, key cryptossh.PublicKey) error {
+		fingerprint := cryptossh.FingerprintSHA256(key)
+		if len(known) == 0 {
+			log.Printf("Trusting %s host key %s for %s on first use", key.Type(), fingerprint, config.Host)
+			return store.AddSSHHostKey(models.SSHHostKey{
+				ServerID:    config.ServerID,
+				KeyType:     key.Type(),
+				PublicKey:   strings.TrimSpace(string(cryptossh.MarshalAuthorizedKey(key))),
+				Fingerprint: fingerprint,
+				Comment:     hostname,
+			})
+		}
+
+		fingerprints := make([]string, len(known))
+		for i, k := range known {
+			if k.Fingerprint == fingerprint {
+				return nil
+			}
+			fingerprints[i] = k.Fingerprint
+		}
+		return &HostKeyMismatchError{Host: config.Host, Fingerprint: fingerprint, Known: fingerprints}
+	}
+
+	var algorithms []string
+	for _, k := range known {
+		algorithms = append(algorithms, hostKeyAlgorithms(k.KeyType)...)
+	}
+	return callback, algorithms, nil
+}
+
+// hostKeyAlgorithms returns the signature algorithms that can verify a key type
+func hostKeyAlgorithms(keyType string) []string {
+	if keyType == cryptossh.KeyAlgoRSA {
+		return []string{cryptossh.KeyAlgoRSASHA512, cryptossh.KeyAlgoRSASHA256, cryptossh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
@@ -0,0 +1,117 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cryptossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// memoryHostKeyStore is a HostKeyStore kept in memory
+type memoryHostKeyStore struct {
+	keys []models.SSHHostKey
+}
+
+func (s *memoryHostKeyStore) GetSSHHostKeys(serverID int) ([]models.SSHHostKey, error) {
+	var keys []models.SSHHostKey
+	for _, k := range s.keys {
+		if k.ServerID == serverID {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memoryHostKeyStore) AddSSHHostKey(key models.SSHHostKey) error {
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+func newHostKey(t *testing.T) cryptossh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := cryptossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestTOFUHostKeyCallback(t *testing.T) {
+	store := &memoryHostKeyStore{}
+	config := models.SSHConfig{Host: "db01", ServerID: 7}
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 22}
+	trusted, other := newHostKey(t), newHostKey(t)
+
+	callback, algorithms, err := hostKeyCallback(config, store)
+	if err != nil {
+		t.Fatalf("hostKeyCallback returned error: %v", err)
+	}
+	if algorithms != nil {
+		t.Errorf("expected unrestricted algorithms before first use, got %v", algorithms)
+	}
+	if err := callback("db01:22", remote, trusted); err != nil {
+		t.Fatalf("first use was rejected: %v", err)
+	}
+	if len(store.keys) != 1 || store.keys[0].Fingerprint != cryptossh.FingerprintSHA256(trusted) || store.keys[0].KeyType != cryptossh.KeyAlgoED25519 {
+		t.Fatalf("unexpected stored keys: %+v", store.keys)
+	}
+
+	callback, algorithms, err = hostKeyCallback(config, store)
+	if err != nil {
+		t.Fatalf("hostKeyCallback returned error: %v", err)
+	}
+	if len(algorithms) != 1 || algorithms[0] != cryptossh.KeyAlgoED25519 {
+		t.Errorf("algorithms = %v, want [%s]", algorithms, cryptossh.KeyAlgoED25519)
+	}
+	if err := callback("db01:22", remote, trusted); err != nil {
+		t.Errorf("trusted key was rejected: %v", err)
+	}
+	if err := callback("db01:22", remote, other); !IsHostKeyMismatch(err) {
+		t.Errorf("expected a host key mismatch, got %v", err)
+	}
+	if len(store.keys) != 1 {
+		t.Errorf("mismatched key was stored: %+v", store.keys)
+	}
+
+	if _, _, err := hostKeyCallback(models.SSHConfig{Host: "adhoc"}, store); err == nil {
+		t.Error("expected an error for a server without an inventory ID")
+	}
+	if _, _, err := hostKeyCallback(models.SSHConfig{Host: "db01", HostKeyMode: "yolo"}, store); err == nil {
+		t.Error("expected an error for an unknown host key mode")
+	}
+}
+
+func TestStrictHostKeyCallback(t *testing.T) {
+	trusted, other := newHostKey(t), newHostKey(t)
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize("db01:22")}, trusted) + "\n"
+	if err := os.WriteFile(path, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	callback, _, err := hostKeyCallback(models.SSHConfig{Host: "db01", HostKeyMode: HostKeyStrict, KnownHostsPath: path}, nil)
+	if err != nil {
+		t.Fatalf("hostKeyCallback returned error: %v", err)
+	}
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 22}
+	if err := callback("db01:22", remote, trusted); err != nil {
+		t.Errorf("known key was rejected: %v", err)
+	}
+	if err := callback("db01:22", remote, other); !IsHostKeyMismatch(err) {
+		t.Errorf("expected a host key mismatch, got %v", err)
+	}
+	if err := callback("db02:22", &net.TCPAddr{IP: net.IPv4(10, 0, 0, 8), Port: 22}, trusted); err == nil || IsHostKeyMismatch(err) {
+		t.Errorf("expected an unknown host error, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package ssh
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cryptossh "golang.org/x/crypto/ssh"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// pooledClient is a client in the pool along with its usage
+type pooledClient struct {
+	key      string
+	client   *cryptossh.Client
+	lastUsed time.Time
+	inUse    int
+	removed  bool // Dropped from the pool, closed once no discovery uses it
+}
+
+// Pool keeps SSH client connections open for reuse between discoveries.
+// Clients in use are never closed by the pool; every successful Get must be
+// paired with a Release.
+type Pool struct {
+	clients     map[string]*pooledClient
+	byClient    map[*cryptossh.Client]*pooledClient
+	mutex       sync.Mutex
+	maxSize     int
+	idleTimeout time.Duration
+	hostKeys    HostKeyStore
+	dial        func(ctx context.Context, config models.SSHConfig, store HostKeyStore) (*cryptossh.Client, error)
+}
+
+// NewPool creates a new SSH connection pool. hostKeys records the host keys
+// of servers connected to in trust-on-first-use mode.
+func NewPool(maxSize int, idleTimeout time.Duration, hostKeys HostKeyStore) *Pool {
+	return &Pool{
+		clients:     make(map[string]*pooledClient),
+		byClient:    make(map[*cryptossh.Client]*pooledClient),
+		maxSize:     maxSize,
+		idleTimeout: idleTimeout,
+		hostKeys:    hostKeys,
+		dial:        Dial,
+	}
+}
+
+// poolKey identifies the pooled client for a config. Servers with the same
+// address behind different jump hosts are different machines, so the key
+// covers the whole jump chain, and the host key mode, inventory ID and a hash
+// of the credentials so that a changed setting gets a new client.
+func poolKey(config models.SSHConfig) string {
+	hops := jumpHosts(config)
+	chain := make([]string, 0, len(hops)+1)
+	for _, hop := range hops {
+		chain = append(chain, hop.Username+"@"+Address(hop))
+	}
+	chain = append(chain, config.Username+"@"+Address(config))
+
+	credentials := sha256.Sum256([]byte(strings.Join([]string{
+		config.Password, config.PrivateKeyPath, config.Passphrase, config.CertificatePath,
+		strconv.FormatBool(config.UseAgent), config.KnownHostsPath,
+	}, "\x00")))
+	return fmt.Sprintf("%s|%s|%d|%x", strings.Join(chain, ","), config.HostKeyMode, config.ServerID, credentials[:8])
+}
+
+// Get returns a pooled client for the given config, dialing a new one if
+// there is none, it has been idle too long or the connection has dropped.
+// Dialing happens without holding the pool lock, so a slow handshake does
+// not hold up discoveries of other servers.
+func (p *Pool) Get(ctx context.Context, config models.SSHConfig) (*cryptossh.Client, error) {
+	key := poolKey(config)
+
+	p.mutex.Lock()
+	pc := p.clients[key]
+	if pc != nil && pc.inUse == 0 && time.Since(pc.lastUsed) > p.idleTimeout {
+		p.drop(pc)
+		pc = nil
+	}
+	if pc != nil {
+		p.acquire(pc)
+	}
+	p.mutex.Unlock()
+
+	if pc != nil {
+		if alive(pc.client) {
+			return pc.client, nil
+		}
+		p.mutex.Lock()
+		pc.inUse--
+		p.drop(pc)
+		p.mutex.Unlock()
+	}
+
+	client, err := p.dial(ctx, config, p.hostKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Another discovery may have connected to the server meanwhile
+	if existing := p.clients[key]; existing != nil {
+		client.Close()
+		p.acquire(existing)
+		return existing.client, nil
+	}
+
+	// Make room by closing the least recently used idle client. When every
+	// client is in use the pool grows past maxSize until they are released.
+	if p.maxSize > 0 && len(p.clients) >= p.maxSize {
+		if idle := p.leastRecentlyUsedIdle(); idle != nil {
+			p.drop(idle)
+		}
+	}
+
+	pc = &pooledClient{key: key, client: client}
+	p.clients[key] = pc
+	p.byClient[client] = pc
+	p.acquire(pc)
+	return client, nil
+}
+
+// Release returns a client obtained from Get to the pool
+func (p *Pool) Release(client *cryptossh.Client) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pc, exists := p.byClient[client]
+	if !exists {
+		return
+	}
+	if pc.inUse > 0 {
+		pc.inUse--
+	}
+	pc.lastUsed = time.Now()
+	if pc.removed && pc.inUse == 0 {
+		p.close(pc)
+	}
+}
+
+// CloseAll closes all connections in the pool. Clients still in use are
+// closed when they are released.
+func (p *Pool) CloseAll() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, pc := range p.clients {
+		p.drop(pc)
+	}
+}
+
+// acquire marks a client as in use; callers hold the mutex
+func (p *Pool) acquire(pc *pooledClient) {
+	pc.inUse++
+	pc.lastUsed = time.Now()
+}
+
+// leastRecentlyUsedIdle returns the least recently used client that no
+// discovery is using, or nil; callers hold the mutex
+func (p *Pool) leastRecentlyUsedIdle() *pooledClient {
+	var oldest *pooledClient
+	for _, pc := range p.clients {
+		if pc.inUse == 0 && (oldest == nil || pc.lastUsed.Before(oldest.lastUsed)) {
+			oldest = pc
+		}
+	}
+	return oldest
+}
+
+// drop removes a client from the pool and closes it unless it is in use;
+// callers hold the mutex
+func (p *Pool) drop(pc *pooledClient) {
+	if p.clients[pc.key] == pc {
+		delete(p.clients, pc.key)
+	}
+	pc.removed = true
+	if pc.inUse == 0 {
+		p.close(pc)
+	}
+}
+
+// close closes a dropped client; callers hold the mutex
+func (p *Pool) close(pc *pooledClient) {
+	pc.client.Close()
+	delete(p.byClient, pc.client)
+}
+
+// alive sends a keepalive request to check that the connection still works
+func alive(client *cryptossh.Client) bool {
+	_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+	return err == nil
+}
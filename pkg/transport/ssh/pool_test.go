@@ -0,0 +1,166 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cryptossh "golang.org/x/crypto/ssh"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/models"
+)
+
+// startTestServer runs an SSH server on loopback that accepts any password
+// and answers keepalives. It returns the port it listens on.
+func startTestServer(t *testing.T) int {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := cryptossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &cryptossh.ServerConfig{
+		PasswordCallback: func(cryptossh.ConnMetadata, []byte) (*cryptossh.Permissions, error) { return nil, nil },
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := cryptossh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go func() {
+					for req := range reqs {
+						req.Reply(true, nil)
+					}
+				}()
+				for ch := range chans {
+					ch.Reject(cryptossh.Prohibited, "no channels")
+				}
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestPoolKey(t *testing.T) {
+	base := models.SSHConfig{Host: "10.0.0.5", Username: "discovery", Password: "x", ServerID: 1, ProxyJump: []string{"us-bastion"}}
+
+	otherBastion := base
+	otherBastion.ProxyJump = []string{"eu-bastion"}
+	otherServer := base
+	otherServer.ServerID = 2
+	rotated := base
+	rotated.Password = "y"
+	strict := base
+	strict.HostKeyMode = HostKeyStrict
+	otherPort := base
+	otherPort.Port = 2222
+
+	for name, config := range map[string]models.SSHConfig{
+		"jump host": otherBastion, "server": otherServer, "password": rotated, "host key mode": strict, "port": otherPort,
+	} {
+		if poolKey(config) == poolKey(base) {
+			t.Errorf("configs differing in %s share a pooled client", name)
+		}
+	}
+	if poolKey(base) != poolKey(base) {
+		t.Error("pool key is not stable")
+	}
+}
+
+func TestPoolKeepsClientsInUse(t *testing.T) {
+	port := startTestServer(t)
+	pool := NewPool(1, time.Minute, nil)
+	var dials int32
+	pool.dial = func(ctx context.Context, config models.SSHConfig, store HostKeyStore) (*cryptossh.Client, error) {
+		atomic.AddInt32(&dials, 1)
+		return Dial(ctx, config, store)
+	}
+	defer pool.CloseAll()
+
+	config := func(user string) models.SSHConfig {
+		return models.SSHConfig{Host: "127.0.0.1", Port: port, Username: user, Password: "x", HostKeyMode: HostKeyInsecure}
+	}
+	ctx := context.Background()
+
+	first, err := pool.Get(ctx, config("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The pool is full, but its only client is in use and must stay open
+	second, err := pool.Get(ctx, config("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alive(first) {
+		t.Fatal("client in use was closed to make room")
+	}
+
+	again, err := pool.Get(ctx, config("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first || atomic.LoadInt32(&dials) != 2 {
+		t.Errorf("client was not shared, %d dials", dials)
+	}
+	pool.Release(again)
+	pool.Release(first)
+	pool.Release(second)
+
+	// With both released, a new client replaces the least recently used one
+	if _, err := pool.Get(ctx, config("third")); err != nil {
+		t.Fatal(err)
+	}
+	if alive(first) {
+		t.Error("least recently used idle client was not closed")
+	}
+	if !alive(second) {
+		t.Error("more recently used client was closed")
+	}
+	if n := len(pool.clients); n != 2 {
+		t.Errorf("pool holds %d clients, want 2", n)
+	}
+}
+
+func TestPoolDialsUnlocked(t *testing.T) {
+	pool := NewPool(10, time.Minute, nil)
+	blocked := make(chan struct{})
+	pool.dial = func(ctx context.Context, config models.SSHConfig, store HostKeyStore) (*cryptossh.Client, error) {
+		if config.Host == "slow" {
+			<-blocked
+		}
+		return nil, net.UnknownNetworkError(config.Host)
+	}
+
+	go pool.Get(context.Background(), models.SSHConfig{Host: "slow"})
+	done := make(chan struct{})
+	go func() {
+		pool.Get(context.Background(), models.SSHConfig{Host: "fast", Port: 22})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("slow dial held up a dial to another server")
+	}
+	close(blocked)
+}
@@ -0,0 +1,90 @@
+// Package main provides a tool for managing the encrypted local credential vault
+//
+// The vault passphrase is read from DISCOVERY_VAULT_KEY. Secrets are read
+// from stdin so that they do not end up in the shell history:
+//
+//	printf '%s\n' "$PASSWORD" | go run ./tools/credential_vault -file vault.json -set win-admin -username 'CORP\svc-discovery'
+//	go run ./tools/credential_vault -file vault.json -list
+//	go run ./tools/credential_vault -file vault.json -delete win-admin
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/vobbilis/codegen/server-discovery/pkg/credentials"
+)
+
+func main() {
+	file := flag.String("file", "credentials.vault", "Path to the vault file")
+	keyEnv := flag.String("key-env", "DISCOVERY_VAULT_KEY", "Environment variable holding the vault passphrase")
+	set := flag.String("set", "", "Add or replace a credential; the password and an optional SSH key passphrase are read from the first two lines of stdin")
+	username := flag.String("username", "", "Username stored with -set")
+	remove := flag.String("delete", "", "Delete a credential")
+	list := flag.Bool("list", false, "List the stored credential names")
+	flag.Parse()
+
+	passphrase := os.Getenv(*keyEnv)
+	if passphrase == "" {
+		log.Fatalf("%s is not set", *keyEnv)
+	}
+
+	vault, err := credentials.ReadLocalVault(*file, passphrase)
+	if errors.Is(err, fs.ErrNotExist) && *set != "" {
+		vault = make(map[string]credentials.Credential)
+	} else if err != nil {
+		log.Fatalf("Error opening vault: %v", err)
+	}
+
+	switch {
+	case *list:
+		names := make([]string, 0, len(vault))
+		for name := range vault {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s\t%s\n", name, vault[name].Username)
+		}
+		return
+
+	case *set != "":
+		scanner := bufio.NewScanner(os.Stdin)
+		var lines []string
+		for len(lines) < 2 && scanner.Scan() {
+			lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+		}
+		if err := scanner.Err(); err != nil {
+			log.Fatalf("Error reading secrets from stdin: %v", err)
+		}
+		cred := credentials.Credential{Username: *username}
+		if len(lines) > 0 {
+			cred.Password = lines[0]
+		}
+		if len(lines) > 1 {
+			cred.Passphrase = lines[1]
+		}
+		vault[*set] = cred
+
+	case *remove != "":
+		if _, ok := vault[*remove]; !ok {
+			log.Fatalf("Credential %q not found", *remove)
+		}
+		delete(vault, *remove)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := credentials.WriteLocalVault(*file, passphrase, vault); err != nil {
+		log.Fatalf("Error writing vault: %v", err)
+	}
+}